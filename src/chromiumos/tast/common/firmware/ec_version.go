@@ -0,0 +1,113 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"regexp"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// ECCopy is a copy of the EC firmware, as reported by 'ectool version'.
+type ECCopy string
+
+// The EC firmware copies. Legacy ECs with two RW copies, RW-A and RW-B, report
+// them as ECCopyRW and ECCopyRWB respectively.
+const (
+	ECCopyRO  ECCopy = "RO"
+	ECCopyRW  ECCopy = "RW"
+	ECCopyRWB ECCopy = "RW_B"
+)
+
+// ecCopies maps the firmware copies reported by current and legacy ectool
+// versions to ECCopy.
+var ecCopies = map[string]ECCopy{
+	"RO":   ECCopyRO,
+	"RW":   ECCopyRW,
+	"RW_A": ECCopyRW,
+	"RW-A": ECCopyRW,
+	"A":    ECCopyRW,
+	"RW_B": ECCopyRWB,
+	"RW-B": ECCopyRWB,
+	"B":    ECCopyRWB,
+}
+
+// ECVersion is the EC version information parsed from 'ectool version'.
+type ECVersion struct {
+	// RO is the version of the RO copy, e.g. "hatch_v2.0.2791-3b6f3e5c6".
+	RO string
+	// RW is the version of the RW copy. On legacy ECs with two RW copies,
+	// it is the version of the active RW copy, or of RW-A if RO is active.
+	RW string
+	// Active is the copy which is running.
+	Active ECCopy
+	// Board is the board name prefixing the RO version, e.g. "hatch".
+	Board string
+	// BuildInfo is the build information of the running copy, which legacy
+	// ectool versions may not report.
+	BuildInfo string
+}
+
+// ecVersionLineRE matches the "key: value" lines of 'ectool version'.
+var ecVersionLineRE = regexp.MustCompile(`^([^:]+?)\s*:\s*(.*)$`)
+
+// ParseECVersion parses the output of 'ectool version'. Both the current
+// layout, with a single RW copy, and the legacy layout, with "RW-A version"
+// and "RW-B version" lines, are supported. Lines with unknown keys, e.g.
+// "Tool version", are ignored.
+func ParseECVersion(output string) (ECVersion, error) {
+	var v ECVersion
+	var rwA, rwB, active string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := ecVersionLineRE.FindStringSubmatch(line)
+		if m == nil {
+			return ECVersion{}, errors.Errorf("unrecognized line %q in ectool version output", line)
+		}
+		switch key, value := m[1], strings.TrimSpace(m[2]); key {
+		case "RO version":
+			v.RO = value
+		case "RW version":
+			v.RW = value
+		case "RW-A version":
+			rwA = value
+		case "RW-B version":
+			rwB = value
+		case "Firmware copy":
+			active = value
+		case "Build info":
+			v.BuildInfo = value
+		}
+	}
+
+	if active == "" {
+		return ECVersion{}, errors.New("firmware copy missing in ectool version output")
+	}
+	c, ok := ecCopies[active]
+	if !ok {
+		return ECVersion{}, errors.Errorf("unknown firmware copy %q in ectool version output", active)
+	}
+	v.Active = c
+	if v.RW == "" {
+		v.RW = rwA
+		if c == ECCopyRWB {
+			v.RW = rwB
+		}
+	}
+	if v.RO == "" {
+		return ECVersion{}, errors.New("RO version missing in ectool version output")
+	}
+	if v.RW == "" {
+		return ECVersion{}, errors.New("RW version missing in ectool version output")
+	}
+	if i := strings.Index(v.RO, "_v"); i > 0 {
+		v.Board = v.RO[:i]
+	}
+	return v, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseECVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		output string
+		want   ECVersion
+	}{
+		{
+			name: "current",
+			output: `RO version:    hatch_v2.0.2791-3b6f3e5c6
+RW version:    hatch_v2.0.2800-a0b1c2d3e
+Firmware copy: RW
+Build info:    hatch_v2.0.2800-a0b1c2d3e 2022-01-01 12:00:00 builder@host
+Tool version:  v2.0.2800-a0b1c2d3e 2022-01-01 12:00:00 builder@host
+`,
+			want: ECVersion{
+				RO:        "hatch_v2.0.2791-3b6f3e5c6",
+				RW:        "hatch_v2.0.2800-a0b1c2d3e",
+				Active:    ECCopyRW,
+				Board:     "hatch",
+				BuildInfo: "hatch_v2.0.2800-a0b1c2d3e 2022-01-01 12:00:00 builder@host",
+			},
+		},
+		{
+			name: "legacy",
+			output: `RO version:    link_v1.1.1000-abcdef0
+RW-A version:  link_v1.1.1001-abcdef1
+RW-B version:  link_v1.1.1002-abcdef2
+Firmware copy: RW-B
+Build info:    link_v1.1.1002-abcdef2 2013-01-01 12:00:00 builder@host
+`,
+			want: ECVersion{
+				RO:        "link_v1.1.1000-abcdef0",
+				RW:        "link_v1.1.1002-abcdef2",
+				Active:    ECCopyRWB,
+				Board:     "link",
+				BuildInfo: "link_v1.1.1002-abcdef2 2013-01-01 12:00:00 builder@host",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseECVersion(tc.output)
+			if err != nil {
+				t.Fatal("ParseECVersion failed: ", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseECVersion returned %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseECVersionErrors(t *testing.T) {
+	for _, output := range []string{
+		"RO version: hatch_v2.0.2791\nRW version: hatch_v2.0.2791\n",
+		"RO version: hatch_v2.0.2791\nRW version: hatch_v2.0.2791\nFirmware copy: XX\n",
+		"RW version: hatch_v2.0.2791\nFirmware copy: RW\n",
+		"RO version: hatch_v2.0.2791\ngarbage\nFirmware copy: RW\n",
+	} {
+		if _, err := ParseECVersion(output); err == nil {
+			t.Errorf("ParseECVersion(%q) succeeded unexpectedly", output)
+		}
+	}
+}
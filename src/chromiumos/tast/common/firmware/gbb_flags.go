@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
 	"chromiumos/tast/dut"
 	"chromiumos/tast/errors"
@@ -29,6 +30,63 @@ func init() {
 	sort.Slice(allGBBFlags, func(i, j int) bool { return allGBBFlags[i] < allGBBFlags[j] })
 }
 
+// GBBFlags is a bit mask of GBB flags, as stored in the GBB header and printed
+// by "futility gbb --flags".
+type GBBFlags uint32
+
+// The GBB flags as bit masks. See pb.GBBFlag for their meanings.
+const (
+	GBBFlagDevScreenShortDelay         GBBFlags = 1 << pb.GBBFlag_DEV_SCREEN_SHORT_DELAY
+	GBBFlagLoadOptionROMs              GBBFlags = 1 << pb.GBBFlag_LOAD_OPTION_ROMS
+	GBBFlagEnableAlternateOS           GBBFlags = 1 << pb.GBBFlag_ENABLE_ALTERNATE_OS
+	GBBFlagForceDevSwitchOn            GBBFlags = 1 << pb.GBBFlag_FORCE_DEV_SWITCH_ON
+	GBBFlagForceDevBootUSB             GBBFlags = 1 << pb.GBBFlag_FORCE_DEV_BOOT_USB
+	GBBFlagDisableFWRollbackCheck      GBBFlags = 1 << pb.GBBFlag_DISABLE_FW_ROLLBACK_CHECK
+	GBBFlagEnterTriggersToNorm         GBBFlags = 1 << pb.GBBFlag_ENTER_TRIGGERS_TONORM
+	GBBFlagForceDevBootLegacy          GBBFlags = 1 << pb.GBBFlag_FORCE_DEV_BOOT_LEGACY
+	GBBFlagRunningFAFT                 GBBFlags = 1 << pb.GBBFlag_RUNNING_FAFT
+	GBBFlagDisableECSoftwareSync       GBBFlags = 1 << pb.GBBFlag_DISABLE_EC_SOFTWARE_SYNC
+	GBBFlagDefaultDevBootAltFW         GBBFlags = 1 << pb.GBBFlag_DEFAULT_DEV_BOOT_ALTFW
+	GBBFlagDisableAuxFWSoftwareSync    GBBFlags = 1 << pb.GBBFlag_DISABLE_AUXFW_SOFTWARE_SYNC
+	GBBFlagDisableLidShutdown          GBBFlags = 1 << pb.GBBFlag_DISABLE_LID_SHUTDOWN
+	GBBFlagForceDevBootFastbootFullCap GBBFlags = 1 << pb.GBBFlag_FORCE_DEV_BOOT_FASTBOOT_FULL_CAP
+	GBBFlagForceManualRecovery         GBBFlags = 1 << pb.GBBFlag_FORCE_MANUAL_RECOVERY
+	GBBFlagDisableFWMP                 GBBFlags = 1 << pb.GBBFlag_DISABLE_FWMP
+	GBBFlagEnableUDC                   GBBFlags = 1 << pb.GBBFlag_ENABLE_UDC
+)
+
+// GBBFlagsFromList returns the bit mask of flags.
+func GBBFlagsFromList(flags []pb.GBBFlag) GBBFlags {
+	return GBBFlags(calcGBBMask(flags))
+}
+
+// List returns the flags set in f, in order by their bit positions. Unknown
+// bits are ignored.
+func (f GBBFlags) List() []pb.GBBFlag {
+	return calcGBBFlags(uint32(f))
+}
+
+// Has returns true if all of flags are set in f.
+func (f GBBFlags) Has(flags GBBFlags) bool {
+	return f&flags == flags
+}
+
+// String returns the hex value of f followed by the names of the flags set in
+// it, e.g. "0x00000109 (DEV_SCREEN_SHORT_DELAY|FORCE_DEV_SWITCH_ON|RUNNING_FAFT)".
+func (f GBBFlags) String() string {
+	var names []string
+	for _, flag := range f.List() {
+		names = append(names, flag.String())
+	}
+	if f != GBBFlagsFromList(f.List()) {
+		names = append(names, "unknown")
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("0x%08x", uint32(f))
+	}
+	return fmt.Sprintf("0x%08x (%s)", uint32(f), strings.Join(names, "|"))
+}
+
 // AllGBBFlags returns all the GBB Flags in order by their int values.
 func AllGBBFlags() []pb.GBBFlag {
 	return allGBBFlags
@@ -74,25 +132,74 @@ func GBBFlagsChanged(a, b *pb.GBBFlagsState, flags []pb.GBBFlag) bool {
 	return false
 }
 
+// reGBBFlags matches the flags printed by get_gbb_flags.sh.
+var reGBBFlags = regexp.MustCompile(`Chrome ?OS GBB set flags: (0x[0-9a-fA-F]+)`)
+
+// parseGBBFlags parses the flags printed by get_gbb_flags.sh.
+func parseGBBFlags(out []byte) (uint32, error) {
+	matches := reGBBFlags.FindSubmatch(out)
+	if matches == nil {
+		return 0, errors.Errorf("failed to find gbb flags in %s", string(out))
+	}
+	currentGBB64, err := strconv.ParseUint(string(matches[1]), 0, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse gbb %q", string(matches[1]))
+	}
+	return uint32(currentGBB64), nil
+}
+
 // getGBBFlagsInt gets the flags that are set as an integer.
 func getGBBFlagsInt(ctx context.Context, dut *dut.DUT) (uint32, error) {
 	out, err := dut.Conn().CommandContext(ctx, "/usr/share/vboot/bin/get_gbb_flags.sh").Output(exec.DumpLogOnError)
 	if err != nil {
 		return 0, errors.Wrap(err, "get_gbb_flags.sh")
 	}
-	re, err := regexp.Compile(`Chrome ?OS GBB set flags: (0x[0-9a-fA-F]+)`)
+	return parseGBBFlags(out)
+}
+
+// setGBBFlagsInt sets the flags to the integer flags. An error wrapping
+// ErrGBBWriteProtected is returned if write protection prevents the change.
+func setGBBFlagsInt(ctx context.Context, dut *dut.DUT, flags uint32) error {
+	out, err := dut.Conn().CommandContext(ctx, "/usr/share/vboot/bin/set_gbb_flags.sh", fmt.Sprintf("%#x", flags)).CombinedOutput()
 	if err != nil {
-		return 0, errors.Wrap(err, "parse gbb regex")
+		msg := strings.TrimSpace(string(out))
+		if strings.Contains(strings.ToLower(msg), "write protect") {
+			return errors.Wrapf(ErrGBBWriteProtected, "set_gbb_flags.sh: %s", msg)
+		}
+		return errors.Wrapf(err, "set_gbb_flags.sh: %s", msg)
 	}
-	matches := re.FindSubmatch(out)
-	if matches == nil {
-		return 0, errors.Errorf("failed to find gbb flags in %s", string(out))
+	return nil
+}
+
+// ErrGBBWriteProtected is returned when the GBB cannot be written because the
+// AP firmware is write-protected.
+var ErrGBBWriteProtected = errors.New("GBB is write-protected")
+
+// ReadGBBFlags returns the GBB flags as a bit mask.
+func ReadGBBFlags(ctx context.Context, dut *dut.DUT) (GBBFlags, error) {
+	flags, err := getGBBFlagsInt(ctx, dut)
+	if err != nil {
+		return 0, err
 	}
-	currentGBB64, err := strconv.ParseUint(string(matches[1]), 0, 32)
+	return GBBFlags(flags), nil
+}
+
+// WriteGBBFlags overwrites all the GBB flags with flags, and reads them back to
+// verify them. An error wrapping ErrGBBWriteProtected is returned if write
+// protection prevents the change.
+func WriteGBBFlags(ctx context.Context, dut *dut.DUT, flags GBBFlags) error {
+	testing.ContextLogf(ctx, "Setting GBB flags to %v", flags)
+	if err := setGBBFlagsInt(ctx, dut, uint32(flags)); err != nil {
+		return err
+	}
+	got, err := ReadGBBFlags(ctx, dut)
 	if err != nil {
-		return 0, errors.Wrapf(err, "parse gbb %q", string(matches[1]))
+		return errors.Wrap(err, "failed to verify GBB flags")
 	}
-	return uint32(currentGBB64), nil
+	if got != flags {
+		return errors.Errorf("GBB flags are %v after setting them to %v, write protection may be enabled", got, flags)
+	}
+	return nil
 }
 
 // GetGBBFlags gets the flags that are cleared and set.
@@ -111,33 +218,59 @@ func GetGBBFlags(ctx context.Context, dut *dut.DUT) (*pb.GBBFlagsState, error) {
 // ClearAndSetGBBFlags clears and sets specified GBB flags, leaving the rest unchanged.
 func ClearAndSetGBBFlags(ctx context.Context, dut *dut.DUT, state *pb.GBBFlagsState) error {
 	state = canonicalGBBFlagsState(state)
+	_, _, err := updateGBBFlagsInt(ctx, dut, calcGBBMask(state.Clear), calcGBBMask(state.Set))
+	return err
+}
+
+// UpdateGBBFlags sets the flags in set and clears the flags in clear, leaving
+// the other GBB flags unchanged, and reads them back to verify them if they
+// changed. It is an error for a flag to be in both set and clear. An error
+// wrapping ErrGBBWriteProtected is returned if write protection prevents the
+// change.
+func UpdateGBBFlags(ctx context.Context, dut *dut.DUT, set, clear GBBFlags) error {
+	if set&clear != 0 {
+		return errors.Errorf("GBB flags %v are both set and cleared", set&clear)
+	}
+	newGBB, changed, err := updateGBBFlagsInt(ctx, dut, uint32(clear), uint32(set))
+	if err != nil || !changed {
+		return err
+	}
+	got, err := ReadGBBFlags(ctx, dut)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify GBB flags")
+	}
+	if want := GBBFlags(newGBB); got != want {
+		return errors.Errorf("GBB flags are %v after setting them to %v, write protection may be enabled", got, want)
+	}
+	return nil
+}
+
+// updateGBBFlagsInt reads the current flags, clears the ones in clearMask and
+// sets the ones in setMask, and writes them back if they changed. It returns
+// the new flags and whether they were written.
+func updateGBBFlagsInt(ctx context.Context, dut *dut.DUT, clearMask, setMask uint32) (uint32, bool, error) {
 	currentGBB, err := getGBBFlagsInt(ctx, dut)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
-	clearMask := calcGBBMask(state.Clear)
-	setMask := calcGBBMask(state.Set)
 	testing.ContextLogf(ctx, "Current GBB flags = %#x, want clear %#x, set %#x", currentGBB, clearMask, setMask)
 	newGBB := (currentGBB & ^clearMask) | setMask
-	if newGBB != currentGBB {
-		testing.ContextLogf(ctx, "Setting GBB flags = %#x", newGBB)
-		if err := dut.Conn().CommandContext(ctx, "/usr/share/vboot/bin/set_gbb_flags.sh", fmt.Sprintf("%#x", newGBB)).Run(exec.DumpLogOnError); err != nil {
-			return errors.Wrap(err, "set_gbb_flags.sh")
-		}
-	} else {
+	if newGBB == currentGBB {
 		testing.ContextLog(ctx, "No GBB change required")
+		return newGBB, false, nil
 	}
-	return nil
+	testing.ContextLogf(ctx, "Setting GBB flags = %#x", newGBB)
+	if err := setGBBFlagsInt(ctx, dut, newGBB); err != nil {
+		return 0, false, err
+	}
+	return newGBB, true, nil
 }
 
 // SetGBBFlags ignores the previous GBB flags and sets them to the specified flags.
 func SetGBBFlags(ctx context.Context, dut *dut.DUT, flags []pb.GBBFlag) error {
 	setMask := calcGBBMask(flags)
 	testing.ContextLogf(ctx, "Setting GBB flags = %#x", setMask)
-	if err := dut.Conn().CommandContext(ctx, "/usr/share/vboot/bin/set_gbb_flags.sh", fmt.Sprintf("%#x", setMask)).Run(exec.DumpLogOnError); err != nil {
-		return errors.Wrap(err, "set_gbb_flags.sh")
-	}
-	return nil
+	return setGBBFlagsInt(ctx, dut, setMask)
 }
 
 // calcGBBFlags interprets mask as a GBBFlag bit mask and returns the set flags.
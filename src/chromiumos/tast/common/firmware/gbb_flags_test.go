@@ -112,3 +112,92 @@ func TestAllGBBFlags(t *testing.T) {
 		t.Errorf("All flags\ngot\n%v\nwant\n%v", got, want)
 	}
 }
+
+func TestGBBFlagsString(t *testing.T) {
+	for _, tc := range []struct {
+		f    GBBFlags
+		want string
+	}{
+		{0, "0x00000000"},
+		{GBBFlagDevScreenShortDelay | GBBFlagForceDevSwitchOn | GBBFlagRunningFAFT, "0x00000109 (DEV_SCREEN_SHORT_DELAY|FORCE_DEV_SWITCH_ON|RUNNING_FAFT)"},
+		{GBBFlagDisableFWMP | 1<<31, "0x80008000 (DISABLE_FWMP|unknown)"},
+	} {
+		if got := tc.f.String(); got != tc.want {
+			t.Errorf("GBBFlags(%#x).String() = %q; want %q", uint32(tc.f), got, tc.want)
+		}
+	}
+}
+
+func TestParseGBBFlags(t *testing.T) {
+	for _, tc := range []struct {
+		out     string
+		want    uint32
+		wantErr bool
+	}{
+		{"Chrome OS GBB set flags: 0x00000039\n", 0x39, false},
+		{"ChromeOS GBB set flags: 0x00000000\n", 0, false},
+		{"Using flash...\nChromeOS GBB set flags: 0x80008000\nDone\n", 0x80008000, false},
+		{"ChromeOS GBB set flags: 0x100000000\n", 0, true},
+		{"flags: 0x00000039\n", 0, true},
+		{"", 0, true},
+	} {
+		got, err := parseGBBFlags([]byte(tc.out))
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseGBBFlags(%q) = %#x; want an error", tc.out, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGBBFlags(%q) failed: %v", tc.out, err)
+		} else if got != tc.want {
+			t.Errorf("parseGBBFlags(%q) = %#x; want %#x", tc.out, got, tc.want)
+		}
+	}
+}
+
+func TestGBBFlagsHas(t *testing.T) {
+	f := GBBFlagDevScreenShortDelay | GBBFlagForceDevSwitchOn
+	for _, tc := range []struct {
+		flags GBBFlags
+		want  bool
+	}{
+		{0, true},
+		{GBBFlagDevScreenShortDelay, true},
+		{GBBFlagDevScreenShortDelay | GBBFlagForceDevSwitchOn, true},
+		{GBBFlagRunningFAFT, false},
+		{GBBFlagForceDevSwitchOn | GBBFlagRunningFAFT, false},
+	} {
+		if got := f.Has(tc.flags); got != tc.want {
+			t.Errorf("GBBFlags(%v).Has(%v) = %v; want %v", f, tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestGBBFlagsList(t *testing.T) {
+	for _, tc := range []struct {
+		f    GBBFlags
+		want []pb.GBBFlag
+	}{
+		{0, nil},
+		{GBBFlagRunningFAFT | GBBFlagDevScreenShortDelay, []pb.GBBFlag{pb.GBBFlag_DEV_SCREEN_SHORT_DELAY, pb.GBBFlag_RUNNING_FAFT}},
+		{GBBFlagEnableUDC | 1<<31, []pb.GBBFlag{pb.GBBFlag_ENABLE_UDC}},
+	} {
+		if got := tc.f.List(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GBBFlags(%#x).List() = %v; want %v", uint32(tc.f), got, tc.want)
+		}
+	}
+}
+
+func TestGBBFlagsRoundTrip(t *testing.T) {
+	for _, f := range []GBBFlags{
+		0,
+		GBBFlagDevScreenShortDelay,
+		GBBFlagForceDevSwitchOn | GBBFlagForceDevBootUSB | GBBFlagDisableECSoftwareSync,
+		GBBFlagsFromList(AllGBBFlags()),
+	} {
+		if got := GBBFlagsFromList(f.List()); got != f {
+			t.Errorf("GBBFlagsFromList(GBBFlags(%#x).List()) = %#x; want %#x", uint32(f), uint32(got), uint32(f))
+		}
+	}
+}
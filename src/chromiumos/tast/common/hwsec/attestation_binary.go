@@ -0,0 +1,32 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package hwsec
+
+import (
+	"context"
+)
+
+// attestationBinary is used to interact with the attestationd process over
+// 'attestation_client' executable. For more details of the arguments of the
+// functions in this file, please check //src/platform2/attestation/client/main.cc.
+type attestationBinary struct {
+	runner CmdRunner
+}
+
+// newAttestationBinary is a factory function to create an
+// attestationBinary instance.
+func newAttestationBinary(r CmdRunner) *attestationBinary {
+	return &attestationBinary{r}
+}
+
+// call is a simple utility that helps to call attestation_client.
+func (c *attestationBinary) call(ctx context.Context, args ...string) ([]byte, error) {
+	return c.runner.Run(ctx, "attestation_client", args...)
+}
+
+// endorsement calls "attestation_client endorsement".
+func (c *attestationBinary) endorsement(ctx context.Context) ([]byte, error) {
+	return c.call(ctx, "endorsement")
+}
@@ -5,6 +5,7 @@
 package hwsec
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -293,6 +294,78 @@ func (at *AttestationTest) SignEnterpriseChallenge(ctx context.Context, username
 	return nil
 }
 
+// ErrNotEnrolled is returned by PerformAttestationChallenge if the DUT is not
+// enrolled with the PCA, so that no challenge can be signed.
+var ErrNotEnrolled = errors.New("DUT is not enrolled for attestation")
+
+// PerformAttestationChallenge signs a VA challenge with the certified key
+// keyLabel of username, checks the response, and returns it. An empty username
+// refers to a device key. If challenge is nil, a new one is fetched from the VA
+// server; otherwise it must have been issued by the VA server too. The response
+// is only returned once it is found to answer challenge and is accepted by the
+// VA server. ErrNotEnrolled is returned if the DUT is not enrolled, and an
+// AttestationError if the attestation daemon fails to sign, e.g. because the key
+// does not exist.
+func (at *AttestationTest) PerformAttestationChallenge(ctx context.Context, challenge []byte, username, keyLabel string) ([]byte, error) {
+	enrolled, err := at.ac.IsEnrolled(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get enrollment status")
+	}
+	if !enrolled {
+		return nil, ErrNotEnrolled
+	}
+	if challenge == nil {
+		if challenge, err = at.va.GetDecodedVAChallenge(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to get VA challenge")
+		}
+	}
+	signedChallenge, err := at.ac.SignEnterpriseVAChallenge(
+		ctx,
+		0,
+		username,
+		keyLabel,
+		username,
+		"fake_device_id",
+		true,
+		challenge)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign VA challenge with key %q", keyLabel)
+	}
+	if err := checkChallengeResponse(challenge, []byte(signedChallenge)); err != nil {
+		return nil, errors.Wrap(err, "invalid VA challenge response")
+	}
+	b64SignedChallenge := base64.StdEncoding.EncodeToString([]byte(signedChallenge))
+	if err := at.va.VerifyEncodedVAChallenge(ctx, b64SignedChallenge); err != nil {
+		return nil, errors.Wrap(err, "failed to verify VA challenge")
+	}
+	return []byte(signedChallenge), nil
+}
+
+// checkChallengeResponse checks that the signed response answers challenge,
+// i.e. that the ChallengeResponse it carries embeds the same signed challenge.
+func checkChallengeResponse(challenge, response []byte) error {
+	var want apb.SignedData
+	if err := proto.Unmarshal(challenge, &want); err != nil {
+		return errors.Wrap(err, "failed to unmarshal challenge")
+	}
+	signedResp, err := UnmarshalSignedData(response)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal signed response")
+	}
+	if len(signedResp.GetSignature()) == 0 {
+		return errors.New("response is not signed")
+	}
+	var resp apb.ChallengeResponse
+	if err := proto.Unmarshal(signedResp.GetData(), &resp); err != nil {
+		return errors.Wrap(err, "failed to unmarshal challenge response")
+	}
+	got := resp.GetChallenge()
+	if !bytes.Equal(got.GetData(), want.GetData()) || !bytes.Equal(got.GetSignature(), want.GetSignature()) {
+		return errors.New("response does not answer the challenge")
+	}
+	return nil
+}
+
 // SignSimpleChallenge signs a known, short data with the cert, and verify it using its public key
 func (at *AttestationTest) SignSimpleChallenge(ctx context.Context, username, label string) error {
 	signedChallenge, err := at.ac.SignSimpleChallenge(ctx, username, label, []byte{})
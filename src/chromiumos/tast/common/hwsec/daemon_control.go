@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
 )
 
 // DaemonGoal describes a job's goal. See Section 10.1.6.19, "initctl status", in the Upstart Cookbook.
@@ -356,6 +357,44 @@ func (dc *DaemonController) RestartTPMDaemons(ctx context.Context) error {
 	return nil
 }
 
+// daemonHealthyTimeout is how long WaitForDaemonHealthy waits for a daemon to
+// be healthy.
+const daemonHealthyTimeout = 30 * time.Second
+
+// checkDaemonHealthy returns nil if the daemon is running and, if it has D-Bus
+// interface, responds to a D-Bus ping.
+func (dc *DaemonController) checkDaemonHealthy(ctx context.Context, info *DaemonInfo) error {
+	goal, state, pid, err := dc.Status(ctx, info)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the status of %s", info.Name)
+	}
+	if goal != startGoal || state != runningState || pid <= 0 {
+		return errors.Errorf("%s is not running: %s/%s, pid %d", info.Name, goal, state, pid)
+	}
+	if !info.HasDBus {
+		return nil
+	}
+	// org.freedesktop.DBus.Peer.Ping is answered by the D-Bus library of the
+	// daemon, so it tells the daemon is serving D-Bus without side effects.
+	if _, err := dc.r.Run(ctx, "dbus-send", "--system", "--print-reply", "--dest="+info.DBusName, "/", "org.freedesktop.DBus.Peer.Ping"); err != nil {
+		return errors.Wrapf(err, "%s does not respond on D-Bus", info.Name)
+	}
+	return nil
+}
+
+// WaitForDaemonHealthy waits until a daemon, e.g. AttestationDaemon,
+// CryptohomeDaemon, TPMManagerDaemon or ChapsDaemon, is running and responsive
+// on D-Bus if it has D-Bus interface. This is meant to check that a daemon
+// recovered after it is killed. The last error is returned on timeout.
+func (dc *DaemonController) WaitForDaemonHealthy(ctx context.Context, info *DaemonInfo) error {
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		return dc.checkDaemonHealthy(ctx, info)
+	}, &testing.PollOptions{
+		Timeout:  daemonHealthyTimeout,
+		Interval: PollingInterval,
+	})
+}
+
 // parseStatus parses the output from "initctl status <job>", e.g. "ui start/running, process 28515".
 // The output may be multiple lines; see the example in Section 10.1.6.19.3,
 // "Single Job Instance Running with Multiple PIDs", in the Upstart Cookbook.
@@ -0,0 +1,121 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package hwsec
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"chromiumos/tast/errors"
+)
+
+// These match lines in the output from "attestation_client endorsement",
+// which prints the GetEndorsementInfoReply protobuf with GetProtoDebugString,
+// one field per line with the bytes fields hex-encoded, e.g.:
+//
+//	{
+//	  status: STATUS_SUCCESS
+//	  ek_public_key: 30820122300D06092A864886F70D01010105000382010F00...
+//	  ek_certificate: 308203A5308202...
+//	}
+var (
+	endorsementStatusRegexp = regexp.MustCompile(`(?m)^\s*status:\s*(\S+)\s*$`)
+	ekCertificateRegexp     = regexp.MustCompile(`(?m)^\s*ek_certificate:\s*([0-9A-Fa-f]*)\s*$`)
+	ekPublicKeyRegexp       = regexp.MustCompile(`(?m)^\s*ek_public_key:\s*([0-9A-Fa-f]*)\s*$`)
+)
+
+// ErrEKCertNotVerifiable is returned by HasValidEKCert if an endorsement
+// certificate is present but cannot be verified.
+var ErrEKCertNotVerifiable = errors.New("endorsement certificate is not verifiable")
+
+// endorsementInfo returns the DER-encoded endorsement certificate and public
+// key reported by the attestation daemon. Either may be empty.
+func (h *CmdHelper) endorsementInfo(ctx context.Context) (cert, pub []byte, err error) {
+	out, err := newAttestationBinary(h.cmdRunner).endorsement(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get endorsement info: %q", string(out))
+	}
+	return parseEndorsementInfo(out)
+}
+
+// parseEndorsementInfo parses out, the output of "attestation_client
+// endorsement", into the DER-encoded endorsement certificate and public key.
+// A field missing from out is returned as an empty slice.
+func parseEndorsementInfo(out []byte) (cert, pub []byte, err error) {
+	m := endorsementStatusRegexp.FindSubmatch(out)
+	if m == nil {
+		return nil, nil, errors.Errorf("no status in endorsement info: %q", string(out))
+	}
+	if status := string(m[1]); status != "STATUS_SUCCESS" {
+		return nil, nil, errors.Errorf("failed to get endorsement info with status %s", status)
+	}
+	decode := func(re *regexp.Regexp, name string) ([]byte, error) {
+		m := re.FindSubmatch(out)
+		if m == nil {
+			return nil, nil
+		}
+		b, err := hex.DecodeString(string(m[1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", name)
+		}
+		return b, nil
+	}
+	if cert, err = decode(ekCertificateRegexp, "ek_certificate"); err != nil {
+		return nil, nil, err
+	}
+	if pub, err = decode(ekPublicKeyRegexp, "ek_public_key"); err != nil {
+		return nil, nil, err
+	}
+	return cert, pub, nil
+}
+
+// GetEKCertificate returns the DER-encoded endorsement key certificate
+// retrieved via the attestation daemon. An empty slice is returned if the
+// device has no endorsement certificate provisioned.
+func (h *CmdHelper) GetEKCertificate(ctx context.Context) ([]byte, error) {
+	cert, _, err := h.endorsementInfo(ctx)
+	return cert, err
+}
+
+// HasValidEKCert checks whether the device has a valid endorsement key
+// certificate. It returns false with a nil error if no certificate is
+// provisioned. If a certificate is present but cannot be verified, i.e. it is
+// malformed, is outside of its validity period, or does not certify the
+// endorsement key of the TPM, false is returned together with an error
+// wrapping ErrEKCertNotVerifiable.
+func (h *CmdHelper) HasValidEKCert(ctx context.Context) (bool, error) {
+	der, pub, err := h.endorsementInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(der) == 0 {
+		return false, nil
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return false, errors.Wrapf(ErrEKCertNotVerifiable, "failed to parse certificate: %v", err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return false, errors.Wrapf(ErrEKCertNotVerifiable, "certificate is valid only from %v to %v", cert.NotBefore, cert.NotAfter)
+	}
+	if len(pub) == 0 {
+		return false, errors.Wrap(ErrEKCertNotVerifiable, "no endorsement public key to verify against")
+	}
+	ekPub, err := x509.ParsePKIXPublicKey(pub)
+	if err != nil {
+		return false, errors.Wrapf(ErrEKCertNotVerifiable, "failed to parse endorsement public key: %v", err)
+	}
+	certPub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certPub.Equal(ekPub) {
+		return false, errors.Wrap(ErrEKCertNotVerifiable, "certificate does not certify the endorsement key")
+	}
+	return true, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package hwsec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseEndorsementInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		out      string
+		wantCert []byte
+		wantPub  []byte
+		wantErr  bool
+	}{
+		{
+			name: "certificate and public key",
+			out: `{
+  status: STATUS_SUCCESS
+  ek_public_key: 30820122300D06092A
+  ek_certificate: 308203a5308202
+  ek_info: "TPM 2.0"
+}
+`,
+			wantCert: []byte{0x30, 0x82, 0x03, 0xa5, 0x30, 0x82, 0x02},
+			wantPub:  []byte{0x30, 0x82, 0x01, 0x22, 0x30, 0x0d, 0x06, 0x09, 0x2a},
+		},
+		{
+			name: "no certificate",
+			out: `{
+  status: STATUS_SUCCESS
+  ek_public_key: 3082
+}
+`,
+			wantPub: []byte{0x30, 0x82},
+		},
+		{
+			name: "failure status",
+			out: `{
+  status: STATUS_NOT_AVAILABLE
+}
+`,
+			wantErr: true,
+		},
+		{
+			name:    "no status",
+			out:     "",
+			wantErr: true,
+		},
+		{
+			name: "malformed hex",
+			out: `{
+  status: STATUS_SUCCESS
+  ek_certificate: 30820
+}
+`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, pub, err := parseEndorsementInfo([]byte(tc.out))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("parseEndorsementInfo succeeded unexpectedly")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("parseEndorsementInfo failed: ", err)
+			}
+			if !bytes.Equal(cert, tc.wantCert) {
+				t.Errorf("Unexpected certificate: got %x, want %x", cert, tc.wantCert)
+			}
+			if !bytes.Equal(pub, tc.wantPub) {
+				t.Errorf("Unexpected public key: got %x, want %x", pub, tc.wantPub)
+			}
+		})
+	}
+}
@@ -11,10 +11,12 @@ This file implements miscellaneous and unsorted helpers.
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -275,9 +277,51 @@ func (h *CmdHelper) GetTPMVersion(ctx context.Context) (string, error) {
 	return strings.TrimSpace(string(out)), err
 }
 
+// tpmMaxRandomBytes is the number of random bytes requested from the TPM at
+// once. TPMs cap the size of a single TPM2_GetRandom response to the size of
+// their largest digest, which is at least 32 bytes.
+const tpmMaxRandomBytes = 32
+
+// GetRandomTimed returns numBytes random bytes generated by the TPM, along with
+// the total time taken by the TPM requests. Large requests are split into
+// several requests of tpmMaxRandomBytes bytes, and only the time spent in the
+// requests is summed, so it can be used to measure the TPM RNG throughput.
+func (h *CmdHelper) GetRandomTimed(ctx context.Context, numBytes int) ([]byte, time.Duration, error) {
+	if numBytes <= 0 {
+		return nil, 0, errors.Errorf("invalid number of random bytes %d", numBytes)
+	}
+	result := make([]byte, 0, numBytes)
+	var elapsed time.Duration
+	for len(result) < numBytes {
+		n := numBytes - len(result)
+		if n > tpmMaxRandomBytes {
+			n = tpmMaxRandomBytes
+		}
+		start := time.Now()
+		out, err := h.cmdRunner.Run(ctx, "tpmc", "getrandom", strconv.Itoa(n))
+		elapsed += time.Since(start)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to get %d random bytes from TPM", n)
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(string(out)), ""))
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to parse random bytes %q", out)
+		}
+		if len(b) != n {
+			return nil, 0, errors.Errorf("unexpected number of random bytes: got %d, want %d", len(b), n)
+		}
+		result = append(result, b...)
+	}
+	return result, elapsed, nil
+}
+
 // ErrIneffectiveReset is returned if the TPM is owned after reset attempt.
 var ErrIneffectiveReset = errors.New("ineffective reset of TPM")
 
+// ErrTPMClearUnsupported is returned if the TPM cannot be cleared without a
+// physical presence gate on this platform.
+var ErrTPMClearUnsupported = errors.New("TPM cannot be cleared non-destructively on this platform")
+
 // ensureTPMIsReset ensures the TPM is reset when the function returns nil.
 // Otherwise, returns any encountered error.
 // Optionally removes files from the DUT to simulate a powerwash.
@@ -437,6 +481,28 @@ func (h *CmdTPMClearHelper) EnsureTPMAndSystemStateAreReset(ctx context.Context)
 	return h.ensureTPMIsReset(ctx, true)
 }
 
+// ClearAndReInitTPM clears the TPM ownership and takes it again, leaving the
+// system states other than the TPM untouched. It returns ErrTPMClearUnsupported
+// if the TPM cannot be cleared without a physical presence gate, i.e. it is not
+// a TPM 2.0. It returns nil once the TPM is owned again.
+func (h *CmdTPMClearHelper) ClearAndReInitTPM(ctx context.Context) error {
+	version, err := h.GetTPMVersion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get TPM version")
+	}
+	if version != "2.0" {
+		return errors.Wrapf(ErrTPMClearUnsupported, "TPM version %s", version)
+	}
+
+	if err := h.EnsureTPMIsReset(ctx); err != nil {
+		return errors.Wrap(err, "failed to clear TPM ownership")
+	}
+	if err := h.EnsureTPMIsReady(ctx, DefaultTakingOwnershipTimeout); err != nil {
+		return errors.Wrap(err, "failed to wait for TPM to be owned again")
+	}
+	return nil
+}
+
 // EnableUserSecretStash enables the UserSecretStash experiment by removing the
 // disable flag file and creating a flag file that's checked by cryptohomed.
 func (h *CmdTPMClearHelper) EnableUserSecretStash(ctx context.Context) (func(context.Context) error, error) {
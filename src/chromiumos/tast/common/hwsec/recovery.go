@@ -0,0 +1,91 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package hwsec
+
+import (
+	"context"
+
+	uda "chromiumos/system_api/user_data_auth_proto"
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// RecoveryRequest is a cryptohome recovery request prepared by PrepareRecovery,
+// to be sent to the recovery mediator.
+type RecoveryRequest struct {
+	// User is the user whose vault is recovered.
+	User string
+	// Label is the label of the recovery auth factor.
+	Label string
+	// AuthSessionID is the auth session the recovery is performed in.
+	AuthSessionID string
+	// EpochResponseHex is the hex-encoded epoch response of the mediator the
+	// request was created with.
+	EpochResponseHex string
+	// RequestHex is the hex-encoded recovery request.
+	RequestHex string
+}
+
+// RecoveryResponse is the response of the recovery mediator to a
+// RecoveryRequest.
+type RecoveryResponse struct {
+	// ResponseHex is the hex-encoded recovery response.
+	ResponseHex string
+}
+
+// PrepareRecovery starts an auth session for user and creates the recovery
+// request of the recovery auth factor label, with the epoch response of the
+// mediator. The request is to be mediated and passed to CompleteRecovery along
+// with the response.
+func (u *CryptohomeClient) PrepareRecovery(ctx context.Context, user, label, epochResponseHex string) (*RecoveryRequest, error) {
+	_, authSessionID, err := u.StartAuthSession(ctx, user, false /*ephemeral*/, uda.AuthIntent_AUTH_INTENT_DECRYPT)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start auth session")
+	}
+	requestHex, err := u.FetchRecoveryRequest(ctx, authSessionID, label, epochResponseHex)
+	if err != nil {
+		if err := u.InvalidateAuthSession(ctx, authSessionID); err != nil {
+			testing.ContextLog(ctx, "Failed to invalidate auth session: ", err)
+		}
+		return nil, errors.Wrap(err, "failed to get recovery request")
+	}
+	return &RecoveryRequest{
+		User:             user,
+		Label:            label,
+		AuthSessionID:    authSessionID,
+		EpochResponseHex: epochResponseHex,
+		RequestHex:       requestHex,
+	}, nil
+}
+
+// CompleteRecovery authenticates the auth session of req with the recovery
+// response resp of the mediator, mounts the persistent vault of the user, and
+// checks that it is mounted. The auth session is invalidated on failure.
+func (u *CryptohomeClient) CompleteRecovery(ctx context.Context, req *RecoveryRequest, resp *RecoveryResponse) (retErr error) {
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		if err := u.InvalidateAuthSession(ctx, req.AuthSessionID); err != nil {
+			testing.ContextLog(ctx, "Failed to invalidate auth session: ", err)
+		}
+	}()
+	if err := u.AuthenticateRecoveryAuthFactor(ctx, req.AuthSessionID, req.Label, req.EpochResponseHex, resp.ResponseHex); err != nil {
+		return errors.Wrap(err, "failed to authenticate with recovery auth factor")
+	}
+	if err := u.PreparePersistentVault(ctx, req.AuthSessionID, false /*ecryptfs*/); err != nil {
+		return errors.Wrap(err, "failed to prepare persistent vault")
+	}
+	// Check the vault of the recovered user, as IsMounted tells whether any
+	// vault is mounted.
+	mounted, err := NewCryptohomeMountInfo(u.runner, u).IsMounted(ctx, req.User)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check whether the vault of %s is mounted", req.User)
+	}
+	if !mounted {
+		return errors.Errorf("vault of %s is not mounted after recovery", req.User)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filemanager
+
+import (
+	"context"
+	"time"
+
+	"chromiumos/tast/ctxutil"
+	"chromiumos/tast/local/chrome/uiauto/faillog"
+	"chromiumos/tast/local/chrome/uiauto/filesapp"
+	"chromiumos/tast/local/drivefs"
+	"chromiumos/tast/testing"
+)
+
+func init() {
+	testing.AddTest(&testing.Test{
+		Func:         DrivefsTrashRestore,
+		LacrosStatus: testing.LacrosVariantUnneeded,
+		Desc:         "Verify that trashing and restoring a file in Drive Web is reflected in the Files app",
+		Contacts: []string{
+			"chromeos-files-syd@google.com",
+		},
+		SoftwareDeps: []string{
+			"chrome",
+			"chrome_internal",
+			"drivefs",
+		},
+		Attr: []string{
+			"group:mainline",
+			"group:drivefs-cq",
+			"informational",
+		},
+		Timeout: 5 * time.Minute,
+		Fixture: "driveFsStarted",
+	})
+}
+
+func DrivefsTrashRestore(ctx context.Context, s *testing.State) {
+	// Changes made with the Drive API may take a while to be synced.
+	const syncTimeout = 2 * time.Minute
+
+	fixt := s.FixtValue().(*drivefs.FixtureData)
+	apiClient := fixt.APIClient
+	tconn := fixt.TestAPIConn
+
+	// Give the Drive API enough time to remove the file.
+	cleanupCtx := ctx
+	ctx, cancel := ctxutil.Shorten(ctx, 10*time.Second)
+	defer cancel()
+	defer fixt.DriveFs.SaveLogsOnError(cleanupCtx, s.HasError)
+	defer faillog.DumpUITreeOnError(cleanupCtx, s.OutDir(), s.HasError, tconn)
+
+	testFileName := drivefs.GenerateTestFileName(s.TestName()) + ".txt"
+	driveFile, err := apiClient.CreateFile(ctx, testFileName, "root", nil)
+	if err != nil {
+		s.Fatal("Could not create test file: ", err)
+	}
+	s.Logf("Created %s with ID: %s", testFileName, driveFile.Id)
+	defer apiClient.RemoveFileByID(cleanupCtx, driveFile.Id)
+
+	files, err := filesapp.Launch(ctx, tconn)
+	if err != nil {
+		s.Fatal("Failed to launch Files app: ", err)
+	}
+	defer files.Close(cleanupCtx)
+	files = files.WithTimeout(syncTimeout)
+
+	if err := files.OpenDrive()(ctx); err != nil {
+		s.Fatal("Failed to open Drive: ", err)
+	}
+	if err := files.PerformActionAndRetryMaximizedOnFail(files.WaitForFile(testFileName))(ctx); err != nil {
+		s.Fatal("Failed to wait for the test file: ", err)
+	}
+
+	if _, err := apiClient.TrashFile(ctx, driveFile.Id); err != nil {
+		s.Fatal("Failed to trash the test file: ", err)
+	}
+	if err := files.WaitUntilFileGone(testFileName)(ctx); err != nil {
+		s.Fatal("Trashed file did not disappear: ", err)
+	}
+
+	if _, err := apiClient.RestoreFile(ctx, driveFile.Id); err != nil {
+		s.Fatal("Failed to restore the test file: ", err)
+	}
+	if err := files.WaitForFile(testFileName)(ctx); err != nil {
+		s.Fatal("Restored file did not reappear: ", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -659,6 +660,12 @@ func (c *Chrome) CloseTarget(ctx context.Context, id TargetID) error {
 	return c.sess.CloseTarget(ctx, id)
 }
 
+// CloseAllTargetsExcept closes all pages (e.g. tabs) except the one identified
+// by keep, which resets Chrome to a single page between test iterations.
+func (c *Chrome) CloseAllTargetsExcept(ctx context.Context, keep TargetID) error {
+	return c.sess.CloseAllTargetsExcept(ctx, keep)
+}
+
 // TestConn is a connection to the Tast test extension's background page.
 // cf) crbug.com/1043590
 type TestConn = driver.TestConn
@@ -755,6 +762,172 @@ func (c *Chrome) IsTargetAvailable(ctx context.Context, tm TargetMatcher) (bool,
 	return len(targets) != 0, nil
 }
 
+// AXNode is a node of an accessibility tree as reported by the DevTools protocol.
+type AXNode = driver.AXNode
+
+// GetAXTree returns the accessibility tree of the target identified by id.
+// If rootSelector is not empty, the tree is scoped to the subtree rooted at the
+// first DOM element matching the CSS selector.
+func (c *Chrome) GetAXTree(ctx context.Context, id TargetID, rootSelector string) (*AXNode, error) {
+	return c.sess.GetAXTree(ctx, id, rootSelector)
+}
+
+// RequestInfo describes a network request sent by a page.
+type RequestInfo = driver.RequestInfo
+
+// RequestWaiter waits for a network request sent by a target.
+type RequestWaiter = driver.RequestWaiter
+
+// StartWaitingForRequest starts watching the requests sent by the target
+// identified by id whose URL matches the regular expression urlPattern. It is
+// called before the action that triggers the request, whose info is then
+// returned by RequestWaiter.Wait. RequestWaiter.Close must be called to
+// release the connection to the target.
+func (c *Chrome) StartWaitingForRequest(ctx context.Context, id TargetID, urlPattern string) (*RequestWaiter, error) {
+	return c.sess.StartWaitingForRequest(ctx, id, urlPattern)
+}
+
+// StorageType is the type of a web storage.
+type StorageType = driver.StorageType
+
+// Web storage types.
+const (
+	LocalStorage   = driver.LocalStorage
+	SessionStorage = driver.SessionStorage
+)
+
+// GetStorageItem returns the value of the item key in the web storage of the
+// given type for origin in the target identified by id. The second return value
+// is false if the item does not exist.
+func (c *Chrome) GetStorageItem(ctx context.Context, id TargetID, origin string, storage StorageType, key string) (string, bool, error) {
+	return c.sess.GetStorageItem(ctx, id, origin, storage, key)
+}
+
+// SetStorageItem sets the item key to value in the web storage of the given
+// type for origin in the target identified by id.
+func (c *Chrome) SetStorageItem(ctx context.Context, id TargetID, origin string, storage StorageType, key, value string) error {
+	return c.sess.SetStorageItem(ctx, id, origin, storage, key, value)
+}
+
+// ClearStorage removes all the items in the web storage of the given type for
+// origin in the target identified by id.
+func (c *Chrome) ClearStorage(ctx context.Context, id TargetID, origin string, storage StorageType) error {
+	return c.sess.ClearStorage(ctx, id, origin, storage)
+}
+
+// TouchPoint is a touch point in a touch sequence.
+type TouchPoint = driver.TouchPoint
+
+// TouchPhase is a phase of a touch sequence.
+type TouchPhase = driver.TouchPhase
+
+// Touch sequence phases.
+const (
+	TouchStart = driver.TouchStart
+	TouchMove  = driver.TouchMove
+	TouchEnd   = driver.TouchEnd
+)
+
+// DispatchTouchSequence dispatches a touch sequence, e.g. a multi-finger swipe
+// or a pinch, to the target identified by id. See
+// driver.Session.DispatchTouchSequence for the expected points and phases.
+func (c *Chrome) DispatchTouchSequence(ctx context.Context, id TargetID, points []TouchPoint, phases []TouchPhase) error {
+	return c.sess.DispatchTouchSequence(ctx, id, points, phases)
+}
+
+// CaptureFullPageScreenshot returns a PNG screenshot of the whole scrollable
+// content of the target identified by id, e.g. to verify long pages. See
+// driver.Session.CaptureFullPageScreenshot for its effect on the device metrics
+// override of the target.
+func (c *Chrome) CaptureFullPageScreenshot(ctx context.Context, id TargetID) ([]byte, error) {
+	return c.sess.CaptureFullPageScreenshot(ctx, id)
+}
+
+// ForceGCAndMeasure forces a garbage collection on the target identified by id
+// and returns its used JavaScript heap size in bytes afterwards. It gives
+// memory tests a stable measurement point.
+func (c *Chrome) ForceGCAndMeasure(ctx context.Context, id TargetID) (int64, error) {
+	return c.sess.ForceGCAndMeasure(ctx, id)
+}
+
+// PressureLevel is a memory pressure level of the browser.
+type PressureLevel = driver.PressureLevel
+
+// Memory pressure levels to pass to SimulateMemoryPressure.
+const (
+	PressureNone     = driver.PressureNone
+	PressureModerate = driver.PressureModerate
+	PressureCritical = driver.PressureCritical
+)
+
+// SimulateMemoryPressure makes the browser behave as if the system memory
+// pressure was level, through the target identified by id. The real memory
+// pressure notifications are suppressed until it is called with PressureNone.
+func (c *Chrome) SimulateMemoryPressure(ctx context.Context, id TargetID, level PressureLevel) error {
+	return c.sess.SimulateMemoryPressure(ctx, id, level)
+}
+
+// MemoryPressureLevel returns the memory pressure level last simulated with
+// SimulateMemoryPressure, or PressureNone.
+func (c *Chrome) MemoryPressureLevel() PressureLevel {
+	return c.sess.MemoryPressureLevel()
+}
+
+// WebSocketRecorder records the WebSocket frames of a target.
+type WebSocketRecorder = driver.WebSocketRecorder
+
+// WebSocketFrame is a WebSocket frame recorded by a WebSocketRecorder.
+type WebSocketFrame = driver.WebSocketFrame
+
+// WebSocketDirection is the direction of a WebSocket frame.
+type WebSocketDirection = driver.WebSocketDirection
+
+// WebSocket frame directions.
+const (
+	WebSocketSent     = driver.WebSocketSent
+	WebSocketReceived = driver.WebSocketReceived
+)
+
+// NewWebSocketRecorder returns a WebSocketRecorder for the target identified
+// by id. Recording starts with StartRecording.
+func (c *Chrome) NewWebSocketRecorder(id TargetID) *WebSocketRecorder {
+	return c.sess.NewWebSocketRecorder(id)
+}
+
+// UserAgentMetadata is the user agent client hints to set with
+// SetUserAgentOverride.
+type UserAgentMetadata = driver.UserAgentMetadata
+
+// UserAgentBrand is a brand reported in UserAgentMetadata.
+type UserAgentBrand = driver.UserAgentBrand
+
+// SetUserAgentOverride overrides the User-Agent string of the target
+// identified by id with ua, and its user agent client hints with hints if it
+// is not nil. Calling it with an empty ua clears the override.
+func (c *Chrome) SetUserAgentOverride(ctx context.Context, id TargetID, ua string, hints *UserAgentMetadata) error {
+	return c.sess.SetUserAgentOverride(ctx, id, ua, hints)
+}
+
+// ConsoleRecorder records the JavaScript console messages of a target.
+type ConsoleRecorder = driver.ConsoleRecorder
+
+// ConsoleMessage is a console message recorded by a ConsoleRecorder.
+type ConsoleMessage = driver.ConsoleMessage
+
+// NewConsoleRecorder returns a ConsoleRecorder for the target identified by
+// id. Recording starts with StartRecording.
+func (c *Chrome) NewConsoleRecorder(id TargetID) *ConsoleRecorder {
+	return c.sess.NewConsoleRecorder(id)
+}
+
+// WaitForConsoleMessage waits until the target identified by id logs a
+// console message matching pattern, and returns the text of the first
+// matching message. The messages the target logged before the call are also
+// considered.
+func (c *Chrome) WaitForConsoleMessage(ctx context.Context, id TargetID, pattern *regexp.Regexp) (string, error) {
+	return c.sess.WaitForConsoleMessage(ctx, id, pattern)
+}
+
 // StartTracing starts trace events collection for the selected categories. Android
 // categories must be prefixed with "disabled-by-default-android ", e.g. for the
 // gfx category, use "disabled-by-default-android gfx", including the space.
@@ -779,6 +952,13 @@ func (c *Chrome) StopTracing(ctx context.Context) (*perfetto_proto.Trace, error)
 	return c.sess.StopTracing(ctx)
 }
 
+// TraceAction collects the trace events of the selected categories while
+// running action, and returns them. Tracing is stopped even if starting it or
+// running action fails.
+func (c *Chrome) TraceAction(ctx context.Context, categories []string, action func(ctx context.Context) error, opts ...cdputil.TraceOption) (*perfetto_proto.Trace, error) {
+	return c.sess.TraceAction(ctx, categories, action, opts...)
+}
+
 // SaveTraceToFile marshals the given trace into a binary protobuf and saves it
 // to a gzip archive at the specified path.
 func SaveTraceToFile(ctx context.Context, trace *perfetto_proto.Trace, path string) error {
@@ -7,13 +7,19 @@ package cdputil
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/accessibility"
 	"github.com/mafredri/cdp/protocol/dom"
+	"github.com/mafredri/cdp/protocol/domstorage"
+	"github.com/mafredri/cdp/protocol/emulation"
 	"github.com/mafredri/cdp/protocol/input"
 	"github.com/mafredri/cdp/protocol/media"
+	"github.com/mafredri/cdp/protocol/memory"
+	"github.com/mafredri/cdp/protocol/network"
 	"github.com/mafredri/cdp/protocol/page"
 	"github.com/mafredri/cdp/protocol/profiler"
 	"github.com/mafredri/cdp/protocol/runtime"
@@ -332,6 +338,11 @@ func (c *Conn) DispatchMouseEvent(ctx context.Context, args *input.DispatchMouse
 	return c.cl.Input.DispatchMouseEvent(ctx, args)
 }
 
+// DispatchTouchEvent dispatches a touch event to the page.
+func (c *Conn) DispatchTouchEvent(ctx context.Context, args *input.DispatchTouchEventArgs) error {
+	return c.cl.Input.DispatchTouchEvent(ctx, args)
+}
+
 // StartProfiling starts the profiling for current connection.
 func (c *Conn) StartProfiling(ctx context.Context) error {
 	if err := c.cl.Profiler.Enable(ctx); err != nil {
@@ -383,3 +394,288 @@ func (c *Conn) GetMediaPropertiesChangedObserver(ctx context.Context) (observer
 	}
 	return observer, nil
 }
+
+// GetAXTree returns the accessibility nodes of the page. If rootSelector is
+// empty, the whole tree is returned. Otherwise, only the subtree rooted at the
+// accessibility node backing the first DOM element matching the CSS selector
+// rootSelector is returned; it is queried with Accessibility.queryAXTree so
+// that the nodes outside of it are not transferred. In both cases, the root
+// node comes first.
+func (c *Conn) GetAXTree(ctx context.Context, rootSelector string) ([]accessibility.AXNode, error) {
+	if err := c.cl.Accessibility.Enable(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to enable Accessibility domain")
+	}
+	defer c.cl.Accessibility.Disable(ctx)
+
+	if rootSelector == "" {
+		reply, err := c.cl.Accessibility.GetFullAXTree(ctx, &accessibility.GetFullAXTreeArgs{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get accessibility tree")
+		}
+		if len(reply.Nodes) == 0 {
+			return nil, errors.New("accessibility tree is empty")
+		}
+		return reply.Nodes, nil
+	}
+
+	doc, err := c.cl.DOM.GetDocument(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get document")
+	}
+	qs, err := c.cl.DOM.QuerySelector(ctx, dom.NewQuerySelectorArgs(doc.Root.NodeID, rootSelector))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query selector %q", rootSelector)
+	}
+	if qs.NodeID == 0 {
+		return nil, errors.Errorf("no element matches selector %q", rootSelector)
+	}
+	desc, err := c.cl.DOM.DescribeNode(ctx, dom.NewDescribeNodeArgs().SetNodeID(qs.NodeID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe node for selector %q", rootSelector)
+	}
+	rootBackendID := desc.Node.BackendNodeID
+
+	// Without an accessible name or a role, queryAXTree returns all the nodes
+	// of the subtree of the given DOM node.
+	reply, err := c.cl.Accessibility.QueryAXTree(ctx, accessibility.NewQueryAXTreeArgs().SetNodeID(qs.NodeID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query accessibility tree for selector %q", rootSelector)
+	}
+
+	byID := make(map[accessibility.AXNodeID]accessibility.AXNode, len(reply.Nodes))
+	var root *accessibility.AXNode
+	for i, n := range reply.Nodes {
+		byID[n.NodeID] = n
+		if root == nil && n.BackendDOMNodeID != nil && *n.BackendDOMNodeID == rootBackendID {
+			root = &reply.Nodes[i]
+		}
+	}
+	if root == nil {
+		return nil, errors.Errorf("no accessibility node for selector %q", rootSelector)
+	}
+
+	// Order the subtree breadth-first so the root comes first.
+	subtree := []accessibility.AXNode{*root}
+	for i := 0; i < len(subtree); i++ {
+		for _, id := range subtree[i].ChildIDs {
+			if n, ok := byID[id]; ok {
+				subtree = append(subtree, n)
+			}
+		}
+	}
+	return subtree, nil
+}
+
+// WatchRequests starts watching the network requests sent by the page, and
+// enables the Network domain. The caller must close the returned client and
+// call DisableNetwork when done.
+func (c *Conn) WatchRequests(ctx context.Context) (network.RequestWillBeSentClient, error) {
+	ev, err := c.cl.Network.RequestWillBeSent(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to watch network requests")
+	}
+	if err := c.cl.Network.Enable(ctx, network.NewEnableArgs()); err != nil {
+		ev.Close()
+		return nil, errors.Wrap(err, "failed to enable Network domain")
+	}
+	return ev, nil
+}
+
+// WatchWebSocketFrames starts watching the WebSocket frames sent and received
+// by the page, and enables the Network domain. The caller must close the
+// returned clients and call DisableNetwork when done.
+func (c *Conn) WatchWebSocketFrames(ctx context.Context) (sent network.WebSocketFrameSentClient, received network.WebSocketFrameReceivedClient, retErr error) {
+	sent, err := c.cl.Network.WebSocketFrameSent(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to watch sent WebSocket frames")
+	}
+	defer func() {
+		if retErr != nil {
+			sent.Close()
+		}
+	}()
+	received, err = c.cl.Network.WebSocketFrameReceived(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to watch received WebSocket frames")
+	}
+	if err := c.cl.Network.Enable(ctx, network.NewEnableArgs()); err != nil {
+		received.Close()
+		return nil, nil, errors.Wrap(err, "failed to enable Network domain")
+	}
+	return sent, received, nil
+}
+
+// WatchConsoleMessages starts watching the console API calls of the page. The
+// Runtime domain is re-enabled after the client is created, so that the
+// messages logged before the call are reported first. The caller must close
+// the returned client when done.
+func (c *Conn) WatchConsoleMessages(ctx context.Context) (runtime.ConsoleAPICalledClient, error) {
+	ev, err := c.cl.Runtime.ConsoleAPICalled(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to watch console messages")
+	}
+	if err := c.cl.Runtime.Disable(ctx); err != nil {
+		ev.Close()
+		return nil, errors.Wrap(err, "failed to disable Runtime domain")
+	}
+	if err := c.cl.Runtime.Enable(ctx); err != nil {
+		ev.Close()
+		return nil, errors.Wrap(err, "failed to enable Runtime domain")
+	}
+	return ev, nil
+}
+
+// SetUserAgentOverride enables the Network domain and overrides the
+// User-Agent string and the user agent client hints of the page with ua and
+// metadata. metadata may be nil to leave the client hints derived from ua.
+// The override lasts as long as c is open.
+func (c *Conn) SetUserAgentOverride(ctx context.Context, ua string, metadata *emulation.UserAgentMetadata) error {
+	if err := c.cl.Network.Enable(ctx, network.NewEnableArgs()); err != nil {
+		return errors.Wrap(err, "failed to enable Network domain")
+	}
+	args := network.NewSetUserAgentOverrideArgs(ua)
+	if metadata != nil {
+		args.SetUserAgentMetadata(*metadata)
+	}
+	if err := c.cl.Network.SetUserAgentOverride(ctx, args); err != nil {
+		return errors.Wrap(err, "failed to override user agent")
+	}
+	return nil
+}
+
+// DisableNetwork disables the Network domain.
+func (c *Conn) DisableNetwork(ctx context.Context) error {
+	return c.cl.Network.Disable(ctx)
+}
+
+// domStorageID returns the storage ID for the given origin and storage type.
+func domStorageID(origin string, isLocalStorage bool) domstorage.StorageID {
+	return domstorage.StorageID{SecurityOrigin: origin, IsLocalStorage: isLocalStorage}
+}
+
+// GetDOMStorageItems returns the items of the local or session storage of
+// origin as key-value pairs.
+func (c *Conn) GetDOMStorageItems(ctx context.Context, origin string, isLocalStorage bool) (map[string]string, error) {
+	if err := c.cl.DOMStorage.Enable(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to enable DOMStorage domain")
+	}
+	defer c.cl.DOMStorage.Disable(ctx)
+
+	reply, err := c.cl.DOMStorage.GetDOMStorageItems(ctx, domstorage.NewGetDOMStorageItemsArgs(domStorageID(origin, isLocalStorage)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get storage items of origin %q", origin)
+	}
+	items := make(map[string]string, len(reply.Entries))
+	for _, e := range reply.Entries {
+		if len(e) != 2 {
+			return nil, errors.Errorf("malformed storage item %q", e)
+		}
+		items[e[0]] = e[1]
+	}
+	return items, nil
+}
+
+// SetDOMStorageItem sets the item key to value in the local or session storage
+// of origin.
+func (c *Conn) SetDOMStorageItem(ctx context.Context, origin string, isLocalStorage bool, key, value string) error {
+	if err := c.cl.DOMStorage.Enable(ctx); err != nil {
+		return errors.Wrap(err, "failed to enable DOMStorage domain")
+	}
+	defer c.cl.DOMStorage.Disable(ctx)
+
+	if err := c.cl.DOMStorage.SetDOMStorageItem(ctx, domstorage.NewSetDOMStorageItemArgs(domStorageID(origin, isLocalStorage), key, value)); err != nil {
+		return errors.Wrapf(err, "failed to set storage item %q of origin %q", key, origin)
+	}
+	return nil
+}
+
+// ClearDOMStorage removes all the items of the local or session storage of
+// origin.
+func (c *Conn) ClearDOMStorage(ctx context.Context, origin string, isLocalStorage bool) error {
+	if err := c.cl.DOMStorage.Enable(ctx); err != nil {
+		return errors.Wrap(err, "failed to enable DOMStorage domain")
+	}
+	defer c.cl.DOMStorage.Disable(ctx)
+
+	if err := c.cl.DOMStorage.Clear(ctx, domstorage.NewClearArgs(domStorageID(origin, isLocalStorage))); err != nil {
+		return errors.Wrapf(err, "failed to clear storage of origin %q", origin)
+	}
+	return nil
+}
+
+// CaptureFullPageScreenshot captures a PNG screenshot of the whole content of
+// the page, including the parts outside of the viewport. The device metrics
+// are temporarily overridden to the content size so that the whole page is
+// laid out and rendered, and the override is cleared afterwards. Since the
+// protocol cannot read the current override, any device metrics override set
+// before the call is cleared too rather than restored.
+func (c *Conn) CaptureFullPageScreenshot(ctx context.Context) (data []byte, retErr error) {
+	metrics, err := c.cl.Page.GetLayoutMetrics(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get layout metrics")
+	}
+	width := int(math.Ceil(metrics.ContentSize.Width))
+	height := int(math.Ceil(metrics.ContentSize.Height))
+	if width <= 0 || height <= 0 {
+		return nil, errors.Errorf("invalid content size %dx%d", width, height)
+	}
+
+	if err := c.cl.Emulation.SetDeviceMetricsOverride(ctx, emulation.NewSetDeviceMetricsOverrideArgs(width, height, 1, false)); err != nil {
+		return nil, errors.Wrap(err, "failed to override device metrics")
+	}
+	defer func() {
+		if err := c.cl.Emulation.ClearDeviceMetricsOverride(ctx); err != nil && retErr == nil {
+			retErr = errors.Wrap(err, "failed to restore device metrics")
+		}
+	}()
+
+	clip := page.Viewport{X: 0, Y: 0, Width: float64(width), Height: float64(height), Scale: 1}
+	reply, err := c.cl.Page.CaptureScreenshot(ctx, page.NewCaptureScreenshotArgs().SetFormat("png").SetClip(clip))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to capture screenshot")
+	}
+	return reply.Data, nil
+}
+
+// CollectGarbage forces a garbage collection on the JavaScript heap of the
+// page and returns the used heap size in bytes afterwards.
+func (c *Conn) CollectGarbage(ctx context.Context) (heapBytes int64, retErr error) {
+	if err := c.cl.HeapProfiler.Enable(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to enable HeapProfiler domain")
+	}
+	defer func() {
+		if err := c.cl.HeapProfiler.Disable(ctx); err != nil && retErr == nil {
+			retErr = errors.Wrap(err, "failed to disable HeapProfiler domain")
+		}
+	}()
+	if err := c.cl.HeapProfiler.CollectGarbage(ctx); err != nil {
+		return 0, errors.Wrap(err, "garbage collection is unavailable")
+	}
+	reply, err := c.cl.Runtime.GetHeapUsage(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get heap usage")
+	}
+	return int64(reply.UsedSize), nil
+}
+
+// SimulateMemoryPressure suppresses the real memory pressure notifications in
+// the browser and dispatches a simulated one of level, which is either
+// "moderate" or "critical".
+func (c *Conn) SimulateMemoryPressure(ctx context.Context, level string) error {
+	if err := c.cl.Memory.SetPressureNotificationsSuppressed(ctx, memory.NewSetPressureNotificationsSuppressedArgs(true)); err != nil {
+		return errors.Wrap(err, "failed to suppress memory pressure notifications")
+	}
+	if err := c.cl.Memory.SimulatePressureNotification(ctx, memory.NewSimulatePressureNotificationArgs(memory.PressureLevel(level))); err != nil {
+		return errors.Wrapf(err, "failed to simulate %s memory pressure", level)
+	}
+	return nil
+}
+
+// ResumeMemoryPressureNotifications resumes the real memory pressure
+// notifications in the browser.
+func (c *Conn) ResumeMemoryPressureNotifications(ctx context.Context) error {
+	if err := c.cl.Memory.SetPressureNotificationsSuppressed(ctx, memory.NewSetPressureNotificationsSuppressedArgs(false)); err != nil {
+		return errors.Wrap(err, "failed to resume memory pressure notifications")
+	}
+	return nil
+}
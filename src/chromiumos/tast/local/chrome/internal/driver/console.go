@@ -0,0 +1,159 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package driver
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/runtime"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome/internal/cdputil"
+	"chromiumos/tast/local/chrome/jslog"
+)
+
+// ConsoleMessage is a message logged to the JavaScript console of a page.
+type ConsoleMessage struct {
+	// Type is the type of the console call, e.g. "log" or "error".
+	Type string
+	// Text is the message, with the arguments of the call separated by spaces.
+	Text string
+	// Time is the time the message was logged.
+	Time time.Time
+}
+
+// ConsoleRecorder records the JavaScript console messages of a target.
+type ConsoleRecorder struct {
+	sess *Session
+	id   TargetID
+
+	co   *cdputil.Conn
+	ev   runtime.ConsoleAPICalledClient
+	done chan struct{}
+
+	mu       sync.Mutex
+	messages []ConsoleMessage
+	// updated is closed and replaced when a message is recorded.
+	updated chan struct{}
+}
+
+// NewConsoleRecorder returns a ConsoleRecorder for the target identified by
+// id. Recording starts with StartRecording.
+func (s *Session) NewConsoleRecorder(id TargetID) *ConsoleRecorder {
+	return &ConsoleRecorder{sess: s, id: id, updated: make(chan struct{})}
+}
+
+// StartRecording connects to the target and starts recording the console
+// messages, including the ones the target logged before the call.
+// StopRecording must be called to release the connection.
+func (r *ConsoleRecorder) StartRecording(ctx context.Context) (retErr error) {
+	if r.co != nil {
+		return errors.New("already recording")
+	}
+	co, err := r.sess.devsess.NewConn(ctx, r.id)
+	if err != nil {
+		return r.sess.watcher.ReplaceErr(errors.Wrapf(err, "failed to connect to target %s", r.id))
+	}
+	defer func() {
+		if retErr != nil {
+			co.Close()
+		}
+	}()
+	ev, err := co.WatchConsoleMessages(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.co, r.ev, r.done = co, ev, make(chan struct{})
+	go func() {
+		defer close(r.done)
+		for {
+			reply, err := ev.Recv()
+			if err != nil {
+				return
+			}
+			r.add(ConsoleMessage{
+				Type: reply.Type,
+				Text: jslog.FormatObjects(reply.Args),
+				Time: reply.Timestamp.Time(),
+			})
+		}
+	}()
+	return nil
+}
+
+// add records msg and wakes up the callers of WaitForMessage.
+func (r *ConsoleRecorder) add(msg ConsoleMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+// StopRecording stops recording and closes the connection to the target. The
+// recorded messages are still available with Messages.
+func (r *ConsoleRecorder) StopRecording(ctx context.Context) error {
+	if r.co == nil {
+		return errors.New("not recording")
+	}
+	r.ev.Close()
+	<-r.done
+	err := r.co.Close()
+	r.co, r.ev = nil, nil
+	if err != nil {
+		return errors.Wrap(err, "failed to close connection")
+	}
+	return nil
+}
+
+// Messages returns the messages recorded so far, in the order they were
+// logged.
+func (r *ConsoleRecorder) Messages() []ConsoleMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConsoleMessage(nil), r.messages...)
+}
+
+// WaitForMessage waits until a message matching pattern is recorded, and
+// returns the text of the first matching message. The messages recorded before
+// the call are also considered. It fails when ctx is done.
+func (r *ConsoleRecorder) WaitForMessage(ctx context.Context, pattern *regexp.Regexp) (string, error) {
+	checked := 0
+	for {
+		r.mu.Lock()
+		msgs := r.messages[checked:]
+		updated := r.updated
+		r.mu.Unlock()
+		for _, m := range msgs {
+			if pattern.MatchString(m.Text) {
+				return m.Text, nil
+			}
+		}
+		checked += len(msgs)
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return "", errors.Wrapf(ctx.Err(), "no console message matching %q in %d messages", pattern, checked)
+		}
+	}
+}
+
+// WaitForConsoleMessage waits until the target identified by id logs a
+// console message matching pattern, and returns the text of the first
+// matching message. The messages the target logged before the call are also
+// considered. It fails when ctx is done.
+func (s *Session) WaitForConsoleMessage(ctx context.Context, id TargetID, pattern *regexp.Regexp) (string, error) {
+	r := s.NewConsoleRecorder(id)
+	if err := r.StartRecording(ctx); err != nil {
+		return "", err
+	}
+	defer r.StopRecording(ctx)
+	return r.WaitForMessage(ctx, pattern)
+}
@@ -9,10 +9,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"android.googlesource.com/platform/external/perfetto/protos/perfetto/trace/github.com/google/perfetto/perfetto_proto"
 	"github.com/mafredri/cdp/protocol/target"
 
+	"chromiumos/tast/ctxutil"
 	"chromiumos/tast/errors"
 	"chromiumos/tast/local/chrome/internal/browserwatcher"
 	"chromiumos/tast/local/chrome/internal/cdputil"
@@ -44,6 +47,16 @@ type Session struct {
 	testExtConn    *Conn // connection to test extension exposing APIs
 	signinExtConn  *Conn // connection to signin profile test extension
 	tracingStarted bool
+	// pressureMu guards pressureLevel, the last memory pressure level
+	// simulated, as SimulateMemoryPressure and MemoryPressureLevel may be
+	// called from different goroutines.
+	pressureMu    sync.Mutex
+	pressureLevel PressureLevel
+	// uaOverrideMu guards uaOverrideConns, the connections which keep the
+	// User-Agent overrides set with SetUserAgentOverride, keyed by target, as
+	// SetUserAgentOverride may be called from different goroutines.
+	uaOverrideMu    sync.Mutex
+	uaOverrideConns map[TargetID]*cdputil.Conn
 }
 
 // NewSession connects to a local Chrome process and creates a new Session.
@@ -84,6 +97,12 @@ func (s *Session) Close(ctx context.Context) {
 		s.signinExtConn.locked = false
 		s.signinExtConn.Close()
 	}
+	s.uaOverrideMu.Lock()
+	for _, co := range s.uaOverrideConns {
+		co.Close()
+	}
+	s.uaOverrideConns = nil
+	s.uaOverrideMu.Unlock()
 	s.devsess.Close(ctx)
 }
 
@@ -191,6 +210,36 @@ func (s *Session) CloseTarget(ctx context.Context, id TargetID) error {
 	return s.devsess.CloseTarget(ctx, id)
 }
 
+// CloseAllTargetsExcept closes all page targets (e.g. tabs) except the one
+// identified by keep, and waits for each of them to be closed. Other targets
+// such as workers and extension background pages are left open. An error is
+// returned without closing anything if keep is not an open page.
+func (s *Session) CloseAllTargetsExcept(ctx context.Context, keep TargetID) error {
+	pages, err := s.devsess.FindTargets(ctx, MatchAllPages())
+	if err != nil {
+		return s.watcher.ReplaceErr(errors.Wrap(err, "failed to get page targets"))
+	}
+	found := false
+	for _, t := range pages {
+		if t.TargetID == keep {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("page target %s not found", keep)
+	}
+	for _, t := range pages {
+		if t.TargetID == keep {
+			continue
+		}
+		if err := s.devsess.CloseTarget(ctx, t.TargetID); err != nil {
+			return s.watcher.ReplaceErr(errors.Wrapf(err, "failed to close target %s (%s)", t.TargetID, t.URL))
+		}
+	}
+	return nil
+}
+
 // TestAPIConn returns a shared connection to the test API extension's
 // background page (which can be used to access various APIs). The connection is
 // lazily created, and this function will block until the extension is loaded or
@@ -248,6 +297,9 @@ func (s *Session) testAPIConnFor(ctx context.Context, extConn **Conn, extID stri
 // Sometimes, the request to start tracing reaches the browser process, but there
 // is a timeout while waiting for the reply.
 func (s *Session) StartTracing(ctx context.Context, categories []string, opts ...cdputil.TraceOption) error {
+	if err := validateTraceCategories(categories); err != nil {
+		return err
+	}
 	// Note: even when StartTracing fails, it might be due to the case that the
 	// StartTracing request is successfully sent to the browser and tracing
 	// collection has started, but the context deadline is exceeded before Tast
@@ -256,6 +308,21 @@ func (s *Session) StartTracing(ctx context.Context, categories []string, opts ..
 	return s.devsess.StartTracing(ctx, categories, opts...)
 }
 
+// validateTraceCategories checks that categories are valid trace categories.
+// In particular, it catches comma-separated lists passed as a single category,
+// which Chrome silently ignores.
+func validateTraceCategories(categories []string) error {
+	for _, c := range categories {
+		if c == "" || strings.TrimSpace(c) != c {
+			return errors.Errorf("invalid trace category %q", c)
+		}
+		if strings.Contains(c, ",") {
+			return errors.Errorf("invalid trace category %q: pass categories as separate elements", c)
+		}
+	}
+	return nil
+}
+
 // StartSystemTracing starts trace events collection from the system tracing
 // service using the marshaled binary protobuf trace config.
 // Note: StopTracing should be called even if StartSystemTracing returns an error.
@@ -280,6 +347,40 @@ func (s *Session) StopTracing(ctx context.Context) (*perfetto_proto.Trace, error
 	return traces, nil
 }
 
+// traceStopTime is the time reserved by TraceAction to stop tracing after the
+// action.
+const traceStopTime = 10 * time.Second
+
+// TraceAction collects the trace events of the selected categories while
+// running action, and returns them. Tracing is stopped even if starting it or
+// running action fails, in which case the error is returned along with no
+// trace.
+func (s *Session) TraceAction(ctx context.Context, categories []string, action func(ctx context.Context) error, opts ...cdputil.TraceOption) (_ *perfetto_proto.Trace, retErr error) {
+	cleanupCtx := ctx
+	ctx, cancel := ctxutil.Shorten(ctx, traceStopTime)
+	defer cancel()
+
+	// As noted in StartTracing, tracing may have started even if StartTracing
+	// fails, so it is stopped on any error.
+	stopped := false
+	defer func() {
+		if retErr == nil || stopped {
+			return
+		}
+		if _, err := s.StopTracing(cleanupCtx); err != nil {
+			testing.ContextLog(cleanupCtx, "Failed to stop tracing: ", err)
+		}
+	}()
+	if err := s.StartTracing(ctx, categories, opts...); err != nil {
+		return nil, err
+	}
+	if err := action(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to run the traced action")
+	}
+	stopped = true
+	return s.StopTracing(cleanupCtx)
+}
+
 // TracingStarted returns whether tracing has started.
 func (s *Session) TracingStarted() bool {
 	return s.tracingStarted
@@ -0,0 +1,437 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+
+	"github.com/mafredri/cdp/protocol/accessibility"
+	"github.com/mafredri/cdp/protocol/input"
+	"github.com/mafredri/cdp/protocol/network"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome/internal/cdputil"
+)
+
+// withTargetConn opens a temporary DevTools connection to the target
+// identified by id and calls f with it. The connection is closed on return.
+func (s *Session) withTargetConn(ctx context.Context, id TargetID, f func(co *cdputil.Conn) error) error {
+	co, err := s.devsess.NewConn(ctx, id)
+	if err != nil {
+		return s.watcher.ReplaceErr(errors.Wrapf(err, "failed to connect to target %s", id))
+	}
+	defer co.Close()
+	return f(co)
+}
+
+// AXNode is a node of an accessibility tree as reported by the DevTools
+// protocol.
+type AXNode struct {
+	Role     string
+	Name     string
+	Ignored  bool
+	Children []*AXNode
+}
+
+// GetAXTree returns the accessibility tree of the target identified by id.
+// If rootSelector is not empty, the tree is scoped to the subtree rooted at the
+// first DOM element matching the CSS selector. This is much lighter than the
+// uiauto tree and is suitable for inspecting the role/name of page contents.
+func (s *Session) GetAXTree(ctx context.Context, id TargetID, rootSelector string) (*AXNode, error) {
+	var nodes []accessibility.AXNode
+	if err := s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		var err error
+		nodes, err = co.GetAXTree(ctx, rootSelector)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[accessibility.AXNodeID]*accessibility.AXNode, len(nodes))
+	for i := range nodes {
+		byID[nodes[i].NodeID] = &nodes[i]
+	}
+	var build func(n *accessibility.AXNode) *AXNode
+	build = func(n *accessibility.AXNode) *AXNode {
+		node := &AXNode{
+			Role:    axValueString(n.Role),
+			Name:    axValueString(n.Name),
+			Ignored: n.Ignored,
+		}
+		for _, cid := range n.ChildIDs {
+			if c, ok := byID[cid]; ok {
+				node.Children = append(node.Children, build(c))
+			}
+		}
+		return node
+	}
+	return build(&nodes[0]), nil
+}
+
+// axValueString returns the string representation of v, or an empty string if
+// v is nil.
+func axValueString(v *accessibility.AXValue) string {
+	if v == nil || len(v.Value) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(v.Value, &s); err != nil {
+		return string(v.Value)
+	}
+	return s
+}
+
+// RequestInfo describes a network request sent by a page.
+type RequestInfo struct {
+	URL      string
+	Method   string
+	Headers  map[string]string
+	PostData string
+}
+
+// RequestWaiter waits for a network request sent by a target. It is started
+// before the action that triggers the request, so that the request cannot be
+// sent before it is watched:
+//
+//	w, err := sess.StartWaitingForRequest(ctx, id, `/api/report$`)
+//	if err != nil { ... }
+//	defer w.Close(ctx)
+//	// Trigger the request.
+//	req, err := w.Wait(ctx)
+type RequestWaiter struct {
+	re *regexp.Regexp
+	co *cdputil.Conn
+	ev network.RequestWillBeSentClient
+}
+
+// StartWaitingForRequest connects to the target identified by id and starts
+// watching the requests it sends whose URL matches the regular expression
+// urlPattern. Close must be called to release the connection.
+func (s *Session) StartWaitingForRequest(ctx context.Context, id TargetID, urlPattern string) (w *RequestWaiter, retErr error) {
+	re, err := regexp.Compile(urlPattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid URL pattern %q", urlPattern)
+	}
+	co, err := s.devsess.NewConn(ctx, id)
+	if err != nil {
+		return nil, s.watcher.ReplaceErr(errors.Wrapf(err, "failed to connect to target %s", id))
+	}
+	defer func() {
+		if retErr != nil {
+			co.Close()
+		}
+	}()
+	ev, err := co.WatchRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestWaiter{re: re, co: co, ev: ev}, nil
+}
+
+// Wait waits until the target sends a request matching the URL pattern, and
+// returns it. The requests sent since StartWaitingForRequest are considered,
+// including the ones sent before the call. Each call returns the next matching
+// request. It returns an error if ctx expires before a matching request is
+// seen.
+func (w *RequestWaiter) Wait(ctx context.Context) (*RequestInfo, error) {
+	if w.co == nil {
+		return nil, errors.New("waiter is closed")
+	}
+	for {
+		select {
+		case <-w.ev.Ready():
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "no request matching %q", w.re)
+		}
+		reply, err := w.ev.Recv()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to wait for a request matching %q", w.re)
+		}
+		if w.re.MatchString(reply.Request.URL) {
+			return newRequestInfo(&reply.Request)
+		}
+	}
+}
+
+// Close stops watching the requests and closes the connection to the target.
+func (w *RequestWaiter) Close(ctx context.Context) error {
+	if w.co == nil {
+		return nil
+	}
+	w.ev.Close()
+	var firstErr error
+	if err := w.co.DisableNetwork(ctx); err != nil {
+		firstErr = errors.Wrap(err, "failed to disable Network domain")
+	}
+	if err := w.co.Close(); err != nil && firstErr == nil {
+		firstErr = errors.Wrap(err, "failed to close connection")
+	}
+	w.co, w.ev = nil, nil
+	return firstErr
+}
+
+// newRequestInfo converts req to a RequestInfo.
+func newRequestInfo(req *network.Request) (*RequestInfo, error) {
+	info := &RequestInfo{
+		URL:     req.URL,
+		Method:  req.Method,
+		Headers: make(map[string]string),
+	}
+	if len(req.Headers) > 0 {
+		if err := json.Unmarshal(req.Headers, &info.Headers); err != nil {
+			return nil, errors.Wrap(err, "failed to parse request headers")
+		}
+	}
+	if req.PostData != nil {
+		info.PostData = *req.PostData
+	}
+	return info, nil
+}
+
+// StorageType is the type of a web storage.
+type StorageType int
+
+const (
+	// LocalStorage is the storage exposed as window.localStorage.
+	LocalStorage StorageType = iota
+	// SessionStorage is the storage exposed as window.sessionStorage.
+	SessionStorage
+)
+
+// checkOrigin returns an error if origin is not a serialized origin such as
+// "https://www.example.com".
+func checkOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return errors.Wrapf(err, "invalid origin %q", origin)
+	}
+	if u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return errors.Errorf("invalid origin %q", origin)
+	}
+	return nil
+}
+
+// GetStorageItem returns the value of the item key in the web storage of the
+// given type for origin in the target identified by id. The second return value
+// is false if the item does not exist. An error is returned if the target has
+// no frame with the origin.
+func (s *Session) GetStorageItem(ctx context.Context, id TargetID, origin string, storage StorageType, key string) (string, bool, error) {
+	if err := checkOrigin(origin); err != nil {
+		return "", false, err
+	}
+	var items map[string]string
+	if err := s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		var err error
+		items, err = co.GetDOMStorageItems(ctx, origin, storage == LocalStorage)
+		return err
+	}); err != nil {
+		return "", false, err
+	}
+	value, ok := items[key]
+	return value, ok, nil
+}
+
+// SetStorageItem sets the item key to value in the web storage of the given
+// type for origin in the target identified by id. An error is returned if the
+// target has no frame with the origin.
+func (s *Session) SetStorageItem(ctx context.Context, id TargetID, origin string, storage StorageType, key, value string) error {
+	if err := checkOrigin(origin); err != nil {
+		return err
+	}
+	return s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		return co.SetDOMStorageItem(ctx, origin, storage == LocalStorage, key, value)
+	})
+}
+
+// ClearStorage removes all the items in the web storage of the given type for
+// origin in the target identified by id. An error is returned if the target
+// has no frame with the origin.
+func (s *Session) ClearStorage(ctx context.Context, id TargetID, origin string, storage StorageType) error {
+	if err := checkOrigin(origin); err != nil {
+		return err
+	}
+	return s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		return co.ClearDOMStorage(ctx, origin, storage == LocalStorage)
+	})
+}
+
+// TouchPoint is a touch point in a touch sequence, in CSS pixels relative to
+// the viewport of the target.
+type TouchPoint struct {
+	// ID identifies the touch point across the phases of a sequence.
+	ID int
+	X  float64
+	Y  float64
+}
+
+// TouchPhase is a phase of a touch sequence.
+type TouchPhase string
+
+// Touch sequence phases.
+const (
+	// TouchStart puts the touch points down.
+	TouchStart TouchPhase = "touchStart"
+	// TouchMove moves the touch points.
+	TouchMove TouchPhase = "touchMove"
+	// TouchEnd lifts the touch points.
+	TouchEnd TouchPhase = "touchEnd"
+)
+
+// checkTouchSequence checks that phases is a TouchStart, followed by any
+// number of TouchMove, and a TouchEnd, and that points contains the same touch
+// points for each phase. It returns the number of touch points per phase.
+func checkTouchSequence(points []TouchPoint, phases []TouchPhase) (int, error) {
+	if len(phases) < 2 {
+		return 0, errors.Errorf("touch sequence needs at least a start and an end phase, got %d phases", len(phases))
+	}
+	for i, phase := range phases {
+		want := TouchMove
+		switch i {
+		case 0:
+			want = TouchStart
+		case len(phases) - 1:
+			want = TouchEnd
+		}
+		if phase != want {
+			return 0, errors.Errorf("unexpected phase %d: got %q, want %q", i, phase, want)
+		}
+	}
+	if len(points) == 0 || len(points)%len(phases) != 0 {
+		return 0, errors.Errorf("%d touch points cannot be split evenly across %d phases", len(points), len(phases))
+	}
+	n := len(points) / len(phases)
+	ids := make(map[int]bool, n)
+	for _, p := range points[:n] {
+		if ids[p.ID] {
+			return 0, errors.Errorf("duplicate touch point ID %d", p.ID)
+		}
+		ids[p.ID] = true
+	}
+	for i := 1; i < len(phases); i++ {
+		seen := make(map[int]bool, n)
+		for _, p := range points[i*n : (i+1)*n] {
+			if !ids[p.ID] || seen[p.ID] {
+				return 0, errors.Errorf("touch points of phase %d do not match the ones of the start phase", i)
+			}
+			seen[p.ID] = true
+		}
+	}
+	return n, nil
+}
+
+// DispatchTouchSequence dispatches a touch sequence to the target identified
+// by id. phases must be a TouchStart, followed by any number of TouchMove
+// (e.g. the steps of a swipe or pinch), and a TouchEnd. points holds the touch
+// points of each phase in order, with the same number of points and the same
+// IDs for each phase. The positions of the points of the TouchEnd phase are
+// ignored.
+func (s *Session) DispatchTouchSequence(ctx context.Context, id TargetID, points []TouchPoint, phases []TouchPhase) error {
+	n, err := checkTouchSequence(points, phases)
+	if err != nil {
+		return errors.Wrap(err, "invalid touch sequence")
+	}
+	return s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		for i, phase := range phases {
+			// The end phase must not contain any touch points, but touchPoints
+			// is required, so it is sent as an empty array rather than null.
+			tps := []input.TouchPoint{}
+			if phase != TouchEnd {
+				for _, p := range points[i*n : (i+1)*n] {
+					pid := float64(p.ID)
+					tps = append(tps, input.TouchPoint{X: p.X, Y: p.Y, ID: &pid})
+				}
+			}
+			if err := co.DispatchTouchEvent(ctx, input.NewDispatchTouchEventArgs(string(phase), tps)); err != nil {
+				return errors.Wrapf(err, "failed to dispatch %s event", phase)
+			}
+		}
+		return nil
+	})
+}
+
+// CaptureFullPageScreenshot returns a PNG screenshot of the whole scrollable
+// content of the target identified by id, not only the part in the viewport.
+// The DevTools protocol cannot read the device metrics override of a target,
+// so the override used to lay out the whole page is reset, not restored: once
+// it returns, the target is laid out with the real window size, even if a
+// device metrics override was set before the call. Tests emulating a device
+// must set their override again after the call.
+func (s *Session) CaptureFullPageScreenshot(ctx context.Context, id TargetID) ([]byte, error) {
+	var data []byte
+	if err := s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		var err error
+		data, err = co.CaptureFullPageScreenshot(ctx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ForceGCAndMeasure forces a garbage collection on the target identified by id
+// and returns its used JavaScript heap size in bytes after the collection.
+func (s *Session) ForceGCAndMeasure(ctx context.Context, id TargetID) (int64, error) {
+	var heapBytes int64
+	if err := s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		var err error
+		heapBytes, err = co.CollectGarbage(ctx)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return heapBytes, nil
+}
+
+// PressureLevel is a memory pressure level of the browser.
+type PressureLevel string
+
+// Memory pressure levels.
+const (
+	// PressureNone means that no memory pressure is simulated, and the real
+	// memory pressure notifications are delivered.
+	PressureNone     PressureLevel = ""
+	PressureModerate PressureLevel = "moderate"
+	PressureCritical PressureLevel = "critical"
+)
+
+// SimulateMemoryPressure makes the browser behave as if the system memory
+// pressure was level, through the target identified by id. The real memory
+// pressure notifications are suppressed until it is called with PressureNone.
+func (s *Session) SimulateMemoryPressure(ctx context.Context, id TargetID, level PressureLevel) error {
+	switch level {
+	case PressureNone, PressureModerate, PressureCritical:
+	default:
+		return errors.Errorf("invalid memory pressure level %q", level)
+	}
+	// The lock is held during the DevTools calls too, so that the recorded
+	// level is the one of the last notification dispatched.
+	s.pressureMu.Lock()
+	defer s.pressureMu.Unlock()
+	if err := s.withTargetConn(ctx, id, func(co *cdputil.Conn) error {
+		if level == PressureNone {
+			return co.ResumeMemoryPressureNotifications(ctx)
+		}
+		return co.SimulateMemoryPressure(ctx, string(level))
+	}); err != nil {
+		return err
+	}
+	s.pressureLevel = level
+	return nil
+}
+
+// MemoryPressureLevel returns the memory pressure level last set with
+// SimulateMemoryPressure. The DevTools protocol does not expose the real
+// memory pressure level, so it cannot be queried on demand; the level recorded
+// under a lock by SimulateMemoryPressure is returned instead, which is
+// PressureNone unless a level is simulated. It is safe to call concurrently
+// with SimulateMemoryPressure.
+func (s *Session) MemoryPressureLevel() PressureLevel {
+	s.pressureMu.Lock()
+	defer s.pressureMu.Unlock()
+	return s.pressureLevel
+}
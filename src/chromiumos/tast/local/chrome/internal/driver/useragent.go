@@ -0,0 +1,92 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package driver
+
+import (
+	"context"
+
+	"github.com/mafredri/cdp/protocol/emulation"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome/internal/cdputil"
+)
+
+// UserAgentBrand is a brand and its version reported in the user agent client
+// hints, e.g. "Chromium" and "108".
+type UserAgentBrand struct {
+	Brand   string
+	Version string
+}
+
+// UserAgentMetadata is the user agent client hints reported by a page, i.e.
+// the navigator.userAgentData values and the Sec-CH-UA-* request headers.
+type UserAgentMetadata struct {
+	Brands          []UserAgentBrand
+	FullVersion     string
+	Platform        string
+	PlatformVersion string
+	Architecture    string
+	Model           string
+	Mobile          bool
+}
+
+// protocol converts m to the DevTools protocol type.
+func (m *UserAgentMetadata) protocol() *emulation.UserAgentMetadata {
+	md := &emulation.UserAgentMetadata{
+		Platform:        m.Platform,
+		PlatformVersion: m.PlatformVersion,
+		Architecture:    m.Architecture,
+		Model:           m.Model,
+		Mobile:          m.Mobile,
+	}
+	for _, b := range m.Brands {
+		md.Brands = append(md.Brands, emulation.UserAgentBrandVersion{Brand: b.Brand, Version: b.Version})
+	}
+	if m.FullVersion != "" {
+		md.FullVersion = &m.FullVersion
+	}
+	return md
+}
+
+// SetUserAgentOverride overrides the User-Agent string of the target
+// identified by id with ua, and its user agent client hints with hints if it
+// is not nil. The override applies to the requests and to navigator of the
+// target until it is cleared by calling this with an empty ua, or until the
+// session is closed. A connection to the target is kept open meanwhile, since
+// the override is tied to it.
+func (s *Session) SetUserAgentOverride(ctx context.Context, id TargetID, ua string, hints *UserAgentMetadata) error {
+	if ua == "" && hints != nil {
+		return errors.New("client hints cannot be set without a User-Agent string")
+	}
+	// The lock is held until the new connection is stored, so that concurrent
+	// overrides of the same target do not leak connections.
+	s.uaOverrideMu.Lock()
+	defer s.uaOverrideMu.Unlock()
+	if co, ok := s.uaOverrideConns[id]; ok {
+		co.Close()
+		delete(s.uaOverrideConns, id)
+	}
+	if ua == "" {
+		return nil
+	}
+
+	co, err := s.devsess.NewConn(ctx, id)
+	if err != nil {
+		return s.watcher.ReplaceErr(errors.Wrapf(err, "failed to connect to target %s", id))
+	}
+	var md *emulation.UserAgentMetadata
+	if hints != nil {
+		md = hints.protocol()
+	}
+	if err := co.SetUserAgentOverride(ctx, ua, md); err != nil {
+		co.Close()
+		return err
+	}
+	if s.uaOverrideConns == nil {
+		s.uaOverrideConns = make(map[TargetID]*cdputil.Conn)
+	}
+	s.uaOverrideConns[id] = co
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome/internal/cdputil"
+)
+
+// WebSocketDirection is the direction of a WebSocket frame.
+type WebSocketDirection int
+
+const (
+	// WebSocketSent is the direction of the frames sent by the page.
+	WebSocketSent WebSocketDirection = iota
+	// WebSocketReceived is the direction of the frames received by the page.
+	WebSocketReceived
+)
+
+// String returns a human-readable name of d.
+func (d WebSocketDirection) String() string {
+	if d == WebSocketSent {
+		return "sent"
+	}
+	return "received"
+}
+
+// WebSocketFrame is a WebSocket frame sent or received by a page.
+type WebSocketFrame struct {
+	Direction WebSocketDirection
+	// RequestID identifies the WebSocket connection of the frame.
+	RequestID string
+	// Opcode is the WebSocket opcode of the frame, e.g. 1 for text frames.
+	Opcode int
+	// Payload is the payload of the frame. Binary payloads are base64-encoded.
+	Payload string
+	// Time is the time the frame was recorded.
+	Time time.Time
+}
+
+// WebSocketRecorder records the WebSocket frames sent and received by a
+// target.
+type WebSocketRecorder struct {
+	sess *Session
+	id   TargetID
+
+	co       *cdputil.Conn
+	sent     network.WebSocketFrameSentClient
+	received network.WebSocketFrameReceivedClient
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	frames []WebSocketFrame
+}
+
+// NewWebSocketRecorder returns a WebSocketRecorder for the target identified
+// by id. Recording starts with StartRecording.
+func (s *Session) NewWebSocketRecorder(id TargetID) *WebSocketRecorder {
+	return &WebSocketRecorder{sess: s, id: id}
+}
+
+// StartRecording connects to the target and starts recording the WebSocket
+// frames. StopRecording must be called to release the connection.
+func (r *WebSocketRecorder) StartRecording(ctx context.Context) (retErr error) {
+	if r.co != nil {
+		return errors.New("already recording")
+	}
+	co, err := r.sess.devsess.NewConn(ctx, r.id)
+	if err != nil {
+		return r.sess.watcher.ReplaceErr(errors.Wrapf(err, "failed to connect to target %s", r.id))
+	}
+	defer func() {
+		if retErr != nil {
+			co.Close()
+		}
+	}()
+	sent, received, err := co.WatchWebSocketFrames(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.co, r.sent, r.received = co, sent, received
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		for {
+			ev, err := sent.Recv()
+			if err != nil {
+				return
+			}
+			r.add(WebSocketSent, ev.RequestID, ev.Response)
+		}
+	}()
+	go func() {
+		defer r.wg.Done()
+		for {
+			ev, err := received.Recv()
+			if err != nil {
+				return
+			}
+			r.add(WebSocketReceived, ev.RequestID, ev.Response)
+		}
+	}()
+	return nil
+}
+
+// add records a frame.
+func (r *WebSocketRecorder) add(dir WebSocketDirection, id network.RequestID, f network.WebSocketFrame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, WebSocketFrame{
+		Direction: dir,
+		RequestID: string(id),
+		Opcode:    int(f.Opcode),
+		Payload:   f.PayloadData,
+		Time:      time.Now(),
+	})
+}
+
+// StopRecording stops recording and closes the connection to the target. The
+// recorded frames are still available with Frames.
+func (r *WebSocketRecorder) StopRecording(ctx context.Context) error {
+	if r.co == nil {
+		return errors.New("not recording")
+	}
+	r.sent.Close()
+	r.received.Close()
+	r.wg.Wait()
+	var firstErr error
+	if err := r.co.DisableNetwork(ctx); err != nil {
+		firstErr = errors.Wrap(err, "failed to disable Network domain")
+	}
+	if err := r.co.Close(); err != nil && firstErr == nil {
+		firstErr = errors.Wrap(err, "failed to close connection")
+	}
+	r.co, r.sent, r.received = nil, nil, nil
+	return firstErr
+}
+
+// Frames returns the frames recorded so far, in the order they were recorded.
+// Frames in different directions which are close in time may be out of order.
+func (r *WebSocketRecorder) Frames() []WebSocketFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WebSocketFrame(nil), r.frames...)
+}
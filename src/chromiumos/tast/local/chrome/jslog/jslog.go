@@ -176,7 +176,7 @@ func (w *Worker) run() {
 		if r.Type == "error" {
 			stack = r.StackTrace
 		}
-		w.Report(r.Timestamp.Time(), r.Type, formatObjects(r.Args), stack)
+		w.Report(r.Timestamp.Time(), r.Type, FormatObjects(r.Args), stack)
 	}
 
 	close(w.doneCh)
@@ -194,8 +194,8 @@ func (w *Worker) Report(ts time.Time, typ, msg string, stack *runtime.StackTrace
 	}
 }
 
-// formatObjects serializes a list of RemoteObject to a string.
-func formatObjects(objs []runtime.RemoteObject) string {
+// FormatObjects serializes a list of RemoteObject to a string.
+func FormatObjects(objs []runtime.RemoteObject) string {
 	var parts []string
 	for _, obj := range objs {
 		parts = append(parts, formatObject(obj))
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,7 +24,9 @@ import (
 	"chromiumos/tast/local/chrome/uiauto/filepicker/vars"
 	"chromiumos/tast/local/chrome/uiauto/mouse"
 	"chromiumos/tast/local/chrome/uiauto/nodewith"
+	"chromiumos/tast/local/chrome/uiauto/restriction"
 	"chromiumos/tast/local/chrome/uiauto/role"
+	"chromiumos/tast/local/clipboard"
 	"chromiumos/tast/local/coords"
 	"chromiumos/tast/local/input"
 	"chromiumos/tast/testing"
@@ -34,30 +37,33 @@ const FilesTitlePrefix = "Files - "
 
 // Context menu items for a file, values are the a11y name.
 const (
-	Open         = "Open"
-	OpenWith     = "Open with…"
-	Cut          = "Cut Ctrl+X"
-	Copy         = "Copy Ctrl+C"
-	Paste        = "Paste Ctrl+V"
-	GetInfo      = "Get info Space" // Space is the key shortcut.
-	Rename       = "Rename Ctrl+Enter"
-	Delete       = "Delete Alt+Backspace"
-	ZipSelection = "Zip select"
-	NewFolder    = "New folder Ctrl+E"
-	Share        = "Share"
+	Open           = "Open"
+	OpenWith       = "Open with…"
+	Cut            = "Cut Ctrl+X"
+	Copy           = "Copy Ctrl+C"
+	Paste          = "Paste Ctrl+V"
+	GetInfo        = "Get info Space" // Space is the key shortcut.
+	Rename         = "Rename Ctrl+Enter"
+	Delete         = "Delete Alt+Backspace"
+	ZipSelection   = "Zip select"
+	NewFolder      = "New folder Ctrl+E"
+	Share          = "Share"
+	ShareWithLinux = "Share with Linux" // Only shown if Crostini is enabled.
 )
 
 // Directory names.
 const (
-	Downloads   = "Downloads"
-	GoogleDrive = "Google Drive"
-	MyDrive     = "My Drive"
-	MyFiles     = "My files"
-	Playfiles   = "Play files"
-	Recent      = "Recent"
-	Images      = "Images"
-	Trash       = "Trash"
-	USBDrive    = "USB Drive"
+	Downloads    = "Downloads"
+	GoogleDrive  = "Google Drive"
+	MyDrive      = "My Drive"
+	MyFiles      = "My files"
+	SharedWithMe = "Shared with me"
+	Playfiles    = "Play files"
+	Recent       = "Recent"
+	Images       = "Images"
+	Trash        = "Trash"
+	USBDrive     = "USB Drive"
+	LinuxFiles   = "Linux files"
 )
 
 // FilesApp represents an instance of the Files App.
@@ -100,6 +106,23 @@ func Launch(ctx context.Context, tconn *chrome.TestConn) (*FilesApp, error) {
 	return App(ctx, tconn, apps.FilesSWA.ID)
 }
 
+// LaunchAndMeasure launches the Files app SWA variant like Launch, and returns
+// it along with the time elapsed from the launch request until the file list
+// is shown and the navigation tree is ready for interaction.
+func LaunchAndMeasure(ctx context.Context, tconn *chrome.TestConn) (*FilesApp, time.Duration, error) {
+	// time.Now includes a monotonic clock reading, which time.Since uses.
+	start := time.Now()
+	f, err := Launch(ctx, tconn)
+	if err != nil {
+		return nil, 0, err
+	}
+	fileList := nodewith.Role(role.ListBox).Ancestor(WindowFinder(f.appID))
+	if err := f.ui.WithTimeout(time.Minute).WaitUntilExists(fileList)(ctx); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to wait for the file list")
+	}
+	return f, time.Since(start), nil
+}
+
 // LaunchSWAToPath launches the Files app directly to the supplied path.
 // This avoids navigating the Files app when you want to just access the folder directly.
 func LaunchSWAToPath(ctx context.Context, tconn *chrome.TestConn, path string) (*FilesApp, error) {
@@ -177,6 +200,14 @@ func (f *FilesApp) Close(ctx context.Context) error {
 // An error is returned if dir is not found or does not open.
 func (f *FilesApp) OpenDir(dirName, expectedTitle string) uiauto.Action {
 	dir := nodewith.Name(dirName).Role(role.TreeItem)
+	return uiauto.Combine("OpenDir",
+		f.LeftClick(nodewith.Name(dirName).Role(role.StaticText).Ancestor(dir)),
+		f.WaitUntilExists(f.title(expectedTitle)),
+	)
+}
+
+// title returns a finder for the title shown when the directory is opened.
+func (f *FilesApp) title(expectedTitle string) *nodewith.Finder {
 	roleType := role.RootWebArea
 	if f.appID == apps.FilesSWA.ID {
 		roleType = role.Window
@@ -185,10 +216,7 @@ func (f *FilesApp) OpenDir(dirName, expectedTitle string) uiauto.Action {
 		// For the picker, we check that the button in the header exists.
 		roleType = role.Button
 	}
-	return uiauto.Combine("OpenDir",
-		f.LeftClick(nodewith.Name(dirName).Role(role.StaticText).Ancestor(dir)),
-		f.WaitUntilExists(nodewith.Name(expectedTitle).Role(roleType).First()),
-	)
+	return nodewith.Name(expectedTitle).Role(roleType).First()
 }
 
 // FormatDevice returns a function that formats USB drive with the default options.
@@ -218,10 +246,85 @@ func (f *FilesApp) OpenDrive() uiauto.Action {
 	return f.OpenDir(GoogleDrive, FilesTitlePrefix+MyDrive)
 }
 
+// sectionEnsureGoneDuration is how long a file is checked to be absent from
+// the Drive section it should not be in.
+const sectionEnsureGoneDuration = 3 * time.Second
+
+// OpenSharedWithMe returns a function that opens the "Shared with me" section
+// of Google Drive in the Files App. An error is returned if the section is not
+// available, e.g. because the feature is disabled.
+func (f *FilesApp) OpenSharedWithMe() uiauto.Action {
+	section := nodewith.Name(SharedWithMe).Role(role.TreeItem)
+	return uiauto.Combine("OpenSharedWithMe",
+		f.OpenDrive(),
+		func(ctx context.Context) error {
+			found, err := f.IsNodeFound(ctx, section)
+			if err != nil {
+				return errors.Wrapf(err, "failed to look for %q", SharedWithMe)
+			}
+			if !found {
+				return errors.Errorf("%q section is not available", SharedWithMe)
+			}
+			return nil
+		},
+		f.OpenDir(SharedWithMe, FilesTitlePrefix+SharedWithMe),
+	)
+}
+
+// WaitForFileInSection returns a function that waits for a file to appear in
+// the Drive section, which is either MyDrive or SharedWithMe, and then checks
+// that the file is not shown in the other section.
+func (f *FilesApp) WaitForFileInSection(section, fileName string) uiauto.Action {
+	var open, openOther uiauto.Action
+	switch section {
+	case MyDrive:
+		open, openOther = f.OpenDrive(), f.OpenSharedWithMe()
+	case SharedWithMe:
+		open, openOther = f.OpenSharedWithMe(), f.OpenDrive()
+	default:
+		return func(ctx context.Context) error {
+			return errors.Errorf("unknown Drive section %q", section)
+		}
+	}
+	return uiauto.Combine(fmt.Sprintf("WaitForFileInSection(%s, %s)", section, fileName),
+		open,
+		f.WaitForFile(fileName),
+		openOther,
+		f.EnsureFileGone(fileName, sectionEnsureGoneDuration),
+	)
+}
+
+// linuxFilesTimeout is how long to wait for the Linux files entry to appear in
+// the navigation pane.
+const linuxFilesTimeout = 30 * time.Second
+
+// WaitForLinuxFiles returns a function that waits for the Linux files entry to
+// appear in the navigation pane. An error is returned if it does not appear,
+// e.g. because Crostini is not available.
+func (f *FilesApp) WaitForLinuxFiles() uiauto.Action {
+	return func(ctx context.Context) error {
+		dir := nodewith.Name(LinuxFiles).Role(role.TreeItem)
+		if err := f.ui.WithTimeout(linuxFilesTimeout).WaitUntilExists(dir)(ctx); err != nil {
+			return errors.Wrapf(err, "%q is not shown, Crostini may not be available", LinuxFiles)
+		}
+		return nil
+	}
+}
+
 // OpenLinuxFiles returns a function that opens the Linux files folder in the Files App.
 // An error is returned if Linux files is not found or does not open.
 func (f *FilesApp) OpenLinuxFiles() uiauto.Action {
-	return f.OpenDir("Linux files", FilesTitlePrefix+"Linux files")
+	return uiauto.Combine("OpenLinuxFiles",
+		f.WaitForLinuxFiles(),
+		f.OpenDir(LinuxFiles, FilesTitlePrefix+LinuxFiles),
+	)
+}
+
+// ShareWithLinux returns a function that shares a file or folder in the
+// current directory with Crostini through its "Share with Linux" context menu
+// item.
+func (f *FilesApp) ShareWithLinux(fileName string) uiauto.Action {
+	return f.ClickContextMenuItem(fileName, ShareWithLinux)
 }
 
 // OpenTrash returns a function that opens the Trash folder in the Files App.
@@ -240,6 +343,167 @@ func (f *FilesApp) OpenUSBDriveWithName(driveName string) uiauto.Action {
 	return f.OpenDir(driveName, FilesTitlePrefix+driveName)
 }
 
+// mutableMenuItems returns the names of the menu items among items, which are
+// given by the prefixes of their names, that are shown and enabled in the
+// context menu currently open.
+func (f *FilesApp) mutableMenuItems(ctx context.Context, items ...string) ([]string, error) {
+	var mutable []string
+	for _, item := range items {
+		infos, err := f.NodesInfo(ctx, nodewith.NameStartingWith(item).Role(role.MenuItem))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to look for menu item %q", item)
+		}
+		for _, info := range infos {
+			if info.Restriction != restriction.Disabled {
+				mutable = append(mutable, info.Name)
+			}
+		}
+	}
+	return mutable, nil
+}
+
+// VerifyVolumeReadOnly returns a function that opens the volume volumeName,
+// e.g. a USB drive, and checks that it is mounted read-only: the context menu
+// of the volume must not allow to paste or create a folder, the context menu
+// of each file in its root must not allow to cut, rename or delete it. No
+// mutation is attempted, so that a writable volume is left untouched. An error
+// listing the allowed mutations is returned if the volume is writable.
+func (f *FilesApp) VerifyVolumeReadOnly(kb *input.KeyboardEventWriter, volumeName string) uiauto.Action {
+	dir := nodewith.Name(volumeName).Role(role.TreeItem)
+	fileList := nodewith.Role(role.ListBox).Ancestor(WindowFinder(f.appID))
+	// The rows of the files, rather than their cells, e.g. their size or
+	// date, which are static texts too.
+	rows := nodewith.Role(role.ListBoxOption).Ancestor(fileList)
+	return uiauto.NamedAction(fmt.Sprintf("VerifyVolumeReadOnly(%s)", volumeName), func(ctx context.Context) error {
+		if err := f.OpenDir(volumeName, FilesTitlePrefix+volumeName)(ctx); err != nil {
+			return err
+		}
+		// checkMenu opens the context menu of node and checks the items.
+		checkMenu := func(node *nodewith.Finder, items ...string) ([]string, error) {
+			if err := f.RightClick(node)(ctx); err != nil {
+				return nil, errors.Wrap(err, "failed to open context menu")
+			}
+			if err := f.WaitUntilExists(nodewith.Role(role.MenuItem).First())(ctx); err != nil {
+				return nil, errors.Wrap(err, "failed to wait for context menu")
+			}
+			defer kb.Accel(ctx, "Esc")
+			return f.mutableMenuItems(ctx, items...)
+		}
+
+		mutable, err := checkMenu(nodewith.Name(volumeName).Role(role.StaticText).Ancestor(dir), "Paste", "New folder")
+		if err != nil {
+			return errors.Wrapf(err, "failed to check the context menu of %q", volumeName)
+		}
+		infos, err := f.NodesInfo(ctx, rows)
+		if err != nil {
+			return errors.Wrap(err, "failed to list the files")
+		}
+		for i, info := range infos {
+			fileMutable, err := checkMenu(rows.Nth(i), "Cut", "Rename", "Delete", "Move to trash")
+			if err != nil {
+				return errors.Wrapf(err, "failed to check the context menu of %q", info.Name)
+			}
+			for _, item := range fileMutable {
+				mutable = append(mutable, fmt.Sprintf("%s: %s", info.Name, item))
+			}
+		}
+
+		if len(mutable) > 0 {
+			return errors.Errorf("volume %q is writable, allowed mutations: %q", volumeName, mutable)
+		}
+		return nil
+	})
+}
+
+// RecentFilter is a file type filter of the Recent view.
+type RecentFilter string
+
+// File type filters of the Recent view, as named by their toggle buttons.
+const (
+	RecentAll    RecentFilter = "All"
+	RecentAudio  RecentFilter = "Audio"
+	RecentImages RecentFilter = "Images"
+	RecentVideos RecentFilter = "Videos"
+)
+
+// OpenRecent returns a function that opens the Recent view in the Files App.
+func (f *FilesApp) OpenRecent() uiauto.Action {
+	return f.OpenDir(Recent, FilesTitlePrefix+Recent)
+}
+
+// SelectRecentFilter returns a function that selects the file type filter of
+// the Recent view. The Recent view must be open.
+func (f *FilesApp) SelectRecentFilter(filter RecentFilter) uiauto.Action {
+	actions := []uiauto.Action{f.LeftClick(nodewith.Name(string(RecentAll)).Role(role.ToggleButton))}
+	if filter != RecentAll {
+		actions = append(actions, f.LeftClick(nodewith.Name(string(filter)).Role(role.ToggleButton)))
+	}
+	return uiauto.Combine(fmt.Sprintf("SelectRecentFilter(%s)", filter), actions...)
+}
+
+// WaitForFileInRecent returns a function that waits for a file to appear in
+// the Recent view, with no file type filter.
+func (f *FilesApp) WaitForFileInRecent(fileName string) uiauto.Action {
+	return f.WaitForFileInRecentWithFilter(fileName, RecentAll)
+}
+
+// WaitForFileInRecentWithFilter returns a function that waits for a file to
+// appear in the Recent view with the file type filter selected. The Recent
+// view is not updated while it is shown, so it is reopened until the file
+// appears.
+func (f *FilesApp) WaitForFileInRecentWithFilter(fileName string, filter RecentFilter) uiauto.Action {
+	refresh := uiauto.Combine("refresh Recent",
+		f.OpenDownloads(),
+		f.OpenRecent(),
+		f.SelectRecentFilter(filter),
+	)
+	return uiauto.NamedAction(fmt.Sprintf("WaitForFileInRecent(%s, %s)", fileName, filter),
+		f.ui.RetryUntil(refresh, f.WithTimeout(5*time.Second).WaitForFile(fileName)))
+}
+
+// downloadTimeout is how long WaitForDownload waits for a download to complete.
+const downloadTimeout = time.Minute
+
+// partialDownloadRE matches the names of the files of downloads in progress,
+// e.g. "file.txt.crdownload" or "Unconfirmed 123.crdownload".
+var partialDownloadRE = regexp.MustCompile(`\.crdownload$`)
+
+// WaitForDownload returns a function that opens the Downloads folder and waits
+// for the downloaded file fileName to appear there, with no partial
+// ".crdownload" file left for it. An error mentioning the partial file is
+// returned if the download does not complete in time.
+func (f *FilesApp) WaitForDownload(fileName string) uiauto.Action {
+	partial := file(fileName + ".crdownload")
+	anyPartial := nodewith.NameRegex(partialDownloadRE).Role(role.StaticText).Ancestor(nodewith.Role(role.ListBox))
+	return uiauto.NamedAction(fmt.Sprintf("WaitForDownload(%s)", fileName), func(ctx context.Context) error {
+		if err := f.OpenDownloads()(ctx); err != nil {
+			return err
+		}
+		err := testing.Poll(ctx, func(ctx context.Context) error {
+			found, err := f.IsNodeFound(ctx, file(fileName))
+			if err != nil {
+				return testing.PollBreak(err)
+			}
+			if !found {
+				return errors.Errorf("file %q not found", fileName)
+			}
+			if found, err := f.IsNodeFound(ctx, partial); err != nil {
+				return testing.PollBreak(err)
+			} else if found {
+				return errors.Errorf("partial file of %q still exists", fileName)
+			}
+			return nil
+		}, &testing.PollOptions{Timeout: downloadTimeout})
+		if err == nil {
+			return nil
+		}
+		if found, findErr := f.IsNodeFound(ctx, anyPartial); findErr == nil && found {
+			return errors.Wrapf(err, "download of %q did not complete, only a partial file remains", fileName)
+		}
+		return errors.Wrapf(err, "failed to wait for download of %q", fileName)
+	})
+}
+
 // file returns a nodewith.Finder for a file with the specified name.
 func file(fileName string) *nodewith.Finder {
 	filesBox := nodewith.Role(role.ListBox)
@@ -256,6 +520,28 @@ func (f *FilesApp) WaitUntilFileGone(fileName string) uiauto.Action {
 	return f.WaitUntilGone(file(fileName))
 }
 
+// WaitForFileGone returns a function that waits, up to the timeout of f, for
+// a file to disappear from the file list, e.g. after it was deleted on Drive.
+// It returns immediately if the file is not present. Unlike
+// WaitUntilFileGone, the error on timeout lists the files still shown.
+func (f *FilesApp) WaitForFileGone(fileName string) uiauto.Action {
+	return uiauto.NamedAction(fmt.Sprintf("WaitForFileGone(%s)", fileName), func(ctx context.Context) error {
+		err := f.WaitUntilGone(file(fileName))(ctx)
+		if err == nil {
+			return nil
+		}
+		nodes, listErr := f.NodesInfo(ctx, nodewith.Role(role.StaticText).Ancestor(nodewith.Role(role.ListBox)))
+		if listErr != nil {
+			return errors.Wrapf(err, "file %q is still present", fileName)
+		}
+		var names []string
+		for _, n := range nodes {
+			names = append(names, n.Name)
+		}
+		return errors.Wrapf(err, "file %q is still present among %q", fileName, names)
+	})
+}
+
 // EnsureFileGone returns a function that ensures that the file doesn't appear for the duration.
 func (f *FilesApp) EnsureFileGone(fileName string, duration time.Duration) uiauto.Action {
 	return f.EnsureGoneFor(file(fileName), duration)
@@ -303,6 +589,65 @@ func (f *FilesApp) PasteFileFromClipboard(kb *input.KeyboardEventWriter) uiauto.
 	)
 }
 
+// imageFileRE matches the names of image files.
+var imageFileRE = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|webp|bmp)$`)
+
+// imageFileNames returns the names of the image files in the current directory.
+func (f *FilesApp) imageFileNames(ctx context.Context) (map[string]bool, error) {
+	nodes, err := f.NodesInfo(ctx, nodewith.NameRegex(imageFileRE).Role(role.StaticText).Ancestor(nodewith.Role(role.ListBox)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list image files")
+	}
+	names := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		names[n.Name] = true
+	}
+	return names, nil
+}
+
+// PasteImageFromClipboard returns a function that opens the directory folder
+// from the navigation tree, pastes the image on the clipboard there, and waits
+// for a new image file to appear. An error is returned if the first item of the
+// clipboard is not an image.
+func (f *FilesApp) PasteImageFromClipboard(kb *input.KeyboardEventWriter, folder string) uiauto.Action {
+	return uiauto.NamedAction(fmt.Sprintf("PasteImageFromClipboard(%s)", folder), func(ctx context.Context) error {
+		itemType, err := clipboard.GetClipboardFirstItemType(ctx, f.tconn)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the clipboard")
+		}
+		if !strings.HasPrefix(itemType, "image/") {
+			return errors.Errorf("clipboard has no image, but %q", itemType)
+		}
+
+		if err := f.OpenDir(folder, FilesTitlePrefix+folder)(ctx); err != nil {
+			return err
+		}
+		before, err := f.imageFileNames(ctx)
+		if err != nil {
+			return err
+		}
+		if err := uiauto.Combine("paste the image",
+			f.FocusAndWait(nodewith.Role(role.ListBox)),
+			kb.AccelAction("Ctrl+V"),
+		)(ctx); err != nil {
+			return err
+		}
+		return testing.Poll(ctx, func(ctx context.Context) error {
+			after, err := f.imageFileNames(ctx)
+			if err != nil {
+				return testing.PollBreak(err)
+			}
+			for name := range after {
+				if !before[name] {
+					testing.ContextLogf(ctx, "Pasted image as %q", name)
+					return nil
+				}
+			}
+			return errors.Errorf("no new image file in %s", folder)
+		}, &testing.PollOptions{Timeout: 15 * time.Second})
+	})
+}
+
 // ClickMoreMenuItem returns a function that opens More menu then clicks on sub menu items.
 func (f *FilesApp) ClickMoreMenuItem(menuItems ...string) uiauto.Action {
 	var steps []uiauto.Action
@@ -379,6 +724,34 @@ func (f *FilesApp) SelectMultipleFiles(kb *input.KeyboardEventWriter, fileList .
 	}
 }
 
+// SelectAll returns a function that selects all the items in the current
+// directory by pressing Ctrl+A in the file list, and verifies that the number
+// of selected items is the number of items in the file list. The file list is
+// focused first so that the navigation tree is not affected.
+func (f *FilesApp) SelectAll(kb *input.KeyboardEventWriter) uiauto.Action {
+	fileList := nodewith.Role(role.ListBox).Ancestor(WindowFinder(f.appID))
+	return uiauto.NamedAction("SelectAll()", func(ctx context.Context) error {
+		if err := f.FocusAndWait(fileList)(ctx); err != nil {
+			return errors.Wrap(err, "failed to focus the file list")
+		}
+		items, err := f.NodesInfo(ctx, nodewith.Role(role.ListBoxOption).Ancestor(fileList))
+		if err != nil {
+			return errors.Wrap(err, "failed to list the items")
+		}
+		if len(items) == 0 {
+			return errors.New("no items to select in the current directory")
+		}
+		if err := kb.Accel(ctx, "Ctrl+A"); err != nil {
+			return errors.Wrap(err, "failed to press Ctrl+A")
+		}
+		selectionLabelRE := regexp.MustCompile(fmt.Sprintf("^%d (file|item|folder)s? selected", len(items)))
+		if err := f.WaitUntilExists(nodewith.Role(role.StaticText).NameRegex(selectionLabelRE))(ctx); err != nil {
+			return errors.Wrapf(err, "failed to verify that all %d items are selected", len(items))
+		}
+		return nil
+	})
+}
+
 // CreateFolder returns a function that creates a new folder named dirName in the current directory.
 func (f *FilesApp) CreateFolder(kb *input.KeyboardEventWriter, dirName string) uiauto.Action {
 	return uiauto.Combine(fmt.Sprintf("CreateFolder(%s)", dirName),
@@ -405,6 +778,28 @@ func (f *FilesApp) OpenPath(expectedTitle, dirName string, path ...string) uiaut
 	return uiauto.Combine(fmt.Sprintf("OpenPath(%s, %s, %s)", expectedTitle, dirName, path), steps...)
 }
 
+// OpenSubfolders returns a function that descends from the currently open
+// folder into the folders of segments in order, e.g. "a", "b", "c" opens
+// a/b/c, by double-clicking each of them and waiting for it to be open before
+// opening the next one. Unlike OpenPath, it does not start from the navigation
+// tree. The error names the missing folder and how deep the navigation went.
+func (f *FilesApp) OpenSubfolders(segments ...string) uiauto.Action {
+	return uiauto.NamedAction(fmt.Sprintf("OpenSubfolders(%s)", strings.Join(segments, "/")), func(ctx context.Context) error {
+		for i, folder := range segments {
+			if err := f.WaitForFile(folder)(ctx); err != nil {
+				return errors.Wrapf(err, "folder %q not found at level %d, in %q", folder, i, strings.Join(segments[:i], "/"))
+			}
+			if err := uiauto.Combine("open folder",
+				f.OpenFile(folder),
+				f.WaitUntilExists(f.title(FilesTitlePrefix+folder)),
+			)(ctx); err != nil {
+				return errors.Wrapf(err, "failed to open folder %q at level %d", folder, i)
+			}
+		}
+		return nil
+	})
+}
+
 // DeleteFileOrFolder returns a function that deletes a file or folder.
 // The parent folder must currently be open for this to work.
 // Consider using OpenPath to do this.
@@ -553,6 +948,43 @@ func (f *FilesApp) PerformActionAndRetryMaximizedOnFail(action uiauto.Action) ui
 	}
 }
 
+// errorDialog returns the finder of the alert dialog the Files app shows when
+// an operation fails. It only matches the dialogs of the Files app window.
+func (f *FilesApp) errorDialog() *nodewith.Finder {
+	return nodewith.Role(role.AlertDialog).Ancestor(WindowFinder(f.appID)).First()
+}
+
+// WaitForErrorDialog waits for an error dialog to appear and returns its
+// message text. An error is returned if no dialog appears before the timeout.
+func (f *FilesApp) WaitForErrorDialog(ctx context.Context) (string, error) {
+	dialog := f.errorDialog()
+	if err := f.WaitUntilExists(dialog)(ctx); err != nil {
+		return "", errors.Wrap(err, "no dialog appeared")
+	}
+	info, err := f.Info(ctx, dialog)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the error dialog info")
+	}
+	// The message is exposed as the description of the dialog, while the name
+	// holds its title. Some dialogs have no title, in which case the message is
+	// used as the name.
+	if info.Description != "" {
+		return info.Description, nil
+	}
+	return info.Name, nil
+}
+
+// DismissDialog returns a function that dismisses the currently shown error
+// dialog and waits for it to be gone.
+func (f *FilesApp) DismissDialog() uiauto.Action {
+	dialog := f.errorDialog()
+	dismiss := nodewith.Role(role.Button).NameRegex(regexp.MustCompile("^(OK|Close|Dismiss)$")).Ancestor(dialog)
+	return uiauto.Combine("DismissDialog",
+		f.LeftClick(dismiss),
+		f.WaitUntilGone(dialog),
+	)
+}
+
 // ExpandOpenDropdown waits for the Open button (in the toolbar) to be a dropdown and click to display the dropdown menu.
 func (f *FilesApp) ExpandOpenDropdown() uiauto.Action {
 	openButton := nodewith.Role(role.Button).Collapsed().Name(Open)
@@ -563,3 +995,111 @@ func (f *FilesApp) ExpandOpenDropdown() uiauto.Action {
 		f.WaitUntilExists(dropdownMenu),
 	)
 }
+
+// pinnedFolder is the finder of the pinned folders (shortcuts) in the navigation tree.
+var pinnedFolder = nodewith.Role(role.TreeItem).HasClass("shortcut-item")
+
+// pinnedFolderNames returns the names of the pinned folders in the navigation tree, in display order.
+func (f *FilesApp) pinnedFolderNames(ctx context.Context) ([]string, error) {
+	nodes, err := f.NodesInfo(ctx, pinnedFolder)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the pinned folders")
+	}
+	var names []string
+	for _, n := range nodes {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// ReorderPinnedFolder returns an action that drags the pinned folder named name to the position
+// toIndex among the pinned folders in the navigation tree, and verifies that the order changed.
+// An error is returned if the folder is not pinned or toIndex is out of range.
+func (f *FilesApp) ReorderPinnedFolder(name string, toIndex int) uiauto.Action {
+	return uiauto.NamedAction(fmt.Sprintf("ReorderPinnedFolder(%s, %d)", name, toIndex), func(ctx context.Context) error {
+		names, err := f.pinnedFolderNames(ctx)
+		if err != nil {
+			return err
+		}
+		fromIndex := -1
+		for i, n := range names {
+			if n == name {
+				fromIndex = i
+				break
+			}
+		}
+		if fromIndex < 0 {
+			return errors.Errorf("folder %q is not pinned; pinned folders: %q", name, names)
+		}
+		if toIndex < 0 || toIndex >= len(names) {
+			return errors.Errorf("index %d out of range [0, %d)", toIndex, len(names))
+		}
+		if fromIndex == toIndex {
+			return nil
+		}
+
+		src, err := f.ui.Location(ctx, pinnedFolder.Nth(fromIndex))
+		if err != nil {
+			return errors.Wrapf(err, "failed to find the location of %q", name)
+		}
+		dst, err := f.ui.Location(ctx, pinnedFolder.Nth(toIndex))
+		if err != nil {
+			return errors.Wrapf(err, "failed to find the location of the pinned folder at %d", toIndex)
+		}
+		// Drop on the edge of the target which is on the far side from the source,
+		// so that the folder is inserted at the target's position.
+		dropPoint := dst.TopCenter().Add(coords.NewPoint(0, 1))
+		if toIndex > fromIndex {
+			dropPoint = dst.BottomCenter().Sub(coords.NewPoint(0, 1))
+		}
+		if err := mouse.Drag(f.tconn, src.CenterPoint(), dropPoint, time.Second)(ctx); err != nil {
+			return errors.Wrapf(err, "failed to drag %q", name)
+		}
+
+		return testing.Poll(ctx, func(ctx context.Context) error {
+			names, err := f.pinnedFolderNames(ctx)
+			if err != nil {
+				return testing.PollBreak(err)
+			}
+			if toIndex >= len(names) || names[toIndex] != name {
+				return errors.Errorf("%q is not at index %d; pinned folders: %q", name, toIndex, names)
+			}
+			return nil
+		}, &testing.PollOptions{Timeout: 5 * time.Second})
+	})
+}
+
+// selectionCountRE matches the label showing the number of selected items, e.g. "3 files selected".
+var selectionCountRE = regexp.MustCompile(`^(\d+) (file|item|folder)s? selected$`)
+
+// SelectedCount returns the number of items selected in the file list. The count is read from
+// the selection label in the toolbar. If the label is not found, e.g. because the UI is not in
+// English, the selected items in the file list are counted instead. 0 is returned if nothing is
+// selected.
+func (f *FilesApp) SelectedCount(ctx context.Context) (int, error) {
+	label := nodewith.Role(role.StaticText).NameRegex(selectionCountRE).First()
+	if found, err := f.IsNodeFound(ctx, label); err != nil {
+		return 0, errors.Wrap(err, "failed to look for the selection label")
+	} else if found {
+		info, err := f.Info(ctx, label)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get the selection label")
+		}
+		if m := selectionCountRE.FindStringSubmatch(info.Name); m != nil {
+			return strconv.Atoi(m[1])
+		}
+	}
+
+	// Fall back to the selection state of the items in the file list.
+	items, err := f.NodesInfo(ctx, nodewith.Role(role.ListBoxOption).Ancestor(nodewith.Role(role.ListBox)))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get the items in the file list")
+	}
+	count := 0
+	for _, item := range items {
+		if item.Selected {
+			count++
+		}
+	}
+	return count, nil
+}
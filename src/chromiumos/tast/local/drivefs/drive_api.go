@@ -8,9 +8,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -21,6 +25,7 @@ import (
 
 	"chromiumos/tast/errors"
 	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/testing"
 )
 
 var (
@@ -87,11 +92,13 @@ func (d *APIClient) CreateBlankGoogleSlide(ctx context.Context, fileName string,
 	return d.service.Files.Create(slide).Context(ctx).Do()
 }
 
-// Createfolder creates a folder with supplied filename in the directory path.
+// CreateFolder creates a folder with supplied filename in the directory path.
 // All paths should start with root unless they are team drives, in which case the drive path.
-func (d *APIClient) Createfolder(ctx context.Context, fileName string, dirPath []string) (*drive.File, error) {
+// The Id of the returned folder can be used as the parent of other files, and
+// RemoveFileByID removes the folder along with its contents.
+func (d *APIClient) CreateFolder(ctx context.Context, fileName string, dirPath []string) (*drive.File, error) {
 	folder := &drive.File{
-		MimeType: "application/vnd.google-apps.folder",
+		MimeType: folderMimeType,
 		Name:     fileName,
 		Parents:  dirPath,
 	}
@@ -131,23 +138,295 @@ func (d *APIClient) CreateFileFromLocalFile(ctx context.Context,
 	return d.CreateFile(ctx, fileName, parentID, localFile)
 }
 
+// UploadFile uploads the local file at localPath to Google Drive as name in
+// the folders parents, use `"root"` for the user's My Drive root. If name is
+// empty, the base name of localPath is used. The file is uploaded with
+// mimeType, or if it is empty, with the MIME type detected from the extension
+// of localPath, falling back to sniffing the content. The file is streamed in
+// chunks, so that it is not read into memory at once.
+func (d *APIClient) UploadFile(ctx context.Context, localPath, name, mimeType string, parents []string) (*drive.File, error) {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the file to upload")
+	}
+	defer localFile.Close()
+
+	if name == "" {
+		name = filepath.Base(localPath)
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(localPath))
+	}
+	file := &drive.File{
+		Name:     name,
+		MimeType: mimeType,
+		Parents:  parents,
+	}
+	var opts []googleapi.MediaOption
+	if mimeType != "" {
+		opts = append(opts, googleapi.ContentType(mimeType))
+	}
+	f, err := d.service.Files.Create(file).Media(localFile, opts...).Fields(defaultFileFields...).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to upload %s", localPath)
+	}
+	return f, nil
+}
+
 // GetFileByID gets the metadata of a file on Drive by the `fileID` of
 // the file.
 func (d *APIClient) GetFileByID(ctx context.Context, fileID string) (*drive.File, error) {
 	return d.service.Files.Get(fileID).Fields(defaultFileFields...).Context(ctx).Do()
 }
 
+// serverSyncTimeout is how long to wait for a local change to be synced to
+// Drive.
+const serverSyncTimeout = 2 * time.Minute
+
+// WaitForServerName polls Drive until the file with the supplied `fileID` is
+// named `expectedName`, e.g. after it is renamed locally within `drivefs`. On
+// timeout, the returned error contains the current name on Drive.
+func (d *APIClient) WaitForServerName(ctx context.Context, fileID, expectedName string) error {
+	var name string
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		file, err := d.service.Files.Get(fileID).Fields("name").Context(ctx).Do()
+		if err != nil {
+			return errors.Wrapf(err, "failed to get file %s", fileID)
+		}
+		name = file.Name
+		if name != expectedName {
+			return errors.Errorf("file is named %q on Drive", name)
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: serverSyncTimeout, Interval: 5 * time.Second}); err != nil {
+		return errors.Wrapf(err, "file %s is still named %q on Drive, want %q", fileID, name, expectedName)
+	}
+	return nil
+}
+
 // RemoveFileByID removes the file by supplied fileID.
 func (d *APIClient) RemoveFileByID(ctx context.Context, fileID string) error {
 	return d.service.Files.Delete(fileID).Context(ctx).Do()
 }
 
+// TrashFile moves the file with the supplied `fileID` to the trash and returns
+// the updated file. It does nothing if the file is already trashed.
+func (d *APIClient) TrashFile(ctx context.Context, fileID string) (*drive.File, error) {
+	return d.setTrashed(ctx, fileID, true)
+}
+
+// RestoreFile restores the file with the supplied `fileID` from the trash and
+// returns the updated file. It does nothing if the file is not trashed.
+func (d *APIClient) RestoreFile(ctx context.Context, fileID string) (*drive.File, error) {
+	return d.setTrashed(ctx, fileID, false)
+}
+
+// setTrashed sets the trashed state of the file with the supplied `fileID`,
+// only updating the file if its state differs.
+func (d *APIClient) setTrashed(ctx context.Context, fileID string, trashed bool) (*drive.File, error) {
+	file, err := d.GetFileByID(ctx, fileID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get file %s", fileID)
+	}
+	if file.Trashed == trashed {
+		return file, nil
+	}
+	// Trashed is omitted from the request when false unless it is forced.
+	update := &drive.File{Trashed: trashed, ForceSendFields: []string{"Trashed"}}
+	file, err = d.service.Files.Update(fileID, update).Fields(defaultFileFields...).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to set trashed to %t for file %s", trashed, fileID)
+	}
+	return file, nil
+}
+
 // ListAllFilesOlderThan returns a list of files older than `duration` from now.
 func (d *APIClient) ListAllFilesOlderThan(ctx context.Context, duration time.Duration) (*drive.FileList, error) {
 	olderDate := time.Now().Add(-duration).Format(time.RFC3339)
 	return d.service.Files.List().Q(fmt.Sprintf("modifiedTime < '%s'", olderDate)).Context(ctx).Do()
 }
 
+// ListFilesModifiedSince returns the non-trashed files modified after `since`,
+// ordered by their modification time. If `parent` is not empty, only the
+// direct children of the folder with that ID are returned.
+func (d *APIClient) ListFilesModifiedSince(ctx context.Context, since time.Time, parent string) ([]*drive.File, error) {
+	q := fmt.Sprintf("modifiedTime > '%s' and trashed = false", since.UTC().Format(time.RFC3339))
+	if parent != "" {
+		q += fmt.Sprintf(" and '%s' in parents", parent)
+	}
+	var files []*drive.File
+	if err := d.service.Files.List().Q(q).OrderBy("modifiedTime").
+		Fields(listFields(append(append([]googleapi.Field(nil), defaultFileFields...), "modifiedTime")...)...).
+		Pages(ctx, func(l *drive.FileList) error {
+			files = append(files, l.Files...)
+			return nil
+		}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list files modified since %v", since)
+	}
+	return files, nil
+}
+
+// folderMimeType is the MIME type of Drive folders.
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// CountFilesRecursive returns the number of non-trashed files in the folder
+// with ID folderID and all of its subfolders. Folders themselves are not
+// counted.
+func (d *APIClient) CountFilesRecursive(ctx context.Context, folderID string) (int, error) {
+	count := 0
+	folders := []string{folderID}
+	for len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+		q := fmt.Sprintf("'%s' in parents and trashed = false", folder)
+		if err := d.service.Files.List().Q(q).
+			Fields(listFields("id", "mimeType")...).
+			Pages(ctx, func(l *drive.FileList) error {
+				for _, f := range l.Files {
+					if f.MimeType == folderMimeType {
+						folders = append(folders, f.Id)
+					} else {
+						count++
+					}
+				}
+				return nil
+			}); err != nil {
+			return 0, errors.Wrapf(err, "failed to list children of folder %s", folder)
+		}
+	}
+	return count, nil
+}
+
+// Revision describes a revision of a Drive file.
+type Revision struct {
+	ID           string
+	ModifiedTime time.Time
+}
+
+// ListRevisions returns the revisions of the file with ID fileID, ordered
+// chronologically from the oldest one. Note that Drive may merge revisions
+// which are made in quick succession.
+func (d *APIClient) ListRevisions(ctx context.Context, fileID string) ([]Revision, error) {
+	var revs []Revision
+	if err := d.service.Revisions.List(fileID).
+		Fields("nextPageToken", "revisions(id,modifiedTime)").
+		Pages(ctx, func(l *drive.RevisionList) error {
+			for _, r := range l.Revisions {
+				t, err := time.Parse(time.RFC3339, r.ModifiedTime)
+				if err != nil {
+					return errors.Wrapf(err, "failed to parse modified time of revision %s", r.Id)
+				}
+				revs = append(revs, Revision{ID: r.Id, ModifiedTime: t})
+			}
+			return nil
+		}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list revisions of file %s", fileID)
+	}
+	sort.SliceStable(revs, func(i, j int) bool {
+		return revs[i].ModifiedTime.Before(revs[j].ModifiedTime)
+	})
+	return revs, nil
+}
+
+// maxFolderDepth is the maximum depth of the folders walked by myDrivePath.
+const maxFolderDepth = 32
+
+// myDrivePath returns the path elements of file relative to the root of My
+// Drive, by walking up its parents.
+func (d *APIClient) myDrivePath(ctx context.Context, file *drive.File) ([]string, error) {
+	elems := []string{file.Name}
+	for cur := file; len(cur.Parents) > 0; {
+		if len(elems) > maxFolderDepth {
+			return nil, errors.Errorf("file %s is nested too deep", file.Id)
+		}
+		parent, err := d.GetFileByID(ctx, cur.Parents[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get parent %s", cur.Parents[0])
+		}
+		if len(parent.Parents) == 0 {
+			// The parent is the root of My Drive.
+			break
+		}
+		elems = append([]string{parent.Name}, elems...)
+		cur = parent
+	}
+	return elems, nil
+}
+
+// OpenFileStream reads length bytes at offset from the file with ID fileID
+// through the DriveFS mount of the account the client is authorized for. The
+// range is checked against the file size reported by the Drive API. The file
+// must be in My Drive and must not be pinned, as DriveFS downloads pinned files
+// entirely. An error is returned if the DriveFS content cache grows by the size
+// of the file or more during the read of a smaller range, i.e. if DriveFS
+// materialized the whole file instead of serving the range. Other downloads
+// happening at the same time may cause the cache to grow as well.
+func (d *APIClient) OpenFileStream(ctx context.Context, fileID string, offset, length int64) ([]byte, error) {
+	file, err := d.GetFileByID(ctx, fileID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get file %s", fileID)
+	}
+	if offset < 0 || length <= 0 || offset+length > file.Size {
+		return nil, errors.Errorf("range [%d, %d) is out of bounds of file %s of size %d", offset, offset+length, fileID, file.Size)
+	}
+	about, err := d.service.About.Get().Fields("user(emailAddress)").Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the user of the Drive API client")
+	}
+	dfs, err := NewDriveFs(ctx, about.User.EmailAddress)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the DriveFS mount of %s", about.User.EmailAddress)
+	}
+	elems, err := d.myDrivePath(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	path := dfs.MyDrivePath(elems...)
+	f, err := dfs.NewFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if pinned, err := f.IsPinned(); err != nil {
+		return nil, errors.Wrapf(err, "failed to check whether %s is pinned", path)
+	} else if pinned {
+		return nil, errors.Errorf("%s is pinned", path)
+	}
+
+	cacheBefore, err := dfs.contentCacheSize()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Open(); err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %d bytes at %d from %s", length, offset, path)
+	}
+	cacheAfter, err := dfs.contentCacheSize()
+	if err != nil {
+		return nil, err
+	}
+	if grown := cacheAfter - cacheBefore; length < file.Size && grown >= file.Size {
+		return nil, errors.Errorf("DriveFS content cache grew by %d bytes while reading %d bytes of %s of size %d, the whole file was fetched", grown, length, path, file.Size)
+	}
+	return buf, nil
+}
+
+// listFields returns the fields to request from a files.list call so that
+// the supplied file fields are populated and the results can be paged through.
+func listFields(fileFields ...googleapi.Field) []googleapi.Field {
+	names := make([]string, len(fileFields))
+	for i, f := range fileFields {
+		names[i] = string(f)
+	}
+	return []googleapi.Field{
+		"nextPageToken",
+		googleapi.Field(fmt.Sprintf("files(%s)", strings.Join(names, ","))),
+	}
+}
+
 // RenewRefreshTokenForAccount obtains a new OAuth refresh token for an account logged in
 // on the chrome.Chrome instance. This is used by filemanager.DrivefsNewRefreshTokens
 // test to easily obtain a set of new refresh tokens for the pooled GAIA logins.
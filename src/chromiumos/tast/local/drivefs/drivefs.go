@@ -8,7 +8,9 @@ import (
 	"context"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"chromiumos/tast/common/action"
 	"chromiumos/tast/common/testexec"
@@ -22,6 +24,8 @@ const (
 	driveFsXattrPinned      = "user.drive.pinned"
 	driveFsXattrUncommitted = "user.drive.uncommitted"
 	driveFsXattrID          = "user.drive.id"
+
+	driveFsContentCacheDirName = "content_cache"
 )
 
 // DriveFs is a helper object for working with `drivefs` instances run within
@@ -113,6 +117,43 @@ func (dfs *DriveFs) SaveLogsOnError(ctx context.Context, hasError func() bool) {
 	saveDriveLogs(ctx, dfs.homeDir, dfs.persistableToken)
 }
 
+// RenameLocalFile renames the file at `oldLocalPath` within `drivefs` to
+// `newName` in the same directory, and returns the new path. The rename is
+// synced to Drive asynchronously, see `APIClient.WaitForServerName`.
+func (dfs *DriveFs) RenameLocalFile(ctx context.Context, oldLocalPath, newName string) (string, error) {
+	if err := dfs.ensureDriveFsPath(oldLocalPath); err != nil {
+		return "", err
+	}
+	if newName == "" || strings.Contains(newName, "/") {
+		return "", errors.Errorf("invalid file name %q", newName)
+	}
+	newLocalPath := path.Join(path.Dir(oldLocalPath), newName)
+	if err := os.Rename(oldLocalPath, newLocalPath); err != nil {
+		return "", errors.Wrapf(err, "failed to rename %s to %s", oldLocalPath, newName)
+	}
+	return newLocalPath, nil
+}
+
+// contentCacheSize returns the disk space used by the files in the content
+// cache of `drivefs`, where the downloaded file data is stored. The cache files
+// are sparse, so only the fetched parts of the files are accounted.
+func (dfs *DriveFs) contentCacheSize() (int64, error) {
+	var size int64
+	if err := filepath.Walk(dfs.ConfigPath(driveFsContentCacheDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() {
+			// Blocks is in 512-byte units regardless of the file system block size.
+			size += st.Blocks * 512
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.Wrap(err, "failed to compute the size of the DriveFS content cache")
+	}
+	return size, nil
+}
+
 func (dfs *DriveFs) ensureDriveFsPath(path string) error {
 	if strings.HasPrefix(path, dfs.mountPath) {
 		return nil
@@ -9,6 +9,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -91,3 +92,22 @@ func MD5SumFile(path string) (string, error) {
 	}
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
+
+// CountLocalFilesRecursive returns the number of regular files under the local
+// directory at `path`, e.g. a folder in the DriveFS mount, to be compared with
+// APIClient.CountFilesRecursive. Directories are not counted.
+func CountLocalFilesRecursive(path string) (int, error) {
+	count := 0
+	if err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			count++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
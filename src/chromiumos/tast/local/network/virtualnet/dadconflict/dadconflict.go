@@ -0,0 +1,264 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package dadconflict provides a server inside a virtualnet.Env which claims
+// the IPv6 addresses that the clients on the network are about to configure,
+// so that their Duplicate Address Detection (DAD) fails and they have to pick
+// other addresses.
+package dadconflict
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/network/virtualnet/env"
+)
+
+// readTimeout bounds each read on the socket, so that Stop does not wait for
+// a packet to arrive.
+const readTimeout = 500 * time.Millisecond
+
+// allNodesMAC is the Ethernet address of the all-nodes multicast group.
+var allNodesMAC = net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1}
+
+type responder struct {
+	env     *env.Env
+	fd      int
+	ifindex int
+	mac     net.HardwareAddr
+	done    chan struct{}
+	stopped chan struct{}
+
+	// mu protects the fields below, which are also accessed by the goroutine
+	// answering the probes.
+	mu       sync.Mutex
+	enabled  bool
+	injected []net.IP
+	logs     []string
+}
+
+// New creates a new DAD conflict responder, which claims the addresses only
+// if enabled is true until SetEnabled is called. The returned object can be
+// passed to Env.StartServer(), its lifetime will be managed by the Env object.
+// Only the DAD probes for global addresses are answered, so that the clients
+// keep their link-local addresses.
+func New(enabled bool) *responder {
+	return &responder{enabled: enabled, fd: -1}
+}
+
+// htons converts v to the network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// Start opens a packet socket on the inside interface of e and starts
+// answering the DAD probes received on it.
+func (r *responder) Start(ctx context.Context, e *env.Env) error {
+	r.env = e
+	if err := r.openSocket(ctx); err != nil {
+		return err
+	}
+	r.done = make(chan struct{})
+	r.stopped = make(chan struct{})
+	go r.run()
+	return nil
+}
+
+// openSocket opens the packet socket inside the netns of the Env.
+func (r *responder) openSocket(ctx context.Context) (retErr error) {
+	cleanup, err := r.env.EnterNetNS(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enter the associated netns %s", r.env.NetNSName)
+	}
+	defer func() {
+		if err := cleanup(); err != nil && retErr == nil {
+			retErr = errors.Wrapf(err, "failed to go back to the original netns from netns %s", r.env.NetNSName)
+		}
+	}()
+
+	iface, err := net.InterfaceByName(r.env.VethInName)
+	if err != nil {
+		return errors.Wrap(err, "failed to get interface object for the in interface")
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_IPV6)))
+	if err != nil {
+		return errors.Wrap(err, "failed to open packet socket")
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IPV6), Ifindex: iface.Index}); err != nil {
+		unix.Close(fd)
+		return errors.Wrapf(err, "failed to bind packet socket to %s", iface.Name)
+	}
+	tv := unix.NsecToTimeval(readTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return errors.Wrap(err, "failed to set read timeout on packet socket")
+	}
+	r.fd, r.ifindex, r.mac = fd, iface.Index, iface.HardwareAddr
+	return nil
+}
+
+// run answers the DAD probes until Stop is called.
+func (r *responder) run() {
+	defer close(r.stopped)
+	buf := make([]byte, 65536)
+	for {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		n, from, err := unix.Recvfrom(r.fd, buf, 0)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			r.logf("Failed to read from packet socket: %v", err)
+			return
+		}
+		// Skip the packets sent from this Env, including the answers.
+		if ll, ok := from.(*unix.SockaddrLinklayer); ok && ll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		target, ok := parseDADProbe(buf[:n])
+		if !ok {
+			continue
+		}
+		if !r.Enabled() {
+			r.logf("Ignored DAD probe for %s", target)
+			continue
+		}
+		if err := r.claim(target); err != nil {
+			r.logf("Failed to claim %s: %v", target, err)
+			continue
+		}
+		r.mu.Lock()
+		r.injected = append(r.injected, target)
+		r.mu.Unlock()
+		r.logf("Claimed %s", target)
+	}
+}
+
+// parseDADProbe returns the target address of frame if it is a neighbor
+// solicitation sent for DAD, i.e. from the unspecified address, for a global
+// address.
+func parseDADProbe(frame []byte) (net.IP, bool) {
+	p := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	ip, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok || !ip.SrcIP.IsUnspecified() {
+		return nil, false
+	}
+	ns, ok := p.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+	if !ok || !ns.TargetAddress.IsGlobalUnicast() {
+		return nil, false
+	}
+	return ns.TargetAddress, true
+}
+
+// claim sends an unsolicited neighbor advertisement for target to all nodes,
+// which tells the client probing target that it is already in use.
+func (r *responder) claim(target net.IP) error {
+	eth := &layers.Ethernet{
+		SrcMAC:       r.mac,
+		DstMAC:       allNodesMAC,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip := &layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      target,
+		DstIP:      net.IPv6linklocalallnodes,
+	}
+	icmp := &layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0),
+	}
+	if err := icmp.SetNetworkLayerForChecksum(ip); err != nil {
+		return errors.Wrap(err, "failed to set network layer for checksum")
+	}
+	na := &layers.ICMPv6NeighborAdvertisement{
+		// Override flag. The solicited flag must not be set on advertisements
+		// sent to a multicast address.
+		Flags:         0x20,
+		TargetAddress: target,
+		Options: layers.ICMPv6Options{
+			{Type: layers.ICMPv6OptTargetAddress, Data: r.mac},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, eth, ip, icmp, na); err != nil {
+		return errors.Wrap(err, "failed to serialize neighbor advertisement")
+	}
+	if err := unix.Sendto(r.fd, buf.Bytes(), 0, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IPV6), Ifindex: r.ifindex}); err != nil {
+		return errors.Wrap(err, "failed to send neighbor advertisement")
+	}
+	return nil
+}
+
+// logf records a log line, to be written by WriteLogs.
+func (r *responder) logf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, time.Now().Format(time.RFC3339Nano)+" "+fmt.Sprintf(format, args...))
+}
+
+// SetEnabled sets whether the DAD probes are answered. It can be called at any
+// time after the responder is started.
+func (r *responder) SetEnabled(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = enabled
+}
+
+// Enabled returns whether the DAD probes are answered.
+func (r *responder) Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+// Injected returns the addresses claimed so far, in order. A conflict was
+// injected if it is not empty.
+func (r *responder) Injected() []net.IP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]net.IP(nil), r.injected...)
+}
+
+// Stop stops answering the DAD probes and closes the socket.
+func (r *responder) Stop(ctx context.Context) error {
+	if r.fd < 0 {
+		return nil
+	}
+	close(r.done)
+	<-r.stopped
+	err := unix.Close(r.fd)
+	r.fd = -1
+	if err != nil {
+		return errors.Wrap(err, "failed to close packet socket")
+	}
+	return nil
+}
+
+// WriteLogs writes logs into |f|.
+func (r *responder) WriteLogs(ctx context.Context, f *os.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.logs) == 0 {
+		return nil
+	}
+	if _, err := f.WriteString(strings.Join(r.logs, "\n") + "\n"); err != nil {
+		return errors.Wrap(err, "failed to write logs")
+	}
+	return nil
+}
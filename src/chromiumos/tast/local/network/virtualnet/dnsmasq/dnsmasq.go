@@ -14,7 +14,10 @@ import (
 	"html/template"
 	"net"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"chromiumos/tast/common/testexec"
 	"chromiumos/tast/errors"
@@ -25,12 +28,17 @@ const confTemplate = `
 port={{.port}}
 interface={{.ifname}}
 {{if .subnet}}
-dhcp-range={{.pool_start}},{{.pool_end}},{{.netmask}},12h
+dhcp-range={{.pool_start}},{{.pool_end}},{{.netmask}},{{.lease_time}}
 dhcp-option=option:netmask,{{.netmask}}
 dhcp-option=option:router,{{.gateway}}
 {{end}}
+{{if .t1}}
+dhcp-option=option:T1,{{.t1}}
+dhcp-option=option:T2,{{.t2}}
+{{end}}
 {{if .address}}
 address={{.address}}
+log-queries
 {{end}}
 {{if .dns}}
 dhcp-option=option:dns-server,{{.dns}}
@@ -52,6 +60,22 @@ const (
 	dnsPort       = "53"
 )
 
+// Lease times.
+const (
+	defaultLeaseTime = 12 * time.Hour
+	// minLeaseTime is the shortest lease time dnsmasq accepts. Shorter lease
+	// times are silently raised to it.
+	minLeaseTime = 2 * time.Minute
+)
+
+// ackRE matches the log lines of the DHCPACK messages sent by dnsmasq, e.g.
+// "Oct 16 12:34:56 dnsmasq-dhcp[123]: DHCPACK(ethi_foo) 192.168.1.50 72:f1:b4:0c:1f:7a host".
+var ackRE = regexp.MustCompile(`^(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) dnsmasq-dhcp\[\d+\]: (?:\d+ )?DHCPACK\([^)]*\) (\S+) (\S+)`)
+
+// queryRE matches the log lines of the DNS queries received by dnsmasq, e.g.
+// "Oct 16 12:34:56 dnsmasq[123]: query[AAAA] www.example.com from 192.168.1.50".
+var queryRE = regexp.MustCompile(`^(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) dnsmasq\[\d+\]: (?:\d+ \S+ )?query\[(\w+)\] (\S+) from (\S+)`)
+
 // Route represents a classless static route.
 type Route struct {
 	Prefix  *net.IPNet
@@ -69,6 +93,9 @@ type dnsmasq struct {
 	enableDNS             bool
 	ifname                string
 	wpad                  string
+	leaseTime             time.Duration
+	t1                    time.Duration
+	t2                    time.Duration
 
 	cmd *testexec.Cmd
 }
@@ -109,6 +136,19 @@ func WithDHCPWPAD(wpad string) Option {
 	}
 }
 
+// WithDHCPLeaseTimes configures the lease time of the DHCP leases and the
+// renewal (T1, option 58) and rebinding (T2, option 59) times advertised to the
+// clients, so that tests can observe renewals quickly. The times must satisfy
+// t1 < t2 < lease, and lease must be at least 2 minutes, which is the minimum
+// lease time of dnsmasq; the renewals can be made faster with a short t1.
+func WithDHCPLeaseTimes(t1, t2, lease time.Duration) Option {
+	return func(d *dnsmasq) {
+		d.t1 = t1
+		d.t2 = t2
+		d.leaseTime = lease
+	}
+}
+
 // WithInterface specifies the interface which dnsmasq should be running on. By
 // default, the in-interface of the associated Env with be used.
 func WithInterface(ifname string) Option {
@@ -154,6 +194,17 @@ func (d *dnsmasq) Start(ctx context.Context, env *env.Env) error {
 		"port":   "0", // disable DNS
 	}
 
+	if err := d.validateLeaseTimes(); err != nil {
+		return errors.Wrap(err, "invalid DHCP lease times")
+	}
+	leaseTime := defaultLeaseTime
+	if d.leaseTime != 0 {
+		leaseTime = d.leaseTime
+		confVals["t1"] = strconv.Itoa(int(d.t1.Seconds()))
+		confVals["t2"] = strconv.Itoa(int(d.t2.Seconds()))
+	}
+	confVals["lease_time"] = strconv.Itoa(int(leaseTime.Seconds()))
+
 	var gateway net.IP
 	if d.subnet != nil {
 		ip := d.subnet.IP.To4()
@@ -250,6 +301,26 @@ func (d *dnsmasq) Start(ctx context.Context, env *env.Env) error {
 	return nil
 }
 
+// validateLeaseTimes checks the times configured by WithDHCPLeaseTimes.
+func (d *dnsmasq) validateLeaseTimes() error {
+	if d.leaseTime == 0 && d.t1 == 0 && d.t2 == 0 {
+		return nil
+	}
+	if d.subnet == nil {
+		return errors.New("lease times are set but DHCP is not enabled")
+	}
+	if d.t1 <= 0 || d.t1 >= d.t2 || d.t2 >= d.leaseTime {
+		return errors.Errorf("want 0 < T1 < T2 < lease, got T1=%v, T2=%v, lease=%v", d.t1, d.t2, d.leaseTime)
+	}
+	if d.leaseTime < minLeaseTime {
+		return errors.Errorf("lease time %v is shorter than the minimum %v", d.leaseTime, minLeaseTime)
+	}
+	if d.t1%time.Second != 0 || d.t2%time.Second != 0 || d.leaseTime%time.Second != 0 {
+		return errors.Errorf("times must be whole seconds, got T1=%v, T2=%v, lease=%v", d.t1, d.t2, d.leaseTime)
+	}
+	return nil
+}
+
 // Stop stops the dnsmasq process.
 func (d *dnsmasq) Stop(ctx context.Context) error {
 	if d.cmd == nil || d.cmd.Process == nil {
@@ -296,3 +367,102 @@ func (d *dnsmasq) GetLeases(ctx context.Context) ([]lease, error) {
 
 	return leases, nil
 }
+
+// Renewal is a lease renewal observed by dnsmasq.
+type Renewal struct {
+	// Time is the time the renewal was acknowledged, with a precision of
+	// a second.
+	Time time.Time
+	IP   net.IP
+	MAC  string
+}
+
+// GetRenewals returns the lease renewals acknowledged by dnsmasq so far, in
+// order. They are read from the log of dnsmasq: the first DHCPACK sent to a
+// client grants the lease, and the following ones are renewals.
+func (d *dnsmasq) GetRenewals(ctx context.Context) ([]Renewal, error) {
+	s, err := os.ReadFile(d.env.ChrootPath(logPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read log file")
+	}
+
+	now := time.Now()
+	bound := make(map[string]bool)
+	var renewals []Renewal
+	for _, l := range strings.Split(string(s), "\n") {
+		m := ackRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		t, err := parseLogTime(m[1], now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse timestamp of log line: %s", l)
+		}
+		ip := net.ParseIP(m[2])
+		if ip == nil {
+			return nil, errors.Errorf("failed to parse IP of log line: %s", l)
+		}
+		mac := m[3]
+		if !bound[mac] {
+			bound[mac] = true
+			continue
+		}
+		renewals = append(renewals, Renewal{Time: t, IP: ip, MAC: mac})
+	}
+	return renewals, nil
+}
+
+// parseLogTime parses the timestamp ts of a dnsmasq log line. The log
+// timestamps do not have the year, so the year of now is used.
+func parseLogTime(ts string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation("Jan _2 15:04:05", ts, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.AddDate(now.Year(), 0, 0), nil
+}
+
+// DNSQuery is a DNS query received by dnsmasq.
+type DNSQuery struct {
+	// Time is the time the query was received, with a precision of a second.
+	Time time.Time
+	// Name is the queried domain name.
+	Name string
+	// Type is the queried record type, e.g. "A" or "AAAA".
+	Type string
+	// From is the address of the client which sent the query.
+	From net.IP
+}
+
+// GetDNSQueries returns the DNS queries received by dnsmasq so far, in order.
+// They are read from the log of dnsmasq, so the DNS server function must be
+// enabled with WithResolveHost. Tests can use them to check that the client
+// uses the DNS server advertised over DHCP.
+func (d *dnsmasq) GetDNSQueries(ctx context.Context) ([]DNSQuery, error) {
+	if !d.enableDNS {
+		return nil, errors.New("DNS server function is not enabled")
+	}
+	s, err := os.ReadFile(d.env.ChrootPath(logPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read log file")
+	}
+
+	now := time.Now()
+	var queries []DNSQuery
+	for _, l := range strings.Split(string(s), "\n") {
+		m := queryRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		t, err := parseLogTime(m[1], now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse timestamp of log line: %s", l)
+		}
+		from := net.ParseIP(m[4])
+		if from == nil {
+			return nil, errors.Errorf("failed to parse client address of log line: %s", l)
+		}
+		queries = append(queries, DNSQuery{Time: t, Name: m[3], Type: m[2], From: from})
+	}
+	return queries, nil
+}
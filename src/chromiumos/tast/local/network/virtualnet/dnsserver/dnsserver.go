@@ -0,0 +1,358 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package dnsserver provides a DNS server running inside a virtualnet.Env,
+// which answers the queries from a zone supplied by the test. The server only
+// listens on UDP, so the queries over TCP are not answered.
+package dnsserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/network/virtualnet/env"
+)
+
+// defaultPort is the port of the server if none is configured.
+const defaultPort = 53
+
+// defaultTTL is the TTL of the answers of the records without TTL.
+const defaultTTL = 60 * time.Second
+
+// maxCNAMEChain is the maximum number of CNAME records followed in an answer.
+const maxCNAMEChain = 8
+
+// Action is how the server handles the queries for a name.
+type Action int
+
+const (
+	// Answer answers the queries with the record.
+	Answer Action = iota
+	// NXDomain answers the queries with NXDOMAIN.
+	NXDomain
+	// Drop does not answer the queries.
+	Drop
+)
+
+// Record is the entry of a name in the zone of the server.
+type Record struct {
+	// Action is how the queries for the name are handled.
+	Action Action
+	// Delay is how long the server waits before answering the queries.
+	Delay time.Duration
+	// IPs are the addresses of the name, answered to the A queries for the
+	// IPv4 ones and to the AAAA queries for the IPv6 ones.
+	IPs []net.IP
+	// CNAME is the canonical name of the name. If it is set, IPs are ignored
+	// and the queries are answered with a CNAME record, followed by the
+	// records of CNAME if it is in the zone.
+	CNAME string
+	// TTL is the TTL of the answers. If it is zero, defaultTTL is used.
+	TTL time.Duration
+}
+
+// Config contains the options of the DNS server.
+type Config struct {
+	// Port is the UDP port that the server listens on. If it is zero, the
+	// standard DNS port 53 is used.
+	Port int
+	// Zone contains the records keyed by name, e.g. "www.example.com". The
+	// names are case-insensitive. The queries for the other names are
+	// answered with NXDOMAIN.
+	Zone map[string]Record
+}
+
+// Server is a DNS server answering A, AAAA and CNAME queries over UDP only.
+type Server struct {
+	port int
+	env  *env.Env
+	conn net.PacketConn
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// mu protects the fields below, which are also accessed by the goroutines
+	// answering the queries.
+	mu   sync.Mutex
+	zone map[string]Record
+	logs []string
+}
+
+// New creates a new DNS server. The returned object can be passed to
+// Env.StartServer(), its lifetime will be managed by the Env object.
+func New(cfg Config) *Server {
+	s := &Server{port: cfg.Port, zone: make(map[string]Record)}
+	if s.port == 0 {
+		s.port = defaultPort
+	}
+	for name, r := range cfg.Zone {
+		s.zone[canonicalName(name)] = r
+	}
+	return s
+}
+
+// canonicalName returns name in lower case with a trailing dot, as the names
+// in DNS messages.
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// SetRecord sets the record of name, replacing the previous one if any. It can
+// be called at any time, including while the server is running.
+func (s *Server) SetRecord(name string, r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zone[canonicalName(name)] = r
+}
+
+// RemoveRecord removes the record of name, so that its queries are answered
+// with NXDOMAIN.
+func (s *Server) RemoveRecord(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.zone, canonicalName(name))
+}
+
+// Port returns the UDP port that the server listens on.
+func (s *Server) Port() int {
+	return s.port
+}
+
+// Start starts listening for queries inside the netns of e.
+func (s *Server) Start(ctx context.Context, e *env.Env) error {
+	s.env = e
+	if err := s.listen(ctx); err != nil {
+		return err
+	}
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go s.serve()
+	return nil
+}
+
+// listen opens the UDP socket inside the netns of the Env.
+func (s *Server) listen(ctx context.Context) (retErr error) {
+	cleanup, err := s.env.EnterNetNS(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enter the associated netns %s", s.env.NetNSName)
+	}
+	defer func() {
+		if err := cleanup(); err != nil && retErr == nil {
+			s.conn.Close()
+			retErr = errors.Wrapf(err, "failed to go back to the original netns from netns %s", s.env.NetNSName)
+		}
+	}()
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on UDP port %d", s.port)
+	}
+	s.conn = conn
+	return nil
+}
+
+// serve reads the queries until Stop is called, and answers each of them in
+// its own goroutine so that the delayed answers do not block the others.
+func (s *Server) serve() {
+	defer s.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				s.logf("Failed to read query: %v", err)
+			}
+			return
+		}
+		query := append([]byte(nil), buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(query, addr)
+		}()
+	}
+}
+
+// handle answers query received from addr.
+func (s *Server) handle(query []byte, addr net.Addr) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		s.logf("Failed to parse query from %v: %v", addr, err)
+		return
+	}
+	q, err := p.Question()
+	if err != nil {
+		s.logf("Failed to parse question from %v: %v", addr, err)
+		return
+	}
+	name := strings.ToLower(q.Name.String())
+
+	s.mu.Lock()
+	r, ok := s.zone[name]
+	s.mu.Unlock()
+	if !ok {
+		r = Record{Action: NXDomain}
+	}
+	if r.Action == Drop {
+		s.logf("Dropped %v query for %s from %v", q.Type, name, addr)
+		return
+	}
+	if r.Delay > 0 {
+		select {
+		case <-time.After(r.Delay):
+		case <-s.done:
+			return
+		}
+	}
+
+	resp, err := s.buildResponse(hdr, q, r)
+	if err != nil {
+		s.logf("Failed to build response to %v query for %s: %v", q.Type, name, err)
+		return
+	}
+	if _, err := s.conn.WriteTo(resp, addr); err != nil {
+		s.logf("Failed to send response to %v: %v", addr, err)
+		return
+	}
+	s.logf("Answered %v query for %s from %v", q.Type, name, addr)
+}
+
+// buildResponse builds the response to the question q of the query with hdr,
+// which is for a name with the record r.
+func (s *Server) buildResponse(hdr dnsmessage.Header, q dnsmessage.Question, r Record) ([]byte, error) {
+	respHdr := dnsmessage.Header{
+		ID:                 hdr.ID,
+		Response:           true,
+		OpCode:             hdr.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   hdr.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              dnsmessage.RCodeSuccess,
+	}
+	if r.Action == NXDomain {
+		respHdr.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, respHdr)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if r.Action == NXDomain {
+		return b.Finish()
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	name := q.Name
+	for i := 0; i < maxCNAMEChain; i++ {
+		ttl := r.TTL
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		rh := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: uint32(ttl / time.Second)}
+		if r.CNAME == "" {
+			if err := addAddresses(&b, rh, q.Type, r.IPs); err != nil {
+				return nil, err
+			}
+			break
+		}
+		target, err := dnsmessage.NewName(canonicalName(r.CNAME))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CNAME %q", r.CNAME)
+		}
+		if err := b.CNAMEResource(rh, dnsmessage.CNAMEResource{CNAME: target}); err != nil {
+			return nil, err
+		}
+		if q.Type == dnsmessage.TypeCNAME {
+			break
+		}
+		s.mu.Lock()
+		next, ok := s.zone[target.String()]
+		s.mu.Unlock()
+		if !ok || next.Action != Answer {
+			break
+		}
+		name, r = target, next
+	}
+	return b.Finish()
+}
+
+// addAddresses adds the addresses among ips matching the query type t to the
+// answers built by b.
+func addAddresses(b *dnsmessage.Builder, rh dnsmessage.ResourceHeader, t dnsmessage.Type, ips []net.IP) error {
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			if t != dnsmessage.TypeA {
+				continue
+			}
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			if err := b.AResource(rh, a); err != nil {
+				return err
+			}
+		} else if ip16 := ip.To16(); ip16 != nil {
+			if t != dnsmessage.TypeAAAA {
+				continue
+			}
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip16)
+			if err := b.AAAAResource(rh, aaaa); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// logf records a log line, to be written by WriteLogs.
+func (s *Server) logf(format string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, time.Now().Format(time.RFC3339Nano)+" "+fmt.Sprintf(format, args...))
+}
+
+// Stop stops the server and waits for the pending answers to be dropped.
+func (s *Server) Stop(ctx context.Context) error {
+	if s.conn == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.conn.Close()
+	s.wg.Wait()
+	s.conn = nil
+	if err != nil {
+		return errors.Wrap(err, "failed to close UDP socket")
+	}
+	return nil
+}
+
+// WriteLogs writes logs into |f|.
+func (s *Server) WriteLogs(ctx context.Context, f *os.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.logs) == 0 {
+		return nil
+	}
+	if _, err := f.WriteString(strings.Join(s.logs, "\n") + "\n"); err != nil {
+		return errors.Wrap(err, "failed to write logs")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package dnsserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestBuildResponse(t *testing.T) {
+	s := New(Config{Zone: map[string]Record{
+		"www.example.com": {
+			IPs: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+			TTL: 10 * time.Second,
+		},
+		"alias.example.com":    {CNAME: "www.example.com"},
+		"dangling.example.com": {CNAME: "missing.example.com"},
+	}})
+
+	// answer is the expected answer of a response, with the data of A and
+	// AAAA records as strings and the one of CNAME records as the name.
+	type answer struct {
+		name string
+		t    dnsmessage.Type
+		ttl  uint32
+		data string
+	}
+	testcases := []struct {
+		name     string
+		qtype    dnsmessage.Type
+		rcode    dnsmessage.RCode
+		expected []answer
+	}{
+		{
+			name:     "www.example.com.",
+			qtype:    dnsmessage.TypeA,
+			rcode:    dnsmessage.RCodeSuccess,
+			expected: []answer{{"www.example.com.", dnsmessage.TypeA, 10, "192.0.2.1"}},
+		},
+		{
+			name:     "WWW.Example.COM.",
+			qtype:    dnsmessage.TypeAAAA,
+			rcode:    dnsmessage.RCodeSuccess,
+			expected: []answer{{"WWW.Example.COM.", dnsmessage.TypeAAAA, 10, "2001:db8::1"}},
+		},
+		{
+			name:  "nowhere.example.com.",
+			qtype: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:  "alias.example.com.",
+			qtype: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeSuccess,
+			expected: []answer{
+				{"alias.example.com.", dnsmessage.TypeCNAME, 60, "www.example.com."},
+				{"www.example.com.", dnsmessage.TypeA, 10, "192.0.2.1"},
+			},
+		},
+		{
+			name:     "alias.example.com.",
+			qtype:    dnsmessage.TypeCNAME,
+			rcode:    dnsmessage.RCodeSuccess,
+			expected: []answer{{"alias.example.com.", dnsmessage.TypeCNAME, 60, "www.example.com."}},
+		},
+		{
+			name:     "dangling.example.com.",
+			qtype:    dnsmessage.TypeA,
+			rcode:    dnsmessage.RCodeSuccess,
+			expected: []answer{{"dangling.example.com.", dnsmessage.TypeCNAME, 60, "missing.example.com."}},
+		},
+	}
+	for i, tc := range testcases {
+		hdr := dnsmessage.Header{ID: uint16(i + 1), RecursionDesired: true}
+		q := dnsmessage.Question{Name: dnsmessage.MustNewName(tc.name), Type: tc.qtype, Class: dnsmessage.ClassINET}
+		r, ok := s.zone[canonicalName(tc.name)]
+		if !ok {
+			r = Record{Action: NXDomain}
+		}
+		b, err := s.buildResponse(hdr, q, r)
+		if err != nil {
+			t.Errorf("case#%d failed to build response: %v", i, err)
+			continue
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(b); err != nil {
+			t.Errorf("case#%d failed to parse response: %v", i, err)
+			continue
+		}
+		if msg.ID != hdr.ID || !msg.Response || !msg.RecursionDesired {
+			t.Errorf("case#%d got unexpected header %+v", i, msg.Header)
+		}
+		if msg.RCode != tc.rcode {
+			t.Errorf("case#%d got rcode %v, want %v", i, msg.RCode, tc.rcode)
+		}
+		if len(msg.Questions) != 1 || msg.Questions[0] != q {
+			t.Errorf("case#%d got questions %v, want [%v]", i, msg.Questions, q)
+		}
+		var got []answer
+		for _, rr := range msg.Answers {
+			a := answer{name: rr.Header.Name.String(), t: rr.Header.Type, ttl: rr.Header.TTL}
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				a.data = net.IP(body.A[:]).String()
+			case *dnsmessage.AAAAResource:
+				a.data = net.IP(body.AAAA[:]).String()
+			case *dnsmessage.CNAMEResource:
+				a.data = body.CNAME.String()
+			}
+			got = append(got, a)
+		}
+		if len(got) != len(tc.expected) {
+			t.Errorf("case#%d got answers %v, want %v", i, got, tc.expected)
+			continue
+		}
+		for j := range got {
+			if got[j] != tc.expected[j] {
+				t.Errorf("case#%d got answers %v, want %v", i, got, tc.expected)
+				break
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ package env
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
@@ -52,6 +53,12 @@ type Env struct {
 	netJailArgs  []string
 	netnsCreated bool
 	servers      map[string]server
+	// arpSilenced is set while the neighbor solicitations on VethInName are not
+	// answered, see SetGatewayARPResponding.
+	arpSilenced bool
+	// impaired is set while a netem qdisc is installed on VethInName, see
+	// SetLinkImpairment.
+	impaired bool
 }
 
 // A server represents a process (or processes for the same functionality)
@@ -606,6 +613,99 @@ func (e *Env) ConfigureInterface(ctx context.Context, ifname string, addr net.IP
 	return nil
 }
 
+// Route represents an entry in the main routing table of the netns.
+type Route struct {
+	// Dst is the destination prefix of the route. It is nil for the default
+	// route.
+	Dst *net.IPNet
+	// Gateway is the next hop of the route. It is nil for on-link routes.
+	Gateway net.IP
+	// Dev is the name of the outgoing interface.
+	Dev string
+	// Metric is the metric of the route.
+	Metric int
+	// IPv6 is true if this is an IPv6 route.
+	IPv6 bool
+}
+
+// IsDefault returns whether r is a default route.
+func (r *Route) IsDefault() bool {
+	return r.Dst == nil
+}
+
+// String returns a human-readable representation of r, similar to the output
+// of `ip route`.
+func (r *Route) String() string {
+	dst := "default"
+	if r.Dst != nil {
+		dst = r.Dst.String()
+	}
+	s := dst
+	if r.Gateway != nil {
+		s += " via " + r.Gateway.String()
+	}
+	return fmt.Sprintf("%s dev %s metric %d", s, r.Dev, r.Metric)
+}
+
+// GetRoutes returns the IPv4 and IPv6 routes in the main routing table inside
+// the netns of this Env.
+func (e *Env) GetRoutes(ctx context.Context) ([]*Route, error) {
+	var ret []*Route
+	for _, family := range []string{"-4", "-6"} {
+		o, err := testexec.CommandContext(ctx, "ip", "netns", "exec", e.NetNSName, "ip", family, "-json", "route", "show", "table", "main").Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dump %s routes in netns %s", family, e.NetNSName)
+		}
+		routes, err := parseRoutes(o, family == "-6")
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s routes in netns %s", family, e.NetNSName)
+		}
+		ret = append(ret, routes...)
+	}
+	return ret, nil
+}
+
+// parseRoutes parses the JSON output of `ip route show`.
+func parseRoutes(b []byte, ipv6 bool) ([]*Route, error) {
+	var entries []struct {
+		Dst     string `json:"dst"`
+		Gateway string `json:"gateway"`
+		Dev     string `json:"dev"`
+		Metric  int    `json:"metric"`
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal routes")
+	}
+
+	var ret []*Route
+	for _, entry := range entries {
+		r := &Route{Dev: entry.Dev, Metric: entry.Metric, IPv6: ipv6}
+		if entry.Dst != "default" {
+			dst := entry.Dst
+			// Host routes are printed without the prefix length.
+			if !strings.Contains(dst, "/") {
+				if ipv6 {
+					dst += "/128"
+				} else {
+					dst += "/32"
+				}
+			}
+			_, ipnet, err := net.ParseCIDR(dst)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse destination %s", entry.Dst)
+			}
+			r.Dst = ipnet
+		}
+		if entry.Gateway != "" {
+			if r.Gateway = net.ParseIP(entry.Gateway); r.Gateway == nil {
+				return nil, errors.Errorf("failed to parse gateway %s", entry.Gateway)
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
 // isLink returns whether path is a symbolic link.
 func isLink(path string) bool {
 	if !assureExists(path) {
@@ -631,3 +731,100 @@ func assureExists(path string) bool {
 	}
 	return true
 }
+
+// SetGatewayARPResponding sets whether this Env answers the ARP requests and
+// IPv6 neighbor solicitations received on VethInName. When this Env acts as a
+// router, disabling the responses makes the gateway unreachable at L2 for the
+// clients, while the link stays up. The neighbor entries already cached by the
+// clients are not affected until they expire. The responses are also restored
+// when the Env is cleaned up, since the netns is removed.
+func (e *Env) SetGatewayARPResponding(ctx context.Context, responding bool) error {
+	if e.arpSilenced == !responding {
+		return nil
+	}
+	arp, op := "off", "-I"
+	if responding {
+		arp, op = "on", "-D"
+	}
+	if err := e.RunWithoutChroot(ctx, "ip", "link", "set", e.VethInName, "arp", arp); err != nil {
+		return errors.Wrapf(err, "failed to turn ARP %s on %s", arp, e.VethInName)
+	}
+	if err := e.RunWithoutChroot(ctx, "ip6tables", "-w", op, "INPUT", "-i", e.VethInName,
+		"-p", "ipv6-icmp", "--icmpv6-type", "neighbour-solicitation", "-j", "DROP"); err != nil {
+		return errors.Wrapf(err, "failed to update the neighbor solicitation rule on %s", e.VethInName)
+	}
+	e.arpSilenced = !responding
+	return nil
+}
+
+// Impairment describes the degradation of a link applied by SetLinkImpairment.
+type Impairment struct {
+	// Loss is the percentage of packets dropped, from 0 to 100.
+	Loss float64
+	// Delay is the latency added to each packet, and Jitter is the random
+	// variation of this latency.
+	Delay  time.Duration
+	Jitter time.Duration
+	// Reorder is the percentage of packets sent immediately, i.e. before the
+	// delayed packets, from 0 to 100. It requires Delay to be set.
+	Reorder float64
+}
+
+// netemArgs returns the arguments of the tc netem qdisc applying i.
+func (i *Impairment) netemArgs() ([]string, error) {
+	if i.Loss < 0 || i.Loss > 100 || i.Reorder < 0 || i.Reorder > 100 {
+		return nil, errors.Errorf("invalid percentages: loss %v, reorder %v", i.Loss, i.Reorder)
+	}
+	if i.Delay < 0 || i.Jitter < 0 {
+		return nil, errors.Errorf("invalid durations: delay %v, jitter %v", i.Delay, i.Jitter)
+	}
+	if i.Delay == 0 && (i.Jitter > 0 || i.Reorder > 0) {
+		return nil, errors.New("jitter and reorder require delay to be set")
+	}
+	args := []string{"netem"}
+	if i.Delay > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", i.Delay.Microseconds()))
+		if i.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", i.Jitter.Microseconds()))
+		}
+	}
+	if i.Loss > 0 {
+		args = append(args, "loss", fmt.Sprintf("%g%%", i.Loss))
+	}
+	if i.Reorder > 0 {
+		args = append(args, "reorder", fmt.Sprintf("%g%%", i.Reorder))
+	}
+	return args, nil
+}
+
+// SetLinkImpairment applies cfg with a tc netem qdisc on VethInName, i.e. to
+// the packets sent by this Env to the other end of the link. Calling it again
+// replaces the previous impairment rather than stacking them. The impairment
+// is removed by ClearLinkImpairment, or when the Env is cleaned up since the
+// netns is removed.
+func (e *Env) SetLinkImpairment(ctx context.Context, cfg Impairment) error {
+	netem, err := cfg.netemArgs()
+	if err != nil {
+		return errors.Wrap(err, "invalid impairment")
+	}
+	args := append([]string{"tc", "qdisc", "replace", "dev", e.VethInName, "root"}, netem...)
+	if err := e.RunWithoutChroot(ctx, args...); err != nil {
+		return errors.Wrapf(err, "failed to set impairment on %s", e.VethInName)
+	}
+	e.impaired = true
+	testing.ContextLogf(ctx, "Impaired %s in netns %s with %s", e.VethInName, e.NetNSName, strings.Join(netem, " "))
+	return nil
+}
+
+// ClearLinkImpairment removes the impairment applied by SetLinkImpairment. It
+// is a no-op if no impairment is applied.
+func (e *Env) ClearLinkImpairment(ctx context.Context) error {
+	if !e.impaired {
+		return nil
+	}
+	if err := e.RunWithoutChroot(ctx, "tc", "qdisc", "del", "dev", e.VethInName, "root"); err != nil {
+		return errors.Wrapf(err, "failed to clear impairment on %s", e.VethInName)
+	}
+	e.impaired = false
+	return nil
+}
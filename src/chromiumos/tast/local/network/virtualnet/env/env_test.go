@@ -0,0 +1,83 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package env
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", s, err)
+	}
+	return ipnet
+}
+
+func TestParseRoutes(t *testing.T) {
+	testcases := []struct {
+		input      string
+		ipv6       bool
+		expected   []*Route
+		shouldFail bool
+	}{
+		{
+			input:    `[]`,
+			expected: nil,
+		},
+		{
+			input: `[{"dst":"default","gateway":"192.168.1.1","dev":"eth0","protocol":"dhcp","metric":100,"flags":[]},` +
+				`{"dst":"192.168.1.0/24","dev":"eth0","protocol":"kernel","scope":"link","prefsrc":"192.168.1.2","flags":[]},` +
+				`{"dst":"10.0.0.1","gateway":"192.168.1.254","dev":"eth0","flags":[]}]`,
+			expected: []*Route{
+				{Gateway: net.ParseIP("192.168.1.1"), Dev: "eth0", Metric: 100},
+				{Dst: mustParseCIDR(t, "192.168.1.0/24"), Dev: "eth0"},
+				{Dst: mustParseCIDR(t, "10.0.0.1/32"), Gateway: net.ParseIP("192.168.1.254"), Dev: "eth0"},
+			},
+		},
+		{
+			input: `[{"dst":"default","gateway":"fe80::1","dev":"eth0","protocol":"ra","metric":1024,"pref":"medium","flags":[]},` +
+				`{"dst":"fd00:1::/64","dev":"eth0","protocol":"kernel","metric":256,"pref":"medium","flags":[]},` +
+				`{"dst":"fd00:2::1","gateway":"fe80::2","dev":"eth0","metric":1024,"flags":[]}]`,
+			ipv6: true,
+			expected: []*Route{
+				{Gateway: net.ParseIP("fe80::1"), Dev: "eth0", Metric: 1024, IPv6: true},
+				{Dst: mustParseCIDR(t, "fd00:1::/64"), Dev: "eth0", Metric: 256, IPv6: true},
+				{Dst: mustParseCIDR(t, "fd00:2::1/128"), Gateway: net.ParseIP("fe80::2"), Dev: "eth0", Metric: 1024, IPv6: true},
+			},
+		},
+		{
+			input:      `not json`,
+			shouldFail: true,
+		},
+		{
+			input:      `[{"dst":"192.168.1.300/24","dev":"eth0"}]`,
+			shouldFail: true, // due to invalid destination.
+		},
+		{
+			input:      `[{"dst":"default","gateway":"invalid","dev":"eth0"}]`,
+			shouldFail: true, // due to invalid gateway.
+		},
+	}
+	for i, tc := range testcases {
+		routes, err := parseRoutes([]byte(tc.input), tc.ipv6)
+		if tc.shouldFail {
+			if err == nil {
+				t.Errorf("case#%d should fail but succeeded", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case#%d failed with err=%v", i, err)
+			continue
+		}
+		if diff := cmp.Diff(routes, tc.expected); diff != "" {
+			t.Errorf("case#%d got unexpected routes (-got +want):\n%s", i, diff)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
 
 	"chromiumos/tast/errors"
 	"chromiumos/tast/local/network/virtualnet/certs"
@@ -32,6 +33,46 @@ type httpServer struct {
 	handle     func(rw http.ResponseWriter, req *http.Request)
 	server     *http.Server
 	env        *env.Env
+
+	// addrMu protects addr, which is set by the goroutine serving requests.
+	addrMu sync.Mutex
+	addr   net.Addr
+}
+
+// Response is a canned response of the HTTP server.
+type Response struct {
+	// Status is the HTTP status code, e.g. http.StatusFound. If it is 0,
+	// http.StatusOK is used.
+	Status int
+	// Header contains the header fields added to the response, e.g.
+	// "Location" for redirects.
+	Header http.Header
+	// Body is the body of the response.
+	Body string
+}
+
+// ResponsesHandler returns a handler responding to the requests with the
+// entry of responses keyed by the path of the request, e.g. "/generate_204".
+// The requests to other paths are answered with http.StatusNotFound.
+func ResponsesHandler(responses map[string]Response) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		resp, ok := responses[req.URL.Path]
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				rw.Header().Add(k, v)
+			}
+		}
+		status := resp.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		rw.WriteHeader(status)
+		rw.Write([]byte(resp.Body))
+	}
 }
 
 // Handler creates the object to handle the response for the HTTP server.
@@ -53,6 +94,23 @@ func New(port string, handle func(rw http.ResponseWriter, req *http.Request), ht
 	return &httpServer{port: port, handle: handle, httpsCerts: httpsCerts}
 }
 
+// NewWithResponses creates a new httpServer object serving HTTP on |port|
+// with the canned responses keyed by path, see ResponsesHandler. This is
+// useful to simulate a captive portal, e.g. by redirecting the portal
+// detection probes. The returned object can be passed to Env.StartServer(),
+// its lifetime will be managed by the Env object.
+func NewWithResponses(port string, responses map[string]Response) *httpServer {
+	return New(port, ResponsesHandler(responses), nil)
+}
+
+// Addr returns the address the HTTP server listens on, which tells the actual
+// port if |port| was "0". It returns nil if the server is not started.
+func (h *httpServer) Addr() net.Addr {
+	h.addrMu.Lock()
+	defer h.addrMu.Unlock()
+	return h.addr
+}
+
 // Start starts the HTTP server in a separate process. The HTTP server listens on
 // any IPv4 and IPv6 address within the namespace. If |httpsCerts| is not nil,
 // the server will serve HTTPS.
@@ -74,6 +132,9 @@ func (h *httpServer) Start(ctx context.Context, env *env.Env) (retErr error) {
 			errChannel <- err
 			return
 		}
+		h.addrMu.Lock()
+		h.addr = ln.Addr()
+		h.addrMu.Unlock()
 		if h.httpsCerts != nil {
 			errChannel <- nil
 			if err := h.server.ServeTLS(ln, h.httpsCerts.GetTestServerCertFilePath(), h.httpsCerts.GetTestServerKeyFilePath()); err != http.ErrServerClosed {
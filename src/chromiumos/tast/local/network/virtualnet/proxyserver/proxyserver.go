@@ -0,0 +1,330 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package proxyserver provides a forward HTTP proxy running inside a
+// virtualnet.Env.
+package proxyserver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/network/virtualnet/env"
+	"chromiumos/tast/testing"
+)
+
+// PACPath is the path on which the PAC file is served if Config.PACScript is set.
+const PACPath = "/proxy.pac"
+
+// dialTimeout is the timeout for connecting to the upstream server.
+const dialTimeout = 10 * time.Second
+
+// Config contains the options of the proxy server.
+type Config struct {
+	// Port is the port that the proxy listens on. If it is zero, an ephemeral
+	// port is used, see Server.Addr.
+	Port int
+	// Username and Password are the credentials required by the proxy with
+	// Basic authentication. If Username is empty, no authentication is required.
+	Username string
+	Password string
+	// PACScript is the content of a PAC file. If it is set, the proxy serves it
+	// on PACPath to non-proxy requests.
+	PACScript string
+}
+
+// Request is a request handled by the proxy.
+type Request struct {
+	// Method is the HTTP method of the request, e.g. "GET" or "CONNECT".
+	Method string
+	// Host is the host (and port if any) of the destination.
+	Host string
+	// Status is the HTTP status returned by the proxy, or by the destination if
+	// the request was forwarded.
+	Status int
+}
+
+// Server is a forward HTTP proxy. It supports plain HTTP requests and
+// tunneling with CONNECT.
+type Server struct {
+	cfg    Config
+	server *http.Server
+	env    *env.Env
+
+	// addr is the address that the proxy listens on.
+	addr net.Addr
+
+	// dialReqs sends the dial requests to the goroutine which runs in the netns.
+	dialReqs chan dialRequest
+	dialDone chan struct{}
+	// done is closed by Stop, so that no more dial requests are sent.
+	done chan struct{}
+
+	mu       sync.Mutex
+	requests []Request
+	// tunnels are the connections of the CONNECT tunnels, which are hijacked
+	// from the HTTP server and thus closed by Stop.
+	tunnels map[net.Conn]struct{}
+	stopped bool
+}
+
+type dialRequest struct {
+	network, addr string
+	result        chan dialResult
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// New creates a new proxy server. The returned object can be passed to
+// Env.StartServer(), its lifetime will be managed by the Env object.
+func New(cfg Config) *Server {
+	return &Server{cfg: cfg}
+}
+
+// Start starts the proxy server. The proxy listens on any IPv4 and IPv6 address
+// within the netns of e, and the connections to the destinations are also made
+// from it.
+func (s *Server) Start(ctx context.Context, e *env.Env) error {
+	s.env = e
+	s.server = &http.Server{Addr: fmt.Sprintf(":%d", s.cfg.Port), Handler: http.HandlerFunc(s.handle)}
+	s.dialReqs = make(chan dialRequest)
+	s.dialDone = make(chan struct{})
+	s.done = make(chan struct{})
+	s.tunnels = make(map[net.Conn]struct{})
+
+	// Sockets are created in the netns of the calling thread, so the listening
+	// socket and all the upstream connections are created on a goroutine locked
+	// in the netns.
+	errChannel := make(chan error)
+	lnChannel := make(chan net.Listener)
+	go func() {
+		defer close(s.dialDone)
+		cleanup, err := s.env.EnterNetNS(ctx)
+		if err != nil {
+			errChannel <- errors.Wrapf(err, "failed to enter the associated netns %s", s.env.NetNSName)
+			return
+		}
+		defer cleanup()
+		ln, err := net.Listen("tcp", s.server.Addr)
+		if err != nil {
+			errChannel <- err
+			return
+		}
+		lnChannel <- ln
+		for {
+			select {
+			case req := <-s.dialReqs:
+				conn, err := net.DialTimeout(req.network, req.addr, dialTimeout)
+				req.result <- dialResult{conn, err}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errChannel:
+		return err
+	case ln := <-lnChannel:
+		s.addr = ln.Addr()
+		go func() {
+			if err := s.server.Serve(ln); err != http.ErrServerClosed {
+				testing.ContextLog(ctx, "Proxy server failed with err: ", err)
+			}
+		}()
+		return nil
+	}
+}
+
+// Addr returns the address that the proxy listens on, e.g. to find the port
+// chosen if Config.Port is zero. It is only valid after the proxy is started.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Stop stops the proxy server and closes the CONNECT tunnels.
+func (s *Server) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	// The handlers still running after Shutdown returns on ctx expiry fail
+	// to dial once done is closed, instead of blocking.
+	close(s.done)
+	err := s.server.Shutdown(ctx)
+	<-s.dialDone
+	s.mu.Lock()
+	s.stopped = true
+	for conn := range s.tunnels {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// WriteLogs writes the requests handled by the proxy into f.
+func (s *Server) WriteLogs(ctx context.Context, f *os.File) error {
+	for _, r := range s.Requests() {
+		if _, err := fmt.Fprintf(f, "%s %s %d\n", r.Method, r.Host, r.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Requests returns the requests handled by the proxy so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) record(req *http.Request, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: req.Method, Host: req.Host, Status: status})
+}
+
+// addTunnel registers conn as a connection of a CONNECT tunnel, to be closed
+// by Stop. It returns false, after closing conn, if the proxy is stopped.
+func (s *Server) addTunnel(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		conn.Close()
+		return false
+	}
+	s.tunnels[conn] = struct{}{}
+	return true
+}
+
+// removeTunnel closes conn and unregisters it.
+func (s *Server) removeTunnel(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn.Close()
+	delete(s.tunnels, conn)
+}
+
+func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	req := dialRequest{network: network, addr: addr, result: make(chan dialResult, 1)}
+	select {
+	case s.dialReqs <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, errors.New("proxy server is stopped")
+	}
+	res := <-req.result
+	return res.conn, res.err
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	if s.cfg.Username == "" {
+		return true
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(s.cfg.Username+":"+s.cfg.Password))
+	return req.Header.Get("Proxy-Authorization") == want
+}
+
+func (s *Server) handle(rw http.ResponseWriter, req *http.Request) {
+	// Requests which are not for the proxy have a relative URL.
+	if req.Method != http.MethodConnect && !req.URL.IsAbs() {
+		if s.cfg.PACScript != "" && req.URL.Path == PACPath {
+			rw.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+			io.WriteString(rw, s.cfg.PACScript)
+			s.record(req, http.StatusOK)
+			return
+		}
+		http.NotFound(rw, req)
+		s.record(req, http.StatusNotFound)
+		return
+	}
+	if !s.authorized(req) {
+		rw.Header().Set("Proxy-Authenticate", `Basic realm="virtualnet"`)
+		rw.WriteHeader(http.StatusProxyAuthRequired)
+		s.record(req, http.StatusProxyAuthRequired)
+		return
+	}
+	if req.Method == http.MethodConnect {
+		s.handleConnect(rw, req)
+		return
+	}
+	s.handleForward(rw, req)
+}
+
+// handleConnect tunnels the connection to the destination.
+func (s *Server) handleConnect(rw http.ResponseWriter, req *http.Request) {
+	dst, err := s.dial(req.Context(), "tcp", req.Host)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		s.record(req, http.StatusBadGateway)
+		return
+	}
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		dst.Close()
+		http.Error(rw, "hijacking not supported", http.StatusInternalServerError)
+		s.record(req, http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	src, _, err := hj.Hijack()
+	if err != nil {
+		dst.Close()
+		s.record(req, http.StatusInternalServerError)
+		return
+	}
+	s.record(req, http.StatusOK)
+	if !s.addTunnel(dst) {
+		src.Close()
+		return
+	}
+	if !s.addTunnel(src) {
+		s.removeTunnel(dst)
+		return
+	}
+	go func() {
+		defer s.removeTunnel(dst)
+		defer s.removeTunnel(src)
+		go io.Copy(dst, src)
+		io.Copy(src, dst)
+	}()
+}
+
+// handleForward forwards a plain HTTP request to the destination.
+func (s *Server) handleForward(rw http.ResponseWriter, req *http.Request) {
+	transport := &http.Transport{DialContext: s.dial}
+	defer transport.CloseIdleConnections()
+
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Authorization")
+	out.Header.Del("Proxy-Connection")
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		s.record(req, http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			rw.Header().Add(k, v)
+		}
+	}
+	rw.WriteHeader(resp.StatusCode)
+	io.Copy(rw, resp.Body)
+	s.record(req, resp.StatusCode)
+}
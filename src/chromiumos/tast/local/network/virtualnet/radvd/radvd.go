@@ -15,6 +15,7 @@ import (
 	"os"
 	"strings"
 	"text/template"
+	"time"
 
 	"chromiumos/tast/common/testexec"
 	"chromiumos/tast/errors"
@@ -22,14 +23,22 @@ import (
 )
 
 const confTemplate = `
-interface {{.ifname}} {
+interface {{.Ifname}} {
 	MinRtrAdvInterval 3;
 	MaxRtrAdvInterval 4;
 	AdvSendAdvert on;
-	AdvManagedFlag on;
-	prefix {{.prefix}} {};
-	{{if .dns}}
-	RDNSS {{.dns}} {};
+	AdvManagedFlag {{if .Managed}}on{{else}}off{{end}};
+	AdvOtherConfigFlag {{if .Other}}on{{else}}off{{end}};
+	{{range .Prefixes}}
+	prefix {{.Prefix}} {
+		{{if .Lifetimes}}
+		AdvValidLifetime {{.Valid}};
+		AdvPreferredLifetime {{.Preferred}};
+		{{end}}
+	};
+	{{end}}
+	{{if .DNS}}
+	RDNSS {{.DNS}} {};
 	{{end}}
 };`
 
@@ -41,33 +50,108 @@ const (
 	logPath   = "/tmp/radvd.log"
 )
 
+// Prefix is a prefix advertised by radvd.
+type Prefix struct {
+	// Prefix is the advertised prefix, which is usually a /64.
+	Prefix *net.IPNet
+	// ValidLifetime and PreferredLifetime are the lifetimes of the prefix,
+	// rounded down to seconds. If ValidLifetime is zero, the defaults of
+	// radvd are used for both. A PreferredLifetime of zero with a non-zero
+	// ValidLifetime advertises a deprecated prefix.
+	ValidLifetime     time.Duration
+	PreferredLifetime time.Duration
+}
+
+// Config contains the options of the RAs sent by radvd.
+type Config struct {
+	// Prefixes are the prefixes advertised in the RAs. There must be at
+	// least one.
+	Prefixes []Prefix
+	// ManagedFlag and OtherConfigFlag are the M and O flags of the RAs,
+	// which tell the hosts to use DHCPv6 for addresses and for other
+	// configuration respectively.
+	ManagedFlag     bool
+	OtherConfigFlag bool
+	// RDNSS are the addresses of the DNS servers advertised in the RAs.
+	RDNSS []string
+}
+
+// validate returns an error if c is not a valid config.
+func (c *Config) validate() error {
+	if len(c.Prefixes) == 0 {
+		return errors.New("no prefix to advertise")
+	}
+	for _, p := range c.Prefixes {
+		if p.Prefix == nil || p.Prefix.IP.To4() != nil {
+			return errors.Errorf("invalid IPv6 prefix %v", p.Prefix)
+		}
+		if p.ValidLifetime < 0 || p.PreferredLifetime < 0 || (p.ValidLifetime != 0 && p.PreferredLifetime > p.ValidLifetime) {
+			return errors.Errorf("invalid lifetimes of prefix %v: valid %v, preferred %v", p.Prefix, p.ValidLifetime, p.PreferredLifetime)
+		}
+	}
+	return nil
+}
+
 type radvd struct {
-	env    *env.Env
-	prefix *net.IPNet
-	dns    []string
-	cmd    *testexec.Cmd
+	env *env.Env
+	cfg Config
+	cmd *testexec.Cmd
 }
 
-// New creates a new radvd object. The returned object can be passed to
+// New creates a new radvd object advertising prefix and the DNS servers dns,
+// with the M flag set. The returned object can be passed to
 // Env.StartServer(), its lifetime will be managed by the Env object.
 func New(prefix *net.IPNet, dns []string) *radvd {
-	return &radvd{prefix: prefix, dns: dns}
+	return NewWithConfig(Config{
+		Prefixes:    []Prefix{{Prefix: prefix}},
+		ManagedFlag: true,
+		RDNSS:       dns,
+	})
+}
+
+// NewWithConfig creates a new radvd object sending the RAs configured by cfg.
+// The returned object can be passed to Env.StartServer(), its lifetime will be
+// managed by the Env object.
+func NewWithConfig(cfg Config) *radvd {
+	return &radvd{cfg: cfg}
 }
 
 // Start starts the radvd process.
 func (r *radvd) Start(ctx context.Context, env *env.Env) error {
 	r.env = env
+	if err := r.cfg.validate(); err != nil {
+		return errors.Wrap(err, "invalid radvd config")
+	}
 
 	// Prepare config file.
-	confVals := map[string]string{
-		"ifname": r.env.VethInName,
-		"prefix": r.prefix.String(),
+	type prefixVals struct {
+		Prefix           string
+		Lifetimes        bool
+		Valid, Preferred int64
+	}
+	confVals := struct {
+		Ifname         string
+		Managed, Other bool
+		Prefixes       []prefixVals
+		DNS            string
+	}{
+		Ifname:  r.env.VethInName,
+		Managed: r.cfg.ManagedFlag,
+		Other:   r.cfg.OtherConfigFlag,
+		DNS:     strings.Join(r.cfg.RDNSS, " "),
 	}
-	if len(r.dns) > 0 {
-		confVals["dns"] = strings.Join(r.dns, ",")
+	for _, p := range r.cfg.Prefixes {
+		confVals.Prefixes = append(confVals.Prefixes, prefixVals{
+			Prefix:    p.Prefix.String(),
+			Lifetimes: p.ValidLifetime != 0,
+			Valid:     int64(p.ValidLifetime / time.Second),
+			Preferred: int64(p.PreferredLifetime / time.Second),
+		})
 	}
 	b := &bytes.Buffer{}
-	template.Must(template.New("").Parse(confTemplate)).Execute(b, confVals)
+	if err := template.Must(template.New("").Parse(confTemplate)).Execute(b, confVals); err != nil {
+		return errors.Wrap(err, "failed to generate config file")
+	}
 	if err := ioutil.WriteFile(r.env.ChrootPath(confPath), []byte(b.String()), 0644); err != nil {
 		return errors.Wrap(err, "failed to write config file")
 	}
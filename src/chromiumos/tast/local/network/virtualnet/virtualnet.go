@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"chromiumos/tast/common/shillconst"
@@ -20,8 +21,10 @@ import (
 	"chromiumos/tast/errors"
 	"chromiumos/tast/local/network/virtualnet/certs"
 	"chromiumos/tast/local/network/virtualnet/dnsmasq"
+	"chromiumos/tast/local/network/virtualnet/dnsserver"
 	"chromiumos/tast/local/network/virtualnet/env"
 	"chromiumos/tast/local/network/virtualnet/httpserver"
+	"chromiumos/tast/local/network/virtualnet/proxyserver"
 	"chromiumos/tast/local/network/virtualnet/radvd"
 	"chromiumos/tast/local/network/virtualnet/subnet"
 	"chromiumos/tast/local/shill"
@@ -48,6 +51,11 @@ type EnvOptions struct {
 	// RAServer enables the RA server in the Env. IPv6 addresses can be obtained
 	// on the interface by SLAAC.
 	RAServer bool
+	// RAConfig configures the RAs sent by the RA server, and enables it even
+	// if RAServer is false. The prefixes without Prefix set are allocated from
+	// the pool, and a DNS server is advertised if RDNSS is empty. If it is nil,
+	// a single allocated prefix is advertised with the M flag set.
+	RAConfig *RAConfig
 	// HTTPServerResponseHandler is the handler function for the HTTP server
 	// to customize how the server should respond to requests. If the handler is
 	// set, then this enables the HTTP server in the Env.
@@ -178,17 +186,31 @@ func startServersInRouter(ctx context.Context, router *env.Env, pool *subnet.Poo
 		}
 	}
 
-	if opts.RAServer {
-		v6Prefix, err := pool.AllocNextIPv6Subnet()
-		if err != nil {
-			return errors.Wrap(err, "failed to allocate v4 prefix for DHCP")
+	if opts.RAServer || opts.RAConfig != nil {
+		cfg := RAConfig{Prefixes: []radvd.Prefix{{}}, ManagedFlag: true}
+		if opts.RAConfig != nil {
+			cfg = *opts.RAConfig
+			cfg.Prefixes = append([]radvd.Prefix(nil), cfg.Prefixes...)
+		}
+		for i := range cfg.Prefixes {
+			if cfg.Prefixes[i].Prefix != nil {
+				continue
+			}
+			v6Prefix, err := pool.AllocNextIPv6Subnet()
+			if err != nil {
+				return errors.Wrap(err, "failed to allocate v6 prefix for RA")
+			}
+			cfg.Prefixes[i].Prefix = v6Prefix
 		}
 
 		// Note that in the current implementation, shill requires an IPv6
 		// connection has both address and DNS servers, and thus we need to provide
 		// it here even though it is not reachable.
 		const googleIPv6DNSServer = "2001:4860:4860::8888"
-		radvd := radvd.New(v6Prefix, []string{googleIPv6DNSServer})
+		if len(cfg.RDNSS) == 0 {
+			cfg.RDNSS = []string{googleIPv6DNSServer}
+		}
+		radvd := radvd.NewWithConfig(cfg)
 		if err := router.StartServer(ctx, "radvd", radvd); err != nil {
 			return errors.Wrap(err, "failed to start radvd")
 		}
@@ -214,6 +236,52 @@ func startServersInRouter(ctx context.Context, router *env.Env, pool *subnet.Poo
 	return nil
 }
 
+// RAConfig contains the options of the RA server enabled by
+// EnvOptions.RAConfig.
+type RAConfig = radvd.Config
+
+// DNSConfig contains the options of the DNS server started by StartDNSServer.
+type DNSConfig = dnsserver.Config
+
+// dnsServerCount is the number of DNS servers started by StartDNSServer, used
+// to give each of them a unique name.
+var dnsServerCount int32
+
+// StartDNSServer starts a DNS server in the netns of e, answering the queries
+// from the zone of cfg. The server listens on UDP port 53 unless cfg.Port is
+// set, and does not answer the queries over TCP. The zone can be changed while
+// the server is running with the returned server. The server is stopped and
+// its query log is collected when e is cleaned up.
+func StartDNSServer(ctx context.Context, e *env.Env, cfg DNSConfig) (*dnsserver.Server, error) {
+	server := dnsserver.New(cfg)
+	name := fmt.Sprintf("dnsserver%d", atomic.AddInt32(&dnsServerCount, 1))
+	if err := e.StartServer(ctx, name, server); err != nil {
+		return nil, errors.Wrap(err, "failed to start dns server")
+	}
+	return server, nil
+}
+
+// ProxyConfig contains the options of the HTTP proxy started by StartHTTPProxy.
+type ProxyConfig = proxyserver.Config
+
+// httpProxyCount is the number of HTTP proxies started by StartHTTPProxy, used
+// to give each of them a unique name.
+var httpProxyCount int32
+
+// StartHTTPProxy starts a forward HTTP proxy in the netns of e. The proxy
+// optionally requires Basic authentication and serves a PAC file, as configured
+// by cfg. The returned server can be used to inspect the requests which went
+// through the proxy, and its Addr method tells the address it listens on. The
+// proxy is stopped and its request log is collected when e is cleaned up.
+func StartHTTPProxy(ctx context.Context, e *env.Env, cfg ProxyConfig) (*proxyserver.Server, error) {
+	proxy := proxyserver.New(cfg)
+	name := fmt.Sprintf("httpproxy%d", atomic.AddInt32(&httpProxyCount, 1))
+	if err := e.StartServer(ctx, name, proxy); err != nil {
+		return nil, errors.Wrap(err, "failed to start http proxy")
+	}
+	return proxy, nil
+}
+
 func findEthernetServiceByIfName(ctx context.Context, m *shill.Manager, ifName string) (*shill.Service, error) {
 	testing.ContextLogf(ctx, "Waiting for device %s showing up", ifName)
 	device, err := m.WaitForDeviceByName(ctx, ifName, 5*time.Second)
@@ -0,0 +1,102 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+	"chromiumos/tast/testing"
+)
+
+// usbDevicesDir is the sysfs directory listing the USB devices and interfaces.
+const usbDevicesDir = "/sys/bus/usb/devices"
+
+// Interface class, subclass and protocol of IPP-over-USB interfaces, as
+// defined by the IPP-over-USB specification.
+const (
+	ippUSBClass    = "07"
+	ippUSBSubClass = "01"
+	ippUSBProtocol = "04"
+)
+
+// minIPPUSBInterfaces is the number of IPP-over-USB interfaces needed by
+// ippusb_bridge, which uses one of them for keepalives.
+const minIPPUSBInterfaces = 2
+
+// readSysfsAttr returns the trimmed content of the sysfs attribute name of dir.
+func readSysfsAttr(dir, name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// findUSBDevice returns the sysfs directory of the USB device that matches
+// devInfo.
+func findUSBDevice(devInfo usbprinter.DevInfo) (string, error) {
+	dirs, err := filepath.Glob(filepath.Join(usbDevicesDir, "*"))
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range dirs {
+		vid, err := readSysfsAttr(dir, "idVendor")
+		if err != nil {
+			// Interfaces do not have the attribute.
+			continue
+		}
+		pid, err := readSysfsAttr(dir, "idProduct")
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(vid, devInfo.VID) && strings.EqualFold(pid, devInfo.PID) {
+			return dir, nil
+		}
+	}
+	return "", errors.Errorf("no USB device %s:%s", devInfo.VID, devInfo.PID)
+}
+
+// ValidateDevice checks that the USB device that matches devInfo exposes at
+// least two IPP-over-USB interfaces (class 7, subclass 1, protocol 4) in its
+// active configuration, which ippusb_bridge needs. The returned error lists the
+// interfaces of the device, so that misconfigured devices are reported before
+// the bridge fails in a less obvious way.
+func ValidateDevice(ctx context.Context, devInfo usbprinter.DevInfo) error {
+	dev, err := findUSBDevice(devInfo)
+	if err != nil {
+		return err
+	}
+	// Interfaces are named <device>:<configuration>.<interface>.
+	intfs, err := filepath.Glob(dev + ":*")
+	if err != nil {
+		return err
+	}
+	var found int
+	var descs []string
+	for _, intf := range intfs {
+		var attrs [3]string
+		for i, name := range []string{"bInterfaceClass", "bInterfaceSubClass", "bInterfaceProtocol"} {
+			if attrs[i], err = readSysfsAttr(intf, name); err != nil {
+				return errors.Wrapf(err, "failed to read descriptor of interface %s", filepath.Base(intf))
+			}
+		}
+		descs = append(descs, fmt.Sprintf("%s: %s/%s/%s", filepath.Base(intf), attrs[0], attrs[1], attrs[2]))
+		if attrs == [3]string{ippUSBClass, ippUSBSubClass, ippUSBProtocol} {
+			found++
+		}
+	}
+	testing.ContextLogf(ctx, "Found %d IPP-over-USB interfaces on %s:%s", found, devInfo.VID, devInfo.PID)
+	if found < minIPPUSBInterfaces {
+		return errors.Errorf("USB device %s:%s has %d IPP-over-USB interfaces, want at least %d; interfaces (class/subclass/protocol): [%s]",
+			devInfo.VID, devInfo.PID, found, minIPPUSBInterfaces, strings.Join(descs, ", "))
+	}
+	return nil
+}
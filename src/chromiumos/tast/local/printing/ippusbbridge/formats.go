@@ -0,0 +1,48 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"context"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+)
+
+// ippTagMimeMediaType is the value tag of MIME media type attributes.
+const ippTagMimeMediaType = 0x49
+
+// GetSupportedFormats returns the document formats supported by the printer
+// that matches devInfo, e.g. "application/pdf" and "image/pwg-raster", as
+// reported in its document-format-supported attribute by the IPP
+// Get-Printer-Attributes operation. An error is returned if the printer does
+// not report the attribute.
+func GetSupportedFormats(ctx context.Context, devInfo usbprinter.DevInfo) ([]string, error) {
+	req := newIPPRequest(ippOpGetPrinterAttributes).
+		add(ippTagKeyword, "requested-attributes", []byte("document-format-supported")).
+		bytes()
+	status, body, err := sendIPPRequest(ctx, devInfo, ippPath, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send Get-Printer-Attributes request")
+	}
+	if !status.Successful() {
+		return nil, errors.Errorf("Get-Printer-Attributes failed: %v", status)
+	}
+	attrs, err := parseIPPAttributes(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse Get-Printer-Attributes response")
+	}
+
+	var formats []string
+	for _, a := range attrs {
+		if a.group == ippTagPrinterAttributes && a.name == "document-format-supported" && a.tag == ippTagMimeMediaType {
+			formats = append(formats, string(a.value))
+		}
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("document-format-supported missing in Get-Printer-Attributes response")
+	}
+	return formats, nil
+}
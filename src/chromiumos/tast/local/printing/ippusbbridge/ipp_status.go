@@ -0,0 +1,324 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+	"chromiumos/tast/testing"
+)
+
+// IPP delimiter and value tags used to find the status-message attribute.
+// See RFC 8010 section 3.5.
+const (
+	ippTagOperationAttributes = 0x01
+	ippTagEndOfAttributes     = 0x03
+	ippTagTextWithoutLanguage = 0x41
+	ippTagNameWithoutLanguage = 0x42
+)
+
+// ippStatusNames maps the common IPP status codes to their names as defined in
+// RFC 8011 section 5.4.15.
+var ippStatusNames = map[uint16]string{
+	0x0000: "successful-ok",
+	0x0001: "successful-ok-ignored-or-substituted-attributes",
+	0x0002: "successful-ok-conflicting-attributes",
+	0x0400: "client-error-bad-request",
+	0x0401: "client-error-forbidden",
+	0x0402: "client-error-not-authenticated",
+	0x0403: "client-error-not-authorized",
+	0x0404: "client-error-not-possible",
+	0x0405: "client-error-timeout",
+	0x0406: "client-error-not-found",
+	0x0407: "client-error-gone",
+	0x0408: "client-error-request-entity-too-large",
+	0x0409: "client-error-request-value-too-long",
+	0x040a: "client-error-document-format-not-supported",
+	0x040b: "client-error-attributes-or-values-not-supported",
+	0x040c: "client-error-uri-scheme-not-supported",
+	0x040d: "client-error-charset-not-supported",
+	0x040e: "client-error-conflicting-attributes",
+	0x040f: "client-error-compression-not-supported",
+	0x0410: "client-error-compression-error",
+	0x0411: "client-error-document-format-error",
+	0x0412: "client-error-document-access-error",
+	0x0500: "server-error-internal-error",
+	0x0501: "server-error-operation-not-supported",
+	0x0502: "server-error-service-unavailable",
+	0x0503: "server-error-version-not-supported",
+	0x0504: "server-error-device-error",
+	0x0505: "server-error-temporary-error",
+	0x0506: "server-error-not-accepting-jobs",
+	0x0507: "server-error-busy",
+	0x0508: "server-error-job-canceled",
+	0x0509: "server-error-multiple-document-jobs-not-supported",
+}
+
+// IPPStatus is the status of an IPP operation sent through ippusb_bridge.
+type IPPStatus struct {
+	// Code is the status-code of the IPP response.
+	Code uint16
+	// Message is the status-message attribute of the IPP response, if any.
+	Message string
+}
+
+// Name returns the name of the status code, e.g. "client-error-not-found".
+func (s IPPStatus) Name() string {
+	return IPPStatusName(s.Code)
+}
+
+// Successful returns true if the status code is in the successful range.
+func (s IPPStatus) Successful() bool {
+	return s.Code < 0x0100
+}
+
+// String returns a human readable description of the status.
+func (s IPPStatus) String() string {
+	if s.Message == "" {
+		return fmt.Sprintf("%s (0x%04x)", s.Name(), s.Code)
+	}
+	return fmt.Sprintf("%s (0x%04x): %s", s.Name(), s.Code, s.Message)
+}
+
+// IPPStatusName returns the name of the given IPP status code. Codes that are
+// not known are described by their class.
+func IPPStatusName(code uint16) string {
+	if name, ok := ippStatusNames[code]; ok {
+		return name
+	}
+	switch {
+	case code < 0x0100:
+		return "successful-unknown"
+	case code >= 0x0400 && code < 0x0500:
+		return "client-error-unknown"
+	case code >= 0x0500 && code < 0x0600:
+		return "server-error-unknown"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseIPPStatus extracts the status code and status message from an IPP
+// response body.
+func ParseIPPStatus(body []byte) (*IPPStatus, error) {
+	// version-number (2 bytes), status-code (2 bytes), request-id (4 bytes).
+	if len(body) < 8 {
+		return nil, errors.Errorf("IPP response too short: %d bytes", len(body))
+	}
+	status := &IPPStatus{Code: binary.BigEndian.Uint16(body[2:4])}
+
+	// The status-message is an optional attribute of the operation attributes group.
+	attrs, err := parseIPPAttributes(body)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attrs {
+		if a.group == ippTagOperationAttributes && a.name == "status-message" &&
+			(a.tag == ippTagTextWithoutLanguage || a.tag == ippTagNameWithoutLanguage) {
+			status.Message = string(a.value)
+			break
+		}
+	}
+	return status, nil
+}
+
+// ippAttribute is a single value of an attribute in an IPP message.
+type ippAttribute struct {
+	// group is the delimiter tag of the attribute group the attribute is in.
+	group byte
+	// groupIndex is the index of the group in the message, which tells apart
+	// the groups with the same delimiter tag, e.g. the attributes of each job.
+	groupIndex int
+	tag        byte
+	name       string
+	value      []byte
+}
+
+// parseIPPAttributes returns the attributes of the IPP message body, in order.
+// Attributes with several values are returned once per value.
+func parseIPPAttributes(body []byte) ([]ippAttribute, error) {
+	if len(body) < 8 {
+		return nil, errors.Errorf("IPP message too short: %d bytes", len(body))
+	}
+	// Each attribute is encoded as value-tag (1 byte), name-length (2 bytes),
+	// name, value-length (2 bytes), value. Additional values of an attribute
+	// have an empty name.
+	r := bytes.NewReader(body[8:])
+	var attrs []ippAttribute
+	group := byte(0)
+	groupIndex := -1
+	name := ""
+	for {
+		tag, err := r.ReadByte()
+		if err != nil || tag == ippTagEndOfAttributes {
+			break
+		}
+		if tag < 0x10 {
+			// Delimiter tags start a new attribute group.
+			group = tag
+			groupIndex++
+			continue
+		}
+		n, err := readIPPField(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read attribute name")
+		}
+		if len(n) > 0 {
+			name = string(n)
+		}
+		value, err := readIPPField(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read value of attribute %q", name)
+		}
+		attrs = append(attrs, ippAttribute{group: group, groupIndex: groupIndex, tag: tag, name: name, value: value})
+	}
+	return attrs, nil
+}
+
+// readIPPField reads a length-prefixed field of an IPP attribute from r.
+func readIPPField(r *bytes.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// maxRecordedStatuses is the maximum number of statuses kept for each
+// ippusb_bridge socket. The oldest ones are dropped first.
+const maxRecordedStatuses = 100
+
+// statusLog records the IPP statuses of the requests sent through each
+// ippusb_bridge socket. Requests sent by other clients of the socket, e.g.
+// CUPS, are only recorded while a StatusRecorder interposes on the socket.
+var statusLog = struct {
+	mu       sync.Mutex
+	statuses map[string][]IPPStatus
+	// interposed holds the sockets a StatusRecorder interposes on. The
+	// recorder sees the requests sent by this package as well, so they are
+	// not recorded again by sendIPPRequest.
+	interposed map[string]bool
+}{statuses: make(map[string][]IPPStatus), interposed: make(map[string]bool)}
+
+// recordStatus logs status and appends it to the statuses seen for socket.
+func recordStatus(ctx context.Context, socket string, status IPPStatus) {
+	testing.ContextLogf(ctx, "IPP status from %s: %v", socket, status)
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	statuses := append(statusLog.statuses[socket], status)
+	if len(statuses) > maxRecordedStatuses {
+		statuses = append([]IPPStatus(nil), statuses[len(statuses)-maxRecordedStatuses:]...)
+	}
+	statusLog.statuses[socket] = statuses
+}
+
+// setInterposed marks whether a StatusRecorder interposes on socket.
+func setInterposed(socket string, interposed bool) {
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	if interposed {
+		statusLog.interposed[socket] = true
+	} else {
+		delete(statusLog.interposed, socket)
+	}
+}
+
+// isInterposed returns true if a StatusRecorder interposes on socket.
+func isInterposed(socket string) bool {
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	return statusLog.interposed[socket]
+}
+
+// Statuses returns the IPP statuses of the requests sent through the
+// ippusb_bridge socket that matches devInfo, in the order they were received.
+// These are the requests sent by this package, e.g. by SendIPPRequest or
+// ListJobs, and, while a StatusRecorder returned by RecordForwardedStatuses is
+// active, the ones forwarded by the bridge for its other clients such as CUPS.
+// Only the last maxRecordedStatuses statuses are kept.
+func Statuses(devInfo usbprinter.DevInfo) []IPPStatus {
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	return append([]IPPStatus(nil), statusLog.statuses[SocketPath(devInfo)]...)
+}
+
+// LastStatus returns the last IPP status recorded for the ippusb_bridge socket
+// that matches devInfo, as described in Statuses. It returns false if no
+// status was recorded.
+func LastStatus(devInfo usbprinter.DevInfo) (IPPStatus, bool) {
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	statuses := statusLog.statuses[SocketPath(devInfo)]
+	if len(statuses) == 0 {
+		return IPPStatus{}, false
+	}
+	return statuses[len(statuses)-1], true
+}
+
+// ClearStatuses forgets the IPP statuses recorded for the ippusb_bridge socket
+// that matches devInfo. Tests sharing a printer should call it before sending
+// their requests, so that the statuses of the previous tests are not reported.
+// Kill also calls it, as the statuses are of no use once the bridge is gone.
+func ClearStatuses(devInfo usbprinter.DevInfo) {
+	statusLog.mu.Lock()
+	defer statusLog.mu.Unlock()
+	delete(statusLog.statuses, SocketPath(devInfo))
+}
+
+// SendIPPRequest posts the encoded IPP request req to path through the
+// ippusb_bridge socket that matches devInfo. The status of the IPP response is
+// logged, recorded for LastStatus and returned. An error is returned if the
+// HTTP request fails or if the response is not a valid IPP response; an
+// unsuccessful IPP status is not considered an error.
+func SendIPPRequest(ctx context.Context, devInfo usbprinter.DevInfo, path string, req []byte) (*IPPStatus, error) {
+	status, _, err := sendIPPRequest(ctx, devInfo, path, req)
+	return status, err
+}
+
+// sendIPPRequest is the same as SendIPPRequest, but also returns the body of
+// the IPP response.
+func sendIPPRequest(ctx context.Context, devInfo usbprinter.DevInfo, path string, req []byte) (*IPPStatus, []byte, error) {
+	socket := SocketPath(devInfo)
+	client := newSocketClient(socket)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:80"+path, bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create IPP request")
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to send IPP request to ippusb_bridge socket")
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read IPP response from ippusb_bridge")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.Errorf("unexpected HTTP status for IPP request: %s", resp.Status)
+	}
+	status, err := ParseIPPStatus(body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse IPP response")
+	}
+	if !isInterposed(socket) {
+		recordStatus(ctx, socket, *status)
+	}
+	return status, body, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// getJobsResponse is an encoded Get-Jobs response with a status-message and
+// the attributes of two jobs, the second one with a two-valued attribute.
+var getJobsResponse = []byte{
+	0x02, 0x00, // version-number 2.0
+	0x04, 0x06, // status-code client-error-not-found
+	0x00, 0x00, 0x00, 0x01, // request-id
+	0x01, // operation-attributes-tag
+	0x47, 0x00, 0x12, 'a', 't', 't', 'r', 'i', 'b', 'u', 't', 'e', 's', '-', 'c', 'h', 'a', 'r', 's', 'e', 't',
+	0x00, 0x05, 'u', 't', 'f', '-', '8',
+	0x41, 0x00, 0x0e, 's', 't', 'a', 't', 'u', 's', '-', 'm', 'e', 's', 's', 'a', 'g', 'e',
+	0x00, 0x09, 'n', 'o', 't', ' ', 'f', 'o', 'u', 'n', 'd',
+	0x02,                                           // job-attributes-tag
+	0x21, 0x00, 0x06, 'j', 'o', 'b', '-', 'i', 'd', // job-id
+	0x00, 0x04, 0x00, 0x00, 0x00, 0x07,
+	0x02,                                           // job-attributes-tag
+	0x21, 0x00, 0x06, 'j', 'o', 'b', '-', 'i', 'd', // job-id
+	0x00, 0x04, 0x00, 0x00, 0x00, 0x08,
+	0x44, 0x00, 0x05, 'k', 'e', 'y', 'w', 'd', // keywd
+	0x00, 0x01, 'a',
+	0x44, 0x00, 0x00, // additional value of keywd
+	0x00, 0x01, 'b',
+	0x03, // end-of-attributes-tag
+}
+
+func TestParseIPPStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    []byte
+		want    *IPPStatus
+		wantErr bool
+	}{
+		{
+			name: "with status-message",
+			body: getJobsResponse,
+			want: &IPPStatus{Code: 0x0406, Message: "not found"},
+		},
+		{
+			name: "without attributes",
+			body: []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x03},
+			want: &IPPStatus{Code: 0x0000},
+		},
+		{
+			name:    "too short",
+			body:    []byte{0x02, 0x00, 0x00, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "truncated attribute",
+			body:    []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x41, 0x00, 0x0e, 's', 't'},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseIPPStatus(tc.body)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseIPPStatus succeeded unexpectedly with %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("ParseIPPStatus failed: ", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("ParseIPPStatus returned unexpected status (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIPPStatusString(t *testing.T) {
+	for _, tc := range []struct {
+		status IPPStatus
+		want   string
+	}{
+		{IPPStatus{Code: 0x0000}, "successful-ok (0x0000)"},
+		{IPPStatus{Code: 0x0406, Message: "not found"}, "client-error-not-found (0x0406): not found"},
+		{IPPStatus{Code: 0x04ff}, "client-error-unknown (0x04ff)"},
+		{IPPStatus{Code: 0x0700}, "unknown (0x0700)"},
+	} {
+		if got := tc.status.String(); got != tc.want {
+			t.Errorf("String() of %#v = %q; want %q", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestParseIPPAttributes(t *testing.T) {
+	got, err := parseIPPAttributes(getJobsResponse)
+	if err != nil {
+		t.Fatal("parseIPPAttributes failed: ", err)
+	}
+	want := []ippAttribute{
+		{group: 0x01, groupIndex: 0, tag: 0x47, name: "attributes-charset", value: []byte("utf-8")},
+		{group: 0x01, groupIndex: 0, tag: 0x41, name: "status-message", value: []byte("not found")},
+		{group: 0x02, groupIndex: 1, tag: 0x21, name: "job-id", value: []byte{0, 0, 0, 7}},
+		{group: 0x02, groupIndex: 2, tag: 0x21, name: "job-id", value: []byte{0, 0, 0, 8}},
+		{group: 0x02, groupIndex: 2, tag: 0x44, name: "keywd", value: []byte("a")},
+		{group: 0x02, groupIndex: 2, tag: 0x44, name: "keywd", value: []byte("b")},
+	}
+	if diff := cmp.Diff(got, want, cmp.AllowUnexported(ippAttribute{})); diff != "" {
+		t.Errorf("parseIPPAttributes returned unexpected attributes (-got +want):\n%s", diff)
+	}
+}
+
+func TestIPPRequest(t *testing.T) {
+	got := newIPPRequest(ippOpCancelJob).addInteger(ippTagInteger, "job-id", 7).bytes()
+
+	var want []byte
+	want = append(want, 0x02, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x01)
+	for _, a := range []struct {
+		tag   byte
+		name  string
+		value string
+	}{
+		{0x47, "attributes-charset", "utf-8"},
+		{0x48, "attributes-natural-language", "en"},
+		{0x45, "printer-uri", printerURI},
+		{0x42, "requesting-user-name", "tast"},
+		{0x21, "job-id", "\x00\x00\x00\x07"},
+	} {
+		want = append(want, a.tag, 0, byte(len(a.name)))
+		want = append(want, a.name...)
+		want = append(want, 0, byte(len(a.value)))
+		want = append(want, a.value...)
+	}
+	want = append(want, 0x03)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Unexpected Cancel-Job request: got %x, want %x", got, want)
+	}
+
+	// The request must be readable by the parser of the responses.
+	attrs, err := parseIPPAttributes(got)
+	if err != nil {
+		t.Fatal("parseIPPAttributes failed on the request: ", err)
+	}
+	if len(attrs) != 5 || attrs[4].name != "job-id" {
+		t.Errorf("Unexpected attributes parsed from the request: %+v", attrs)
+	}
+}
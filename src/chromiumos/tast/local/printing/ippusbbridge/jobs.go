@@ -0,0 +1,192 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+	"chromiumos/tast/testing"
+)
+
+// ippPath is the path of the IPP endpoint of IPP-over-USB printers.
+const ippPath = "/ipp/print"
+
+// printerURI is the printer-uri sent in the IPP requests.
+const printerURI = "ipp://localhost/ipp/print"
+
+// IPP operation IDs. See RFC 8011 section 5.4.15.
+const (
+	ippOpCancelJob uint16 = 0x0008
+	ippOpGetJobs   uint16 = 0x000a
+)
+
+// IPP value tags used in the job requests and responses. See RFC 8010
+// section 3.5.2.
+const (
+	ippTagJobAttributes   = 0x02
+	ippTagInteger         = 0x21
+	ippTagEnum            = 0x23
+	ippTagURI             = 0x45
+	ippTagKeyword         = 0x44
+	ippTagCharset         = 0x47
+	ippTagNaturalLanguage = 0x48
+)
+
+// maxPurgeRounds is the maximum number of times PurgeJobs lists and cancels
+// the jobs, in case new jobs show up while purging.
+const maxPurgeRounds = 3
+
+// JobState is the state of a print job. See RFC 8011 section 5.3.7.
+type JobState int
+
+// Job states.
+const (
+	JobStatePending           JobState = 3
+	JobStatePendingHeld       JobState = 4
+	JobStateProcessing        JobState = 5
+	JobStateProcessingStopped JobState = 6
+	JobStateCanceled          JobState = 7
+	JobStateAborted           JobState = 8
+	JobStateCompleted         JobState = 9
+)
+
+// JobInfo describes a job in the printer's queue.
+type JobInfo struct {
+	ID    int
+	State JobState
+	Name  string
+}
+
+// ippRequest builds IPP requests.
+type ippRequest struct {
+	buf bytes.Buffer
+}
+
+// newIPPRequest starts an IPP 2.0 request for the operation op, with the
+// required operation attributes.
+func newIPPRequest(op uint16) *ippRequest {
+	r := &ippRequest{}
+	r.buf.Write([]byte{2, 0})
+	binary.Write(&r.buf, binary.BigEndian, op)
+	binary.Write(&r.buf, binary.BigEndian, uint32(1))
+	r.buf.WriteByte(ippTagOperationAttributes)
+	r.add(ippTagCharset, "attributes-charset", []byte("utf-8"))
+	r.add(ippTagNaturalLanguage, "attributes-natural-language", []byte("en"))
+	r.add(ippTagURI, "printer-uri", []byte(printerURI))
+	r.add(ippTagNameWithoutLanguage, "requesting-user-name", []byte("tast"))
+	return r
+}
+
+// add adds an attribute value. An empty name adds a value to the previous
+// attribute.
+func (r *ippRequest) add(tag byte, name string, value []byte) *ippRequest {
+	r.buf.WriteByte(tag)
+	binary.Write(&r.buf, binary.BigEndian, uint16(len(name)))
+	r.buf.WriteString(name)
+	binary.Write(&r.buf, binary.BigEndian, uint16(len(value)))
+	r.buf.Write(value)
+	return r
+}
+
+// addInteger adds an integer or enum attribute value.
+func (r *ippRequest) addInteger(tag byte, name string, value int) *ippRequest {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(value)))
+	return r.add(tag, name, b)
+}
+
+// bytes terminates the request and returns it.
+func (r *ippRequest) bytes() []byte {
+	r.buf.WriteByte(ippTagEndOfAttributes)
+	return r.buf.Bytes()
+}
+
+// ListJobs returns the jobs which are not completed yet in the queue of the
+// printer that matches devInfo, using the IPP Get-Jobs operation.
+func ListJobs(ctx context.Context, devInfo usbprinter.DevInfo) ([]JobInfo, error) {
+	req := newIPPRequest(ippOpGetJobs).
+		add(ippTagKeyword, "which-jobs", []byte("not-completed")).
+		add(ippTagKeyword, "requested-attributes", []byte("job-id")).
+		add(ippTagKeyword, "", []byte("job-state")).
+		add(ippTagKeyword, "", []byte("job-name")).
+		bytes()
+	status, body, err := sendIPPRequest(ctx, devInfo, ippPath, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send Get-Jobs request")
+	}
+	if !status.Successful() {
+		return nil, errors.Errorf("Get-Jobs failed: %v", status)
+	}
+	attrs, err := parseIPPAttributes(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse Get-Jobs response")
+	}
+
+	var jobs []JobInfo
+	lastGroup := -1
+	for _, a := range attrs {
+		if a.group != ippTagJobAttributes {
+			continue
+		}
+		if a.groupIndex != lastGroup {
+			jobs = append(jobs, JobInfo{})
+			lastGroup = a.groupIndex
+		}
+		job := &jobs[len(jobs)-1]
+		switch {
+		case a.name == "job-id" && a.tag == ippTagInteger && len(a.value) == 4:
+			job.ID = int(int32(binary.BigEndian.Uint32(a.value)))
+		case a.name == "job-state" && a.tag == ippTagEnum && len(a.value) == 4:
+			job.State = JobState(binary.BigEndian.Uint32(a.value))
+		case a.name == "job-name":
+			job.Name = string(a.value)
+		}
+	}
+	return jobs, nil
+}
+
+// cancelJob cancels the job with the given ID using the IPP Cancel-Job
+// operation.
+func cancelJob(ctx context.Context, devInfo usbprinter.DevInfo, id int) error {
+	req := newIPPRequest(ippOpCancelJob).addInteger(ippTagInteger, "job-id", id).bytes()
+	status, err := SendIPPRequest(ctx, devInfo, ippPath, req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send Cancel-Job request for job %d", id)
+	}
+	if !status.Successful() {
+		return errors.Errorf("Cancel-Job failed for job %d: %v", id, status)
+	}
+	return nil
+}
+
+// PurgeJobs cancels all the jobs which are not completed yet in the queue of
+// the printer that matches devInfo, and returns the number of canceled jobs.
+// It is meant to be used in setup so that jobs left over by a previous test do
+// not affect the next one.
+func PurgeJobs(ctx context.Context, devInfo usbprinter.DevInfo) (int, error) {
+	canceled := 0
+	for round := 0; round < maxPurgeRounds; round++ {
+		jobs, err := ListJobs(ctx, devInfo)
+		if err != nil {
+			return canceled, err
+		}
+		if len(jobs) == 0 {
+			testing.ContextLogf(ctx, "Canceled %d print jobs", canceled)
+			return canceled, nil
+		}
+		for _, job := range jobs {
+			testing.ContextLogf(ctx, "Canceling print job %d (%q)", job.ID, job.Name)
+			if err := cancelJob(ctx, devInfo, job.ID); err != nil {
+				return canceled, err
+			}
+			canceled++
+		}
+	}
+	return canceled, errors.Errorf("jobs remain after canceling %d jobs", canceled)
+}
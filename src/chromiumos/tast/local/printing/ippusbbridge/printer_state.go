@@ -0,0 +1,137 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+	"chromiumos/tast/testing"
+)
+
+// ippOpGetPrinterAttributes is the IPP Get-Printer-Attributes operation ID.
+const ippOpGetPrinterAttributes uint16 = 0x000b
+
+// ippTagPrinterAttributes is the delimiter tag of the printer attributes group.
+const ippTagPrinterAttributes = 0x04
+
+// printerIdleTimeout is how long WaitForPrinterIdle waits for the printer.
+const printerIdleTimeout = 2 * time.Minute
+
+// PrinterState is the state of a printer. See RFC 8011 section 5.4.11.
+type PrinterState int
+
+// Printer states.
+const (
+	PrinterStateIdle       PrinterState = 3
+	PrinterStateProcessing PrinterState = 4
+	PrinterStateStopped    PrinterState = 5
+)
+
+// String returns the keyword of s.
+func (s PrinterState) String() string {
+	switch s {
+	case PrinterStateIdle:
+		return "idle"
+	case PrinterStateProcessing:
+		return "processing"
+	case PrinterStateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// PrinterStatus holds the state attributes of a printer.
+type PrinterStatus struct {
+	State PrinterState
+	// Reasons are the printer-state-reasons keywords, e.g. "media-empty-error".
+	Reasons []string
+	// QueuedJobs is the number of jobs in the queue, or -1 if the printer does
+	// not report it.
+	QueuedJobs int
+}
+
+// String returns a human-readable representation of s.
+func (s *PrinterStatus) String() string {
+	return fmt.Sprintf("state %v, reasons [%s], %d queued jobs", s.State, strings.Join(s.Reasons, ", "), s.QueuedJobs)
+}
+
+// hasErrorReason returns whether one of the state reasons of s is an error.
+func (s *PrinterStatus) hasErrorReason() bool {
+	for _, r := range s.Reasons {
+		if strings.HasSuffix(r, "-error") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrinterStatus returns the state attributes of the printer that matches
+// devInfo, using the IPP Get-Printer-Attributes operation.
+func GetPrinterStatus(ctx context.Context, devInfo usbprinter.DevInfo) (*PrinterStatus, error) {
+	req := newIPPRequest(ippOpGetPrinterAttributes).
+		add(ippTagKeyword, "requested-attributes", []byte("printer-state")).
+		add(ippTagKeyword, "", []byte("printer-state-reasons")).
+		add(ippTagKeyword, "", []byte("queued-job-count")).
+		bytes()
+	status, body, err := sendIPPRequest(ctx, devInfo, ippPath, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send Get-Printer-Attributes request")
+	}
+	if !status.Successful() {
+		return nil, errors.Errorf("Get-Printer-Attributes failed: %v", status)
+	}
+	attrs, err := parseIPPAttributes(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse Get-Printer-Attributes response")
+	}
+
+	ps := &PrinterStatus{QueuedJobs: -1}
+	for _, a := range attrs {
+		if a.group != ippTagPrinterAttributes {
+			continue
+		}
+		switch {
+		case a.name == "printer-state" && a.tag == ippTagEnum && len(a.value) == 4:
+			ps.State = PrinterState(binary.BigEndian.Uint32(a.value))
+		case a.name == "printer-state-reasons" && a.tag == ippTagKeyword:
+			if r := string(a.value); r != "none" {
+				ps.Reasons = append(ps.Reasons, r)
+			}
+		case a.name == "queued-job-count" && a.tag == ippTagInteger && len(a.value) == 4:
+			ps.QueuedJobs = int(int32(binary.BigEndian.Uint32(a.value)))
+		}
+	}
+	if ps.State == 0 {
+		return nil, errors.New("printer-state missing in Get-Printer-Attributes response")
+	}
+	return ps, nil
+}
+
+// WaitForPrinterIdle waits until the printer that matches devInfo is idle with
+// no queued jobs. It fails immediately if the printer is stopped or reports an
+// error state reason. On timeout, the returned error contains the last state
+// reasons of the printer.
+func WaitForPrinterIdle(ctx context.Context, devInfo usbprinter.DevInfo) error {
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		ps, err := GetPrinterStatus(ctx, devInfo)
+		if err != nil {
+			return err
+		}
+		if ps.State == PrinterStateStopped || ps.hasErrorReason() {
+			return testing.PollBreak(errors.Errorf("printer is not operational: %v", ps))
+		}
+		if ps.State != PrinterStateIdle || ps.QueuedJobs > 0 {
+			return errors.Errorf("printer is busy: %v", ps)
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: printerIdleTimeout, Interval: time.Second})
+}
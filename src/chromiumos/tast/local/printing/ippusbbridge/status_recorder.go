@@ -0,0 +1,125 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+	"chromiumos/tast/testing"
+)
+
+// StatusRecorder interposes on an ippusb_bridge socket to record the IPP
+// statuses of the requests that the other clients of the socket, e.g. CUPS
+// when printing or scanning, send through the bridge.
+type StatusRecorder struct {
+	socket string
+	// bridgeSocket is the path the socket of ippusb_bridge is moved to while
+	// the recorder listens on its original path.
+	bridgeSocket string
+	server       *http.Server
+}
+
+// RecordForwardedStatuses moves the ippusb_bridge socket that matches devInfo
+// aside and listens on its path instead, forwarding all the connections to the
+// bridge. The IPP statuses of the forwarded requests are recorded for Statuses
+// and LastStatus, along with the ones of the requests sent by this package. It
+// should be called after WaitForSocket and before the clients connect to the
+// bridge, as the connections already open are not seen. Stop must be called to
+// restore the socket of the bridge.
+func RecordForwardedStatuses(ctx context.Context, devInfo usbprinter.DevInfo) (*StatusRecorder, error) {
+	socket := SocketPath(devInfo)
+	r := &StatusRecorder{socket: socket, bridgeSocket: socket + ".bridge"}
+
+	var st unix.Stat_t
+	if err := unix.Stat(socket, &st); err != nil {
+		return nil, errors.Wrapf(err, "failed to stat %s", socket)
+	}
+	if err := os.Rename(socket, r.bridgeSocket); err != nil {
+		return nil, errors.Wrapf(err, "failed to move %s aside", socket)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		r.restore(ctx)
+		return nil, errors.Wrapf(err, "failed to listen on %s", socket)
+	}
+	// The clients of the bridge, e.g. CUPS, need the same access to the
+	// socket as before.
+	if err := os.Chown(socket, int(st.Uid), int(st.Gid)); err != nil {
+		ln.Close()
+		r.restore(ctx)
+		return nil, errors.Wrapf(err, "failed to change the owner of %s", socket)
+	}
+	if err := os.Chmod(socket, os.FileMode(st.Mode&0777)); err != nil {
+		ln.Close()
+		r.restore(ctx)
+		return nil, errors.Wrapf(err, "failed to change the mode of %s", socket)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = "localhost:80"
+		},
+		Transport: newSocketClient(r.bridgeSocket).Transport,
+		// Stream the responses, e.g. the scanned images, as they come.
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			if t, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || t != "application/ipp" {
+				return nil
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return errors.Wrap(err, "failed to read IPP response")
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			status, err := ParseIPPStatus(body)
+			if err != nil {
+				testing.ContextLogf(ctx, "Failed to parse IPP response forwarded from %s: %v", socket, err)
+				return nil
+			}
+			recordStatus(ctx, socket, *status)
+			return nil
+		},
+	}
+	r.server = &http.Server{Handler: proxy}
+	setInterposed(socket, true)
+	go func() {
+		if err := r.server.Serve(ln); err != http.ErrServerClosed {
+			testing.ContextLogf(ctx, "Status recorder on %s failed: %v", socket, err)
+		}
+	}()
+	return r, nil
+}
+
+// Stop stops recording the statuses, and moves the socket of ippusb_bridge
+// back to its original path.
+func (r *StatusRecorder) Stop(ctx context.Context) error {
+	setInterposed(r.socket, false)
+	// Closing the server also removes the socket it listens on.
+	if err := r.server.Close(); err != nil {
+		testing.ContextLogf(ctx, "Failed to close status recorder on %s: %v", r.socket, err)
+	}
+	return r.restore(ctx)
+}
+
+// restore moves the socket of ippusb_bridge back to its original path.
+func (r *StatusRecorder) restore(ctx context.Context) error {
+	if err := os.Rename(r.bridgeSocket, r.socket); err != nil {
+		return errors.Wrapf(err, "failed to restore %s", r.socket)
+	}
+	return nil
+}
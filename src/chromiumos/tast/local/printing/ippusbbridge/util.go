@@ -45,15 +45,7 @@ func WaitForSocket(ctx context.Context, devInfo usbprinter.DevInfo) error {
 // matches devInfo.  Returns nil if a response is received regardless of the HTTP
 // status code or body contents.
 func ContactPrinterEndpoint(ctx context.Context, devInfo usbprinter.DevInfo, url string) error {
-	socket := SocketPath(devInfo)
-
-	client := http.Client{
-		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", socket)
-			},
-		},
-	}
+	client := newSocketClient(SocketPath(devInfo))
 
 	resp, err := client.Get("http://localhost:80" + url)
 	if err != nil {
@@ -68,8 +60,21 @@ func ContactPrinterEndpoint(ctx context.Context, devInfo usbprinter.DevInfo, url
 	return nil
 }
 
+// newSocketClient returns an HTTP client which sends all requests through the
+// ippusb_bridge socket at the given path.
+func newSocketClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+}
+
 // Kill searches the process tree to kill the ippusb_bridge process. It also
-// removes the ippusb_bridge and ippusb_bridge keepalive sockets.
+// removes the ippusb_bridge and ippusb_bridge keepalive sockets, and forgets
+// the IPP statuses recorded for devInfo.
 func Kill(ctx context.Context, devInfo usbprinter.DevInfo) error {
 	ps, err := process.ProcessesWithContext(ctx)
 	if err != nil {
@@ -109,6 +114,7 @@ func Kill(ctx context.Context, devInfo usbprinter.DevInfo) error {
 			return errors.Wrap(err, "failed to wait for ippusb_bridge to exit")
 		}
 	}
+	ClearStatuses(devInfo)
 	if err := os.Remove(SocketPath(devInfo)); err != nil && !os.IsNotExist(err) {
 		return errors.Wrap(err, "failed to remove ippusb_bridge socket")
 	}
@@ -0,0 +1,110 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ippusbbridge
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/printing/usbprinter"
+)
+
+// ippOpValidateJob is the IPP Validate-Job operation ID.
+const ippOpValidateJob uint16 = 0x0004
+
+// IPP tags used to encode the job attributes of Validate-Job and to find the
+// attributes rejected by the printer. See RFC 8010 section 3.5.
+const (
+	ippTagUnsupportedAttributes = 0x05
+	ippTagBoolean               = 0x22
+)
+
+// ippStatusAttributesNotSupported is the status code returned when the printer
+// does not support some of the requested attributes or values.
+const ippStatusAttributesNotSupported uint16 = 0x040b
+
+// addJobAttribute adds the job attribute name with value to r. Integers are
+// encoded as integer, booleans as boolean, and strings and string slices as
+// keyword values.
+func (r *ippRequest) addJobAttribute(name string, value interface{}) error {
+	switch v := value.(type) {
+	case int:
+		r.addInteger(ippTagInteger, name, v)
+	case bool:
+		b := byte(0)
+		if v {
+			b = 1
+		}
+		r.add(ippTagBoolean, name, []byte{b})
+	case string:
+		r.add(ippTagKeyword, name, []byte(v))
+	case []string:
+		if len(v) == 0 {
+			return errors.Errorf("attribute %q has no values", name)
+		}
+		for i, s := range v {
+			n := name
+			if i > 0 {
+				n = ""
+			}
+			r.add(ippTagKeyword, n, []byte(s))
+		}
+	default:
+		return errors.Errorf("unsupported type %T for attribute %q", value, name)
+	}
+	return nil
+}
+
+// ValidateJob asks the printer that matches devInfo whether it would accept a
+// job with jobAttributes, using the IPP Validate-Job operation, without
+// printing anything. The attribute values may be int, bool, string or
+// []string. An error is returned if the printer rejects the job; if it is
+// because of unsupported attributes, the error names them. The IPP status of
+// the response can be retrieved with LastStatus.
+func ValidateJob(ctx context.Context, devInfo usbprinter.DevInfo, jobAttributes map[string]interface{}) error {
+	req := newIPPRequest(ippOpValidateJob)
+	req.buf.WriteByte(ippTagJobAttributes)
+	var names []string
+	for name := range jobAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := req.addJobAttribute(name, jobAttributes[name]); err != nil {
+			return err
+		}
+	}
+
+	status, body, err := sendIPPRequest(ctx, devInfo, ippPath, req.bytes())
+	if err != nil {
+		return errors.Wrap(err, "failed to send Validate-Job request")
+	}
+	if status.Successful() {
+		return nil
+	}
+	if status.Code != ippStatusAttributesNotSupported {
+		return errors.Errorf("Validate-Job failed: %v", status)
+	}
+
+	attrs, err := parseIPPAttributes(body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse Validate-Job response with status %v", status)
+	}
+	var unsupported []string
+	for _, a := range attrs {
+		if a.group != ippTagUnsupportedAttributes {
+			continue
+		}
+		if len(unsupported) == 0 || unsupported[len(unsupported)-1] != a.name {
+			unsupported = append(unsupported, a.name)
+		}
+	}
+	if len(unsupported) == 0 {
+		return errors.Errorf("Validate-Job failed: %v", status)
+	}
+	return errors.Errorf("printer does not support job attributes %s: %v", strings.Join(unsupported, ", "), status)
+}
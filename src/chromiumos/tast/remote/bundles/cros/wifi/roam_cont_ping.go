@@ -169,6 +169,10 @@ func RoamContPing(ctx context.Context, s *testing.State) {
 	resultAssertF = func(ctx context.Context, results []verifier.ResultType) {
 		var sent, received int
 		for i, ret := range results {
+			if ret.Err != nil {
+				s.Errorf("Iteration %d failed at %s: %v", i+1, ret.Timestamp.Format("15:04:05.000"), ret.Err)
+				continue
+			}
 			pingData := ret.Data.(*ping.Result)
 			testing.ContextLogf(ctx, "Iteration %d: End Time=%s, Packets lost=%d",
 				i+1, ret.Timestamp.Format("15:04:05.000"), pingData.Sent-pingData.Received)
@@ -198,7 +202,7 @@ func RoamContPing(ctx context.Context, s *testing.State) {
 	for i := 0; i < rounds; i++ {
 		ct.ContinuityRound(ctx, s, i)
 	}
-	results, err := vf.StopJob()
+	results, err := vf.StopJob(ctx)
 	if err != nil {
 		s.Fatal("Error while receiving verification results, err: ", err)
 		return
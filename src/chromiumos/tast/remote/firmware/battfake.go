@@ -0,0 +1,70 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"chromiumos/tast/errors"
+)
+
+// ErrBattfakeUnsupported is returned when the EC console does not have the
+// "battfake" command.
+var ErrBattfakeUnsupported = errors.New("EC does not support battfake")
+
+// reBattfake matches the output of the EC console "battfake" command, e.g.
+// "Reporting fake battery level 5%" or "Reporting real battery level", or the
+// error reported when the command does not exist.
+var reBattfake = regexp.MustCompile(`Reporting (?:fake battery level (\d+)%|(real) battery level)|(Command 'battfake' not found or ambiguous)`)
+
+// battfake runs the EC console "battfake" command with percent, where -1
+// reports the real battery level again, and checks that the EC accepted it.
+func (h *Helper) battfake(ctx context.Context, percent int) error {
+	cmd := fmt.Sprintf("battfake %d", percent)
+	out, err := h.Servo.RunECCommandGetOutput(ctx, cmd, []string{reBattfake.String()})
+	if err != nil {
+		return errors.Wrapf(err, "failed to run %q", cmd)
+	}
+	m := out[0]
+	switch {
+	case m[3] != "":
+		return ErrBattfakeUnsupported
+	case percent < 0:
+		if m[2] == "" {
+			return errors.Errorf("EC still reports a fake battery level of %s%%", m[1])
+		}
+	default:
+		if got, err := strconv.Atoi(m[1]); err != nil || got != percent {
+			return errors.Errorf("EC did not accept fake battery level: got %q, want %d%%", m[0], percent)
+		}
+	}
+	return nil
+}
+
+// SetFakeBatteryLevel makes the EC report the battery level as percent, with
+// the EC console "battfake" command, so that low-battery behaviors can be
+// tested without discharging the battery. The returned function makes the EC
+// report the real battery level again, and should be called even if the test
+// fails. ErrBattfakeUnsupported is returned on boards without battfake.
+func (h *Helper) SetFakeBatteryLevel(ctx context.Context, percent int) (func(ctx context.Context) error, error) {
+	if percent < 0 || percent > 100 {
+		return nil, errors.Errorf("invalid battery level %d%%", percent)
+	}
+	if err := h.RequireServo(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to servo")
+	}
+	if err := h.battfake(ctx, percent); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		if err := h.battfake(ctx, -1); err != nil {
+			return errors.Wrap(err, "failed to restore the real battery level")
+		}
+		return nil
+	}, nil
+}
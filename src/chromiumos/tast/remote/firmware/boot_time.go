@@ -0,0 +1,140 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// BootPhaseUnknown is the value of a BootTiming phase whose timestamp could not be determined.
+const BootPhaseUnknown time.Duration = -1
+
+// BootTiming is a breakdown of the time spent in the phases of a boot.
+// Each phase is measured from the start of its own clock domain, so the values are not additive.
+type BootTiming struct {
+	// ECJumpToRW is the EC uptime at which the EC jumped from RO to RW.
+	ECJumpToRW time.Duration
+	// APFirmware is the total time spent in the AP firmware, as reported by coreboot.
+	APFirmware time.Duration
+	// Kernel is the time from the kernel start until userspace startup.
+	Kernel time.Duration
+	// LoginReady is the time from the kernel start until the login prompt was visible.
+	LoginReady time.Duration
+}
+
+// Regexps to capture boot phase timestamps.
+var (
+	// Matches the EC console line printed when jumping to RW, e.g. "[0.012345 Jumping to image RW]".
+	reECJumpToRW = regexp.MustCompile(`\[(\d+\.\d+) Jumping to image RW`)
+	// Matches the total firmware time from "cbmem -t", e.g. "Total Time: 1,234,567".
+	reCbmemTotalTime = regexp.MustCompile(`Total Time:\s*([\d,]+)`)
+)
+
+// bootstat files which contain the uptime at which the event was recorded.
+const (
+	bootstatPreStartup  = "/tmp/uptime-pre-startup"
+	bootstatLoginPrompt = "/tmp/uptime-login-prompt-visible"
+)
+
+// MeasureBootTime reboots the DUT via triggerReboot and returns the timing of each boot phase.
+// A phase which cannot be measured is set to BootPhaseUnknown rather than failing.
+func (h *Helper) MeasureBootTime(ctx context.Context, triggerReboot func() error) (*BootTiming, error) {
+	bootID, err := h.Reporter.BootID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get boot ID")
+	}
+	if err := triggerReboot(); err != nil {
+		return nil, errors.Wrap(err, "failed to trigger reboot")
+	}
+	if err := h.DisconnectDUT(ctx); err != nil {
+		testing.ContextLog(ctx, "Error closing connections to DUT: ", err)
+	}
+	if err := h.WaitConnect(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to reconnect to DUT")
+	}
+	if newBootID, err := h.Reporter.BootID(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get boot ID after reboot")
+	} else if newBootID == bootID {
+		return nil, errors.New("DUT did not reboot")
+	}
+
+	// The login prompt may not be visible yet right after the DUT becomes reachable.
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		_, err := h.Reporter.CatFile(ctx, bootstatLoginPrompt)
+		return err
+	}, &testing.PollOptions{Timeout: time.Minute}); err != nil {
+		testing.ContextLog(ctx, "Login prompt did not become visible: ", err)
+	}
+
+	timing := &BootTiming{
+		ECJumpToRW: BootPhaseUnknown,
+		APFirmware: BootPhaseUnknown,
+		Kernel:     BootPhaseUnknown,
+		LoginReady: BootPhaseUnknown,
+	}
+	if out, err := NewECTool(h.DUT, ECToolNameMain).Command(ctx, "console").Output(); err != nil {
+		testing.ContextLog(ctx, "Failed to read EC console: ", err)
+	} else if m := reECJumpToRW.FindSubmatch(out); m == nil {
+		testing.ContextLog(ctx, "EC jump to RW not found in EC console")
+	} else if d, err := parseSeconds(string(m[1])); err != nil {
+		testing.ContextLog(ctx, "Failed to parse EC jump time: ", err)
+	} else {
+		timing.ECJumpToRW = d
+	}
+	if out, err := h.Reporter.CommandOutput(ctx, "cbmem", "-t"); err != nil {
+		testing.ContextLog(ctx, "Failed to read cbmem timestamps: ", err)
+	} else if m := reCbmemTotalTime.FindStringSubmatch(out); m == nil {
+		testing.ContextLog(ctx, "Total firmware time not found in cbmem timestamps")
+	} else if us, err := strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64); err != nil {
+		testing.ContextLog(ctx, "Failed to parse total firmware time: ", err)
+	} else {
+		timing.APFirmware = time.Duration(us) * time.Microsecond
+	}
+	for _, p := range []struct {
+		file string
+		dst  *time.Duration
+	}{
+		{bootstatPreStartup, &timing.Kernel},
+		{bootstatLoginPrompt, &timing.LoginReady},
+	} {
+		d, err := h.readBootstatUptime(ctx, p.file)
+		if err != nil {
+			testing.ContextLogf(ctx, "Failed to read %s: %v", p.file, err)
+			continue
+		}
+		*p.dst = d
+	}
+	return timing, nil
+}
+
+// readBootstatUptime returns the uptime recorded in the bootstat file at path.
+// The first field of the file is the uptime in seconds.
+func (h *Helper) readBootstatUptime(ctx context.Context, path string) (time.Duration, error) {
+	out, err := h.Reporter.CatFile(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, errors.Errorf("%s is empty", path)
+	}
+	return parseSeconds(fields[0])
+}
+
+// parseSeconds parses a decimal number of seconds, e.g. "1.234", into a time.Duration.
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %q as seconds", s)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
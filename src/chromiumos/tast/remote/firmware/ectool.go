@@ -8,6 +8,7 @@
 package firmware
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"regexp"
@@ -52,6 +53,13 @@ var (
 	reTabletModeAng = regexp.MustCompile(`tablet_mode_angle=(\d+) hys=(\d+)`)
 	reFlashSize     = regexp.MustCompile(`FlashSize\s*(\d+)`)
 	reI2CLookup     = regexp.MustCompile(`Bus: I2C; Port: (\S+); Address: (\S+)`)
+	// reTemp matches a sensor reading of 'ectool temps all', e.g.
+	// "TSR0 Sensor    313 K (= 40 C)   10% (303 K and 333 K)", or "0: 313 K"
+	// with older ectool versions which do not print the sensor names.
+	reTemp = regexp.MustCompile(`(?m)^\s*(\S.*?):?\s+(\d+) K(?:\s+\(= -?\d+ C\))?`)
+	// reFanRPM matches a fan reading of 'ectool pwmgetfanrpm all', e.g.
+	// "Fan 0 RPM: 3000" or "Fan 1 stalled!".
+	reFanRPM = regexp.MustCompile(`(?m)^Fan (\d+) (?:RPM: (\d+)|(stalled))`)
 )
 
 // Command return the prebuilt ssh Command with options and args applied.
@@ -242,14 +250,19 @@ const (
 	I2Cxfer I2CCmd = "i2cxfer"
 )
 
-// I2C runs the 'ectool i2c*' with provided command and args.
+// I2C runs the 'ectool i2c*' with provided command and args. On failure, the
+// returned error includes the messages ectool printed on stderr, e.g. the
+// status of a failed transfer.
 func (ec *ECTool) I2C(ctx context.Context, cmd I2CCmd, args ...string) (string, error) {
 	cmdAndArgs := append([]string{string(cmd)}, args...)
-	out, err := ec.Command(ctx, cmdAndArgs...).Output(ssh.DumpLogOnError)
-	if err != nil {
-		return "", errors.Wrapf(err, "running 'ectool %s' on DUT with args %v", string(cmd), args)
+	c := ec.Command(ctx, cmdAndArgs...)
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return "", errors.Wrapf(err, "running 'ectool %s' on DUT with args %v, got: %q", string(cmd), args, strings.TrimSpace(stderr.String()))
 	}
-	return string(out), nil
+	return stdout.String(), nil
 }
 
 // CBICmd type holds commands for interacting with cbi using the ectool.
@@ -275,3 +288,53 @@ func (ec *ECTool) CBI(ctx context.Context, cmd CBICmd, args ...string) (string,
 	}
 	return string(out), nil
 }
+
+// ReadTemperatures runs 'ectool temps all' and returns the temperatures of the
+// EC sensors in Celsius, keyed by the sensor names. Sensors which are not
+// calibrated, not present or not powered are omitted.
+func (ec *ECTool) ReadTemperatures(ctx context.Context) (map[string]float64, error) {
+	out, err := ec.Command(ctx, "temps", "all").Output(ssh.DumpLogOnError)
+	if err != nil {
+		return nil, errors.Wrap(err, "running 'ectool temps all' on DUT")
+	}
+	temps := make(map[string]float64)
+	for _, m := range reTemp.FindAllStringSubmatch(string(out), -1) {
+		kelvin, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse temperature of sensor %q", m[1])
+		}
+		temps[strings.TrimSpace(m[1])] = float64(kelvin) - 273.15
+	}
+	if len(temps) == 0 {
+		return nil, errors.Errorf("no sensor reading in 'ectool temps all' output: %s", out)
+	}
+	return temps, nil
+}
+
+// ReadFanRPM runs 'ectool pwmgetfanrpm all' and returns the speeds of the fans
+// in RPM, keyed by the fan indices. Stalled fans are reported at 0 RPM, and
+// fans which are not present are omitted, so the map is empty on fanless
+// devices.
+func (ec *ECTool) ReadFanRPM(ctx context.Context) (map[int]int, error) {
+	out, err := ec.Command(ctx, "pwmgetfanrpm", "all").Output(ssh.DumpLogOnError)
+	if err != nil {
+		return nil, errors.Wrap(err, "running 'ectool pwmgetfanrpm all' on DUT")
+	}
+	rpms := make(map[int]int)
+	for _, m := range reFanRPM.FindAllStringSubmatch(string(out), -1) {
+		fan, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse fan index %q", m[1])
+		}
+		if m[3] != "" {
+			rpms[fan] = 0
+			continue
+		}
+		rpm, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse RPM of fan %d", fan)
+		}
+		rpms[fan] = rpm
+	}
+	return rpms, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+
+	fwCommon "chromiumos/tast/common/firmware"
+	"chromiumos/tast/errors"
+)
+
+// GetGBBFlags returns the GBB flags of the AP firmware, see
+// fwCommon.ReadGBBFlags.
+func (h *Helper) GetGBBFlags(ctx context.Context) (fwCommon.GBBFlags, error) {
+	if h.DUT == nil {
+		return 0, errors.New("helper has no DUT")
+	}
+	return fwCommon.ReadGBBFlags(ctx, h.DUT)
+}
+
+// SetGBBFlags overwrites all the GBB flags of the AP firmware with flags and
+// verifies them, see fwCommon.WriteGBBFlags. An error wrapping
+// fwCommon.ErrGBBWriteProtected is returned if write protection prevents the
+// change. See UpdateGBBFlags to change only some of the flags.
+func (h *Helper) SetGBBFlags(ctx context.Context, flags fwCommon.GBBFlags) error {
+	if h.DUT == nil {
+		return errors.New("helper has no DUT")
+	}
+	return fwCommon.WriteGBBFlags(ctx, h.DUT, flags)
+}
+
+// UpdateGBBFlags sets the flags in set and clears the flags in clear, leaving
+// the other GBB flags unchanged, see fwCommon.UpdateGBBFlags.
+func (h *Helper) UpdateGBBFlags(ctx context.Context, set, clear fwCommon.GBBFlags) error {
+	if h.DUT == nil {
+		return errors.New("helper has no DUT")
+	}
+	return fwCommon.UpdateGBBFlags(ctx, h.DUT, set, clear)
+}
@@ -655,21 +655,42 @@ func checkUSBStorage(ctx context.Context, usbInfo string, minimalSize float64) e
 	return nil
 }
 
-// WaitForPowerStates polls for DUT to get to a specific powerstate
+// powerStateUnreachable stands for the failed reads in the power state
+// sequences reported by WaitForPowerStates.
+const powerStateUnreachable = "<unreachable>"
+
+// WaitForPowerStates polls for DUT to get to one of powerStates, as reported
+// by the EC through servo. The EC may be unreachable while the DUT reboots, so
+// failed reads are retried until timeout. On timeout, the returned error lists
+// the sequence of the distinct states observed, to tell e.g. a DUT stuck in S0
+// from one which went through S3 and woke up again.
 func (h *Helper) WaitForPowerStates(ctx context.Context, interval, timeout time.Duration, powerStates ...string) error {
+	var observed []string
+	var lastErr error
+	record := func(s string) {
+		if len(observed) == 0 || observed[len(observed)-1] != s {
+			observed = append(observed, s)
+		}
+	}
 	// Try reading the power state from the EC.
-	err := testing.Poll(ctx, func(c context.Context) error {
+	err := testing.Poll(ctx, func(ctx context.Context) error {
 		currPowerState, err := h.Servo.GetECSystemPowerState(ctx)
 		if err != nil {
+			lastErr = err
+			record(powerStateUnreachable)
 			return errors.Wrap(err, "failed to check powerstate")
 		}
+		record(currPowerState)
 		if !comparePowerStates(currPowerState, powerStates...) {
 			return errors.Errorf("Power state = %s", currPowerState)
 		}
 		return nil
 	}, &testing.PollOptions{Timeout: timeout, Interval: interval})
 	if err != nil {
-		return errors.Errorf("failed to get one of %v power state: %s", powerStates, err)
+		if lastErr != nil {
+			return errors.Wrapf(err, "failed to get one of %v power state within %v, observed states %v, last read error: %v", powerStates, timeout, observed, lastErr)
+		}
+		return errors.Wrapf(err, "failed to get one of %v power state within %v, observed states %v", powerStates, timeout, observed)
 	}
 	return nil
 }
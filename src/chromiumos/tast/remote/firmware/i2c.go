@@ -0,0 +1,136 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// Limits of the "ectool i2cxfer" command.
+const (
+	// i2cMaxAddr is the largest 7-bit I2C address.
+	i2cMaxAddr = 0x7f
+	// i2cMaxOffset is the largest register offset of 8-bit transfers.
+	i2cMaxOffset = 0xff
+	// i2cMaxReadLen is the largest number of bytes read by a transfer, which
+	// keeps the response within the size of the EC host command buffer.
+	i2cMaxReadLen = 32
+)
+
+// I2C passthru status flags reported by ectool when a transfer fails, see
+// EC_I2C_STATUS_* in ec_commands.h.
+const (
+	i2cStatusNAK     = 1 << 0
+	i2cStatusTimeout = 1 << 1
+)
+
+// ErrI2CNACK is returned when an I2C transfer is not acknowledged by the
+// peripheral, e.g. because there is no device at the address.
+var ErrI2CNACK = errors.New("I2C transfer not acknowledged")
+
+var (
+	// reI2CXferRead matches the bytes read by "ectool i2cxfer", e.g.
+	// "Read bytes: 0xa 0x1b 0".
+	reI2CXferRead = regexp.MustCompile(`Read bytes:((?:\s+0[xX]?[0-9a-fA-F]*)*)`)
+	// reI2CXferStatus matches the status of a failed "ectool i2cxfer"
+	// transfer, e.g. "Transfer failed with status=0x1".
+	reI2CXferStatus = regexp.MustCompile(`Transfer failed with status=(0x[0-9a-fA-F]+)`)
+)
+
+// checkI2CArgs checks that port, addr and offset are valid arguments for the
+// "i2cxfer" command.
+func checkI2CArgs(port, addr, offset int) error {
+	if port < 0 {
+		return errors.Errorf("invalid I2C port %d", port)
+	}
+	if addr < 0 || addr > i2cMaxAddr {
+		return errors.Errorf("I2C address 0x%x is out of the 7-bit range", addr)
+	}
+	if offset < 0 || offset > i2cMaxOffset {
+		return errors.Errorf("I2C offset 0x%x is out of range", offset)
+	}
+	return nil
+}
+
+// i2cXfer runs a single I2C transfer on the EC with "ectool i2cxfer", which
+// writes the bytes of data to the peripheral at the 7-bit address addr on port,
+// then reads readLen bytes from it. ErrI2CNACK is returned if the peripheral
+// does not acknowledge the transfer.
+func (h *Helper) i2cXfer(ctx context.Context, port, addr, readLen int, data []byte) ([]byte, error) {
+	args := []string{strconv.Itoa(port), "0x" + strconv.FormatInt(int64(addr), 16), strconv.Itoa(readLen)}
+	for _, b := range data {
+		args = append(args, "0x"+strconv.FormatInt(int64(b), 16))
+	}
+	out, err := NewECTool(h.DUT, ECToolNameMain).I2C(ctx, I2Cxfer, args...)
+	if err != nil {
+		if m := reI2CXferStatus.FindStringSubmatch(err.Error()); m != nil {
+			if status, perr := strconv.ParseUint(m[1], 0, 8); perr == nil && status&(i2cStatusNAK|i2cStatusTimeout) == i2cStatusNAK {
+				return nil, errors.Wrap(ErrI2CNACK, err.Error())
+			}
+		}
+		return nil, err
+	}
+	if readLen == 0 {
+		return nil, nil
+	}
+	m := reI2CXferRead.FindStringSubmatch(out)
+	if m == nil {
+		return nil, errors.Errorf("no data in ectool output %q", out)
+	}
+	var read []byte
+	for _, f := range strings.Fields(m[1]) {
+		b, err := strconv.ParseUint(f, 0, 8)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse I2C data %q", f)
+		}
+		read = append(read, byte(b))
+	}
+	if len(read) != readLen {
+		return nil, errors.Errorf("unexpected I2C data length: got %d, want %d", len(read), readLen)
+	}
+	return read, nil
+}
+
+// I2CRead reads length bytes from the register at offset of the peripheral at
+// the 7-bit address addr on the EC I2C port, in a single "ectool i2cxfer"
+// transfer writing the offset and reading the bytes. ErrI2CNACK is returned if
+// the peripheral does not acknowledge the transfer.
+func (h *Helper) I2CRead(ctx context.Context, port, addr, offset, length int) ([]byte, error) {
+	if err := checkI2CArgs(port, addr, offset); err != nil {
+		return nil, err
+	}
+	if length <= 0 || length > i2cMaxReadLen {
+		return nil, errors.Errorf("invalid I2C read length %d, must be in [1, %d]", length, i2cMaxReadLen)
+	}
+	data, err := h.i2cXfer(ctx, port, addr, length, []byte{byte(offset)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read 0x%x from 0x%x on port %d", offset, addr, port)
+	}
+	return data, nil
+}
+
+// I2CWrite writes data to the peripheral at the 7-bit address addr on the EC
+// I2C port, in a single "ectool i2cxfer" transfer. The first byte of data is
+// the register offset, and the following bytes are written to the consecutive
+// registers starting from it. ErrI2CNACK is returned if the peripheral does
+// not acknowledge the transfer.
+func (h *Helper) I2CWrite(ctx context.Context, port, addr int, data []byte) error {
+	if len(data) < 2 {
+		return errors.Errorf("I2C write needs an offset and at least one byte, got %d bytes", len(data))
+	}
+	offset := int(data[0])
+	if err := checkI2CArgs(port, addr, offset+len(data)-2); err != nil {
+		return err
+	}
+	if _, err := h.i2cXfer(ctx, port, addr, 0, data); err != nil {
+		return errors.Wrapf(err, "failed to write %d bytes at 0x%x to 0x%x on port %d", len(data)-1, offset, addr, port)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// keyscanRows is the number of rows of the keyboard matrix reported by the EC.
+// Each column is reported as a bitmask of its rows in one byte.
+const keyscanRows = 8
+
+// reKeyscanState matches the debounced keyboard matrix state printed by the
+// EC console command "ksstate", e.g. "[12.345678 KB debounced : -- 04 -- ...]".
+// Each entry is the bitmask of the pressed rows in a column, or "--" if none.
+var reKeyscanState = regexp.MustCompile(`KB debounced\s*:((?:\s+(?:[0-9a-fA-F]{2}|--))+)\]`)
+
+// ReadKeyscan returns the debounced keyboard matrix state reported by the EC
+// console "ksstate" command. The result is indexed by [row][column] and is
+// true for the keys which are pressed. The number of columns is the one
+// reported by the EC, which differs across boards.
+func (h *Helper) ReadKeyscan(ctx context.Context) ([][]bool, error) {
+	if err := h.RequireServo(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to servo")
+	}
+	out, err := h.Servo.RunECCommandGetOutput(ctx, "ksstate", []string{reKeyscanState.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run ksstate")
+	}
+	return parseKeyscan(out[0][1])
+}
+
+// parseKeyscan parses the column bitmasks printed by "ksstate" into a matrix
+// indexed by [row][column].
+func parseKeyscan(state string) ([][]bool, error) {
+	cols := strings.Fields(state)
+	if len(cols) == 0 {
+		return nil, errors.New("no columns in keyboard scan state")
+	}
+	grid := make([][]bool, keyscanRows)
+	for r := range grid {
+		grid[r] = make([]bool, len(cols))
+	}
+	for c, col := range cols {
+		if col == "--" {
+			continue
+		}
+		mask, err := strconv.ParseUint(col, 16, 8)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse column %d state %q", c, col)
+		}
+		for r := 0; r < keyscanRows; r++ {
+			grid[r][c] = mask&(1<<uint(r)) != 0
+		}
+	}
+	return grid, nil
+}
+
+// CheckKeyscanKey checks that the key at row and col of the keyboard matrix is
+// pressed or released, as specified by pressed.
+func (h *Helper) CheckKeyscanKey(ctx context.Context, row, col int, pressed bool) error {
+	grid, err := h.ReadKeyscan(ctx)
+	if err != nil {
+		return err
+	}
+	if row < 0 || row >= len(grid) || col < 0 || col >= len(grid[0]) {
+		return errors.Errorf("key (%d, %d) is out of the %dx%d keyboard matrix", row, col, len(grid), len(grid[0]))
+	}
+	if got := grid[row][col]; got != pressed {
+		return errors.Errorf("unexpected state of key (%d, %d): got pressed=%t, want %t", row, col, got, pressed)
+	}
+	return nil
+}
@@ -8,11 +8,14 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"chromiumos/tast/common/servo"
 	"chromiumos/tast/common/xmlrpc"
+	"chromiumos/tast/ctxutil"
 	"chromiumos/tast/errors"
 	"chromiumos/tast/testing"
 )
@@ -39,6 +42,33 @@ type RPM struct {
 
 	// powerunitHostname, powerunitOutlet, hydraHostname identify the managed power outlet for the DUT.
 	powerunitHostname, powerunitOutlet, hydraHostname string
+
+	// outletStates holds the last power state successfully set on each outlet,
+	// or read with State. Not all RPM servers expose the state of the outlets,
+	// so this may be the only information about it.
+	outletStates map[string]PowerState
+	// outletStatesMu protects outletStates, which is also updated by the
+	// goroutines started by SchedulePowerOn.
+	outletStatesMu sync.Mutex
+
+	// maxRetries and retryDelay configure the retries of the calls failing
+	// with ErrTransport, see WithRetry.
+	maxRetries int
+	retryDelay time.Duration
+}
+
+// Option is the type of options to create RPM object.
+type Option func(*RPM)
+
+// WithRetry returns an option which makes RPM retry the calls to the RPM
+// server up to maxRetries times when they fail with ErrTransport, i.e. when
+// the connection is dropped. The n-th retry is done after baseDelay*2^(n-1).
+// Calls rejected by the server, e.g. with ErrOutletUnknown, are not retried.
+func WithRetry(maxRetries int, baseDelay time.Duration) Option {
+	return func(r *RPM) {
+		r.maxRetries = maxRetries
+		r.retryDelay = baseDelay
+	}
 }
 
 // Use the RemoteRPMHost if you are outside of the lab, and LocalRPMHost if inside.
@@ -48,9 +78,133 @@ const (
 	DefaultRPMPort int    = 9999
 )
 
+const (
+	// MaxLongPowerOffDuration is the longest power-off window allowed by RecoverByLongPowerOff.
+	MaxLongPowerOffDuration = 10 * time.Minute
+	// setPowerTimeout is the timeout of a set_power_via_rpm call.
+	setPowerTimeout = 2 * time.Minute
+)
+
+// Errors categorizing the failures of the operations of RPM, to be matched
+// with errors.Is. For example, ErrTransport is worth retrying while
+// ErrOutletUnknown is not.
+var (
+	// ErrOutletUnknown means that the RPM server does not know the outlet or
+	// the power unit it was asked to operate.
+	ErrOutletUnknown = errors.New("unknown outlet")
+	// ErrTransport means that the RPM server could not be reached, or that
+	// its response could not be read.
+	ErrTransport = errors.New("failed to communicate with rpm server")
+	// ErrFault means that the RPM server failed to perform the operation.
+	ErrFault = errors.New("rpm server failed the operation")
+	// ErrUnsupported means that the RPM server does not implement the
+	// operation.
+	ErrUnsupported = errors.New("operation not supported by rpm server")
+)
+
+// unknownOutletRE matches the reasons of the faults reported by the RPM server
+// when it does not know the outlet, the power unit or the DUT.
+var unknownOutletRE = regexp.MustCompile(`(?i)(unknown|no such|not found|invalid).*(outlet|powerunit|power unit|pdu|host|dut)`)
+
+// unsupportedMethodRE matches the reasons of the faults reported by the RPM
+// server when it does not implement the called method.
+var unsupportedMethodRE = regexp.MustCompile(`(?i)method .*(not supported|not found|does not exist)|unknown method|no such method`)
+
+const (
+	// setPowerMethod is the XML-RPC method to set the power state of an outlet.
+	setPowerMethod = "set_power_via_rpm"
+	// getPowerMethod is the XML-RPC method to get the power state of an
+	// outlet, which is not implemented by all RPM servers.
+	getPowerMethod = "get_power_via_rpm"
+	// listMethodsMethod is the standard XML-RPC introspection method listing
+	// the methods of the server, as registered by the
+	// register_introspection_functions of Python's SimpleXMLRPCServer.
+	listMethodsMethod = "system.listMethods"
+	// pduInfoMethod is the XML-RPC method to get the model and firmware
+	// version of a PDU, returned as a struct with the "model" and
+	// "firmware_version" members. It is not known to be implemented by the lab
+	// RPM server, so it is only called if listMethodsMethod lists it.
+	pduInfoMethod = "get_pdu_info"
+)
+
+// Error is returned by the operations of RPM when a call to the RPM server
+// fails. Its category can be matched with errors.Is against ErrOutletUnknown,
+// ErrTransport, ErrFault and ErrUnsupported, and its cause, e.g. an xmlrpc.FaultError, can be
+// extracted with errors.As.
+type Error struct {
+	// Kind is one of ErrOutletUnknown, ErrTransport, ErrFault and ErrUnsupported.
+	Kind error
+	// Method is the XML-RPC method which failed.
+	Method string
+	// cause is the error returned by the call, if any.
+	cause error
+}
+
+// Error returns the message of e.
+func (e *Error) Error() string {
+	if e.cause == nil {
+		return fmt.Sprintf("%s: %v", e.Method, e.Kind)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Method, e.Kind, e.cause)
+}
+
+// Unwrap returns the cause of e.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is the category of e.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newCallError categorizes err returned by a call of method to the RPM server.
+func newCallError(method string, err error) *Error {
+	var fault xmlrpc.FaultError
+	if !errors.As(err, &fault) {
+		return &Error{Kind: ErrTransport, Method: method, cause: err}
+	}
+	if unsupportedMethodRE.MatchString(fault.Reason) {
+		return &Error{Kind: ErrUnsupported, Method: method, cause: err}
+	}
+	if unknownOutletRE.MatchString(fault.Reason) {
+		return &Error{Kind: ErrOutletUnknown, Method: method, cause: err}
+	}
+	return &Error{Kind: ErrFault, Method: method, cause: err}
+}
+
+// newRejectedError returns the error for a set_power_via_rpm call which
+// returned false.
+func newRejectedError() *Error {
+	return &Error{Kind: ErrFault, Method: setPowerMethod, cause: errors.New("returned false")}
+}
+
+// call runs cl, a call of method, on the RPM server, retrying it as configured
+// with WithRetry while it fails with ErrTransport. It returns an *Error on
+// failure.
+func (r *RPM) call(ctx context.Context, method string, cl xmlrpc.Call, out ...interface{}) error {
+	delay := r.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := r.xmlrpc.Run(ctx, cl, out...)
+		if err == nil {
+			return nil
+		}
+		callErr := newCallError(method, err)
+		if !errors.Is(callErr, ErrTransport) || attempt >= r.maxRetries || ctx.Err() != nil {
+			return callErr
+		}
+		testing.ContextLogf(ctx, "Retrying %s in %v after failure: %v", method, delay, err)
+		if err := testing.Sleep(ctx, delay); err != nil {
+			return callErr
+		}
+		delay *= 2
+	}
+}
+
 // NewLabRPM creates a new RPM object for communicating with a RPM server in the lab.
 // `hydraHostname` is optional, the other params are required.
-func NewLabRPM(ctx context.Context, pxy *servo.Proxy, dutHostname, powerunitHostname, powerunitOutlet, hydraHostname string) (*RPM, error) {
+// By default, failed calls are not retried, see WithRetry.
+func NewLabRPM(ctx context.Context, pxy *servo.Proxy, dutHostname, powerunitHostname, powerunitOutlet, hydraHostname string, opts ...Option) (*RPM, error) {
 	rpmHost := LocalRPMHost
 	port := DefaultRPMPort
 	if _, err := net.ResolveIPAddr("ip", rpmHost); err != nil {
@@ -80,6 +234,12 @@ func NewLabRPM(ctx context.Context, pxy *servo.Proxy, dutHostname, powerunitHost
 		powerunitOutlet:   powerunitOutlet,
 		hydraHostname:     hydraHostname,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.maxRetries < 0 || (r.maxRetries > 0 && r.retryDelay <= 0) {
+		return nil, errors.Errorf("invalid retry options: max retries %d, base delay %v", r.maxRetries, r.retryDelay)
+	}
 
 	return r, nil
 }
@@ -91,7 +251,7 @@ func (r *RPM) Close(ctx context.Context) error {
 		if ok, err := r.SetPower(ctx, On); err != nil {
 			return errors.Wrap(err, "failed to restore rpm power")
 		} else if !ok {
-			return errors.New("failed to restore rpm power")
+			return errors.Wrap(newRejectedError(), "failed to restore rpm power")
 		}
 	}
 	return nil
@@ -100,14 +260,341 @@ func (r *RPM) Close(ctx context.Context) error {
 // SetPower sets the power state for a plug managed by RPM.
 // Returns the bool returned by the xml rpc call, or error if the call failed.
 // It is unclear under which situations the api will return false with no error.
+// A failed call returns an *Error, see ErrOutletUnknown, ErrTransport and ErrFault.
 func (r *RPM) SetPower(ctx context.Context, state PowerState) (bool, error) {
-	var success bool
-	err := r.xmlrpc.Run(ctx, xmlrpc.NewCallTimeout("set_power_via_rpm", 2*time.Minute, r.dutHostname, r.powerunitHostname, r.powerunitOutlet, r.hydraHostname, string(state)), &success)
+	success, err := r.setPowerOnOutlet(ctx, r.powerunitOutlet, state)
 	if err != nil {
-		return false, errors.Wrap(err, "set power via rpm")
+		return false, err
 	}
 	if success {
 		r.restoreRPMPower = state == Off
 	}
 	return success, err
 }
+
+// setPowerOnOutlet sets the power state of the given outlet of the DUT's power unit.
+func (r *RPM) setPowerOnOutlet(ctx context.Context, outlet string, state PowerState) (bool, error) {
+	if outlet == "" || r.powerunitHostname == "" {
+		return false, &Error{Kind: ErrOutletUnknown, Method: setPowerMethod, cause: errors.New("no outlet is configured")}
+	}
+	var success bool
+	if err := r.call(ctx, setPowerMethod, xmlrpc.NewCallTimeout(setPowerMethod, setPowerTimeout, r.dutHostname, r.powerunitHostname, outlet, r.hydraHostname, string(state)), &success); err != nil {
+		return false, err
+	}
+	if success {
+		if state == Cycle {
+			state = On
+		}
+		r.outletStatesMu.Lock()
+		if r.outletStates == nil {
+			r.outletStates = make(map[string]PowerState)
+		}
+		r.outletStates[outlet] = state
+		r.outletStatesMu.Unlock()
+	}
+	return success, nil
+}
+
+// State queries the RPM server for the power state of the DUT's outlet, and
+// returns whether the outlet is energized. If the RPM server does not
+// implement the query, the returned error matches ErrUnsupported with
+// errors.Is.
+func (r *RPM) State(ctx context.Context) (bool, error) {
+	state, err := r.outletState(ctx, r.powerunitOutlet)
+	if err != nil {
+		return false, err
+	}
+	return state == On, nil
+}
+
+// outletState queries the RPM server for the power state of the given outlet
+// of the DUT's power unit, and records it.
+func (r *RPM) outletState(ctx context.Context, outlet string) (PowerState, error) {
+	if outlet == "" || r.powerunitHostname == "" {
+		return "", &Error{Kind: ErrOutletUnknown, Method: getPowerMethod, cause: errors.New("no outlet is configured")}
+	}
+	var state string
+	if err := r.call(ctx, getPowerMethod, xmlrpc.NewCall(getPowerMethod, r.dutHostname, r.powerunitHostname, outlet, r.hydraHostname), &state); err != nil {
+		return "", err
+	}
+	if s := PowerState(state); s != On && s != Off {
+		return "", &Error{Kind: ErrFault, Method: getPowerMethod, cause: errors.Errorf("unexpected power state %q", state)}
+	}
+	r.outletStatesMu.Lock()
+	if r.outletStates == nil {
+		r.outletStates = make(map[string]PowerState)
+	}
+	r.outletStates[outlet] = PowerState(state)
+	r.outletStatesMu.Unlock()
+	return PowerState(state), nil
+}
+
+// currentState returns the power state of outlet as queried from the RPM
+// server. If the server does not implement the query, the last state set or
+// read through r is returned instead, and known is false if there is none.
+func (r *RPM) currentState(ctx context.Context, outlet string) (state PowerState, known bool, err error) {
+	state, err = r.outletState(ctx, outlet)
+	if err == nil {
+		return state, true, nil
+	}
+	if !errors.Is(err, ErrUnsupported) {
+		return "", false, errors.Wrapf(err, "failed to get the state of outlet %s", outlet)
+	}
+	r.outletStatesMu.Lock()
+	defer r.outletStatesMu.Unlock()
+	state, known = r.outletStates[outlet]
+	return state, known, nil
+}
+
+// EnsurePoweredOn turns on outlet unless it is on already, so that a running
+// DUT is not disturbed. If outlet is empty, the DUT's outlet is used. The state
+// of the outlet is queried from the RPM server. If the server does not
+// implement the query, the state is known only if it was set through r
+// before; otherwise the on command is issued.
+// Returns whether the on command was issued.
+func (r *RPM) EnsurePoweredOn(ctx context.Context, outlet string) (bool, error) {
+	return r.ensurePowerState(ctx, outlet, On)
+}
+
+// EnsurePoweredOff turns off outlet unless it is off already.
+// See EnsurePoweredOn for how the outlet state is determined.
+// Returns whether the off command was issued.
+func (r *RPM) EnsurePoweredOff(ctx context.Context, outlet string) (bool, error) {
+	return r.ensurePowerState(ctx, outlet, Off)
+}
+
+// ensurePowerState sets outlet to state unless it is in state already, see
+// currentState.
+func (r *RPM) ensurePowerState(ctx context.Context, outlet string, state PowerState) (bool, error) {
+	if outlet == "" {
+		outlet = r.powerunitOutlet
+	}
+	cur, known, err := r.currentState(ctx, outlet)
+	if err != nil {
+		return false, err
+	}
+	if known && cur == state {
+		testing.ContextLogf(ctx, "Outlet %s is already %s", outlet, state)
+		return false, nil
+	}
+	testing.ContextLogf(ctx, "Setting outlet %s to %s", outlet, state)
+	if ok, err := r.setPowerOnOutlet(ctx, outlet, state); err != nil {
+		return false, errors.Wrapf(err, "failed to set outlet %s to %s", outlet, state)
+	} else if !ok {
+		return false, errors.Wrapf(newRejectedError(), "rpm server did not set outlet %s to %s", outlet, state)
+	}
+	if outlet == r.powerunitOutlet {
+		r.restoreRPMPower = state == Off
+	}
+	return true, nil
+}
+
+// RecoverByLongPowerOff removes power from outlet for the full duration, then restores it.
+// This is meant to recover DUTs which are wedged and do not recover with a regular power cycle.
+// If outlet is empty, the DUT's outlet is used. The duration is capped at MaxLongPowerOffDuration.
+// The state of the outlet is queried from the RPM server after it is turned off, at the end of
+// the window to make sure power stayed off, and after power is restored. If the server does not
+// implement the query, the state is confirmed by the result of each set_power_via_rpm call
+// instead, and turning the power off is asserted again at the end of the window. Power is
+// restored even if ctx is cancelled during the power-off window.
+func (r *RPM) RecoverByLongPowerOff(ctx context.Context, outlet string, duration time.Duration) error {
+	if outlet == "" {
+		outlet = r.powerunitOutlet
+	}
+	if duration <= 0 {
+		return errors.Errorf("invalid power-off duration %v", duration)
+	}
+	if duration > MaxLongPowerOffDuration {
+		testing.ContextLogf(ctx, "Capping power-off duration %v to %v", duration, MaxLongPowerOffDuration)
+		duration = MaxLongPowerOffDuration
+	}
+
+	// Reserve time to restore the power and confirm it is restored.
+	restoreCtx := ctx
+	ctx, cancel := ctxutil.Shorten(ctx, 2*setPowerTimeout)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < duration {
+		return errors.Errorf("insufficient time left for a %v power-off window: %v", duration, time.Until(deadline))
+	}
+
+	if ok, err := r.setPowerOnOutlet(ctx, outlet, Off); err != nil {
+		return errors.Wrapf(err, "failed to turn off outlet %s", outlet)
+	} else if !ok {
+		return errors.Wrapf(newRejectedError(), "rpm server did not turn off outlet %s", outlet)
+	}
+	offStart := time.Now()
+
+	var sleepErr error
+	if err := r.confirmOutletState(ctx, outlet, Off); err != nil && !errors.Is(err, ErrUnsupported) {
+		sleepErr = errors.Wrapf(err, "failed to confirm outlet %s is off", outlet)
+	} else {
+		sleepErr = testing.Sleep(ctx, duration)
+	}
+	if sleepErr == nil {
+		switch err := r.confirmOutletState(ctx, outlet, Off); {
+		case err == nil:
+		case !errors.Is(err, ErrUnsupported):
+			sleepErr = errors.Wrapf(err, "failed to confirm outlet %s stayed off", outlet)
+		default:
+			// The state cannot be queried, so turning the power off is asserted again.
+			if ok, err := r.setPowerOnOutlet(ctx, outlet, Off); err != nil {
+				sleepErr = errors.Wrapf(err, "failed to confirm outlet %s is off", outlet)
+			} else if !ok {
+				sleepErr = errors.Wrapf(newRejectedError(), "rpm server could not confirm outlet %s is off", outlet)
+			}
+		}
+	}
+	testing.ContextLogf(ctx, "Outlet %s was powered off for %v", outlet, time.Since(offStart).Round(time.Millisecond))
+	if ok, err := r.setPowerOnOutlet(restoreCtx, outlet, On); err != nil {
+		return errors.Wrapf(err, "failed to restore power on outlet %s", outlet)
+	} else if !ok {
+		return errors.Wrapf(newRejectedError(), "rpm server did not restore power on outlet %s", outlet)
+	}
+	if err := r.confirmOutletState(restoreCtx, outlet, On); err != nil && !errors.Is(err, ErrUnsupported) {
+		return errors.Wrapf(err, "failed to confirm power is restored on outlet %s", outlet)
+	}
+	if sleepErr != nil {
+		return errors.Wrap(sleepErr, "power-off window failed")
+	}
+	return nil
+}
+
+// confirmOutletState queries the RPM server for the power state of outlet and
+// returns an error if it is not want. If the server does not implement the
+// query, the returned error matches ErrUnsupported with errors.Is.
+func (r *RPM) confirmOutletState(ctx context.Context, outlet string, want PowerState) error {
+	state, err := r.outletState(ctx, outlet)
+	if err != nil {
+		return err
+	}
+	if state != want {
+		return errors.Errorf("outlet %s is %s, want %s", outlet, state, want)
+	}
+	return nil
+}
+
+// ScheduledPowerOn is a power-on scheduled by SchedulePowerOn.
+type ScheduledPowerOn struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Cancel cancels the power-on if it has not been issued yet, and waits for the
+// goroutine of the power-on to exit.
+func (p *ScheduledPowerOn) Cancel() {
+	p.cancel()
+	<-p.done
+}
+
+// Wait waits until the power-on is issued or canceled, and returns an error if
+// it was canceled or failed.
+func (p *ScheduledPowerOn) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// SchedulePowerOn turns on outlet after the delay, in a goroutine. It returns
+// immediately, and the power-on can be waited for or canceled with the
+// returned handle. If ctx is canceled before the power-on is issued, the
+// power-on is canceled and the goroutine exits. If outlet is empty, the DUT's
+// outlet is used.
+//
+// Note that the restore-on-close tracking of the DUT's outlet is not updated
+// by the scheduled power-on, so Close still turns the power on if it was
+// turned off with SetPower.
+func (r *RPM) SchedulePowerOn(ctx context.Context, outlet string, after time.Duration) *ScheduledPowerOn {
+	if outlet == "" {
+		outlet = r.powerunitOutlet
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &ScheduledPowerOn{cancel: cancel, done: make(chan struct{})}
+	testing.ContextLogf(ctx, "Scheduling power-on of outlet %s in %v", outlet, after)
+	go func() {
+		defer close(p.done)
+		defer cancel()
+		if err := testing.Sleep(ctx, after); err != nil {
+			p.err = errors.Wrapf(err, "scheduled power-on of outlet %s canceled", outlet)
+			return
+		}
+		testing.ContextLogf(ctx, "Turning on outlet %s as scheduled", outlet)
+		if ok, err := r.setPowerOnOutlet(ctx, outlet, On); err != nil {
+			p.err = errors.Wrapf(err, "failed to turn on outlet %s", outlet)
+		} else if !ok {
+			p.err = errors.Wrapf(newRejectedError(), "rpm server did not turn on outlet %s", outlet)
+		}
+	}()
+	return p
+}
+
+// PowerOnAndWaitForBoot turns on outlet unless it is on already,
+// see EnsurePoweredOn, and then waits for the DUT to boot by calling
+// waitReachable, which typically waits for the DUT to accept SSH connections.
+// If outlet is empty, the DUT's outlet is used. It returns the time from
+// powering on to the DUT being reachable.
+func (r *RPM) PowerOnAndWaitForBoot(ctx context.Context, outlet string, waitReachable func(context.Context) error) (time.Duration, error) {
+	if outlet == "" {
+		outlet = r.powerunitOutlet
+	}
+	start := time.Now()
+	if _, err := r.EnsurePoweredOn(ctx, outlet); err != nil {
+		return 0, err
+	}
+	if err := waitReachable(ctx); err != nil {
+		return 0, errors.Wrapf(err, "DUT did not come back within %v after powering on outlet %s", time.Since(start).Round(time.Second), outlet)
+	}
+	elapsed := time.Since(start)
+	testing.ContextLogf(ctx, "DUT became reachable %v after powering on outlet %s", elapsed.Round(time.Millisecond), outlet)
+	return elapsed, nil
+}
+
+// ServerInfo describes the RPM server and the PDU of the DUT. Fields which
+// the server does not report are left empty.
+type ServerInfo struct {
+	// Model is the model of the PDU.
+	Model string
+	// FirmwareVersion is the firmware version of the PDU.
+	FirmwareVersion string
+	// Features are the XML-RPC methods supported by the server.
+	Features []string
+}
+
+// GetServerInfo queries the RPM server for the methods it supports with the
+// standard listMethodsMethod introspection, and for the model and firmware
+// version of the PDU of the DUT with pduInfoMethod if the server lists it. Not
+// all RPM servers implement these queries, so the information which is not
+// available is left empty rather than reported as an error. The calls are
+// retried as configured with WithRetry, and an error is returned only if the
+// server cannot be reached.
+func (r *RPM) GetServerInfo(ctx context.Context) (ServerInfo, error) {
+	var info ServerInfo
+	if err := r.call(ctx, listMethodsMethod, xmlrpc.NewCall(listMethodsMethod), &info.Features); err != nil {
+		if errors.Is(err, ErrTransport) {
+			return ServerInfo{}, errors.Wrap(err, "failed to query rpm server")
+		}
+		testing.ContextLog(ctx, "RPM server does not support introspection: ", err)
+	}
+
+	supported := false
+	for _, m := range info.Features {
+		if m == pduInfoMethod {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		testing.ContextLogf(ctx, "RPM server does not list %s, PDU info is unknown", pduInfoMethod)
+		return info, nil
+	}
+	var pdu map[string]string
+	if err := r.call(ctx, pduInfoMethod, xmlrpc.NewCall(pduInfoMethod, r.powerunitHostname), &pdu); err != nil {
+		if errors.Is(err, ErrTransport) {
+			return ServerInfo{}, errors.Wrapf(err, "failed to get info of PDU %s", r.powerunitHostname)
+		}
+		testing.ContextLogf(ctx, "Failed to get info of PDU %s: %v", r.powerunitHostname, err)
+		return info, nil
+	}
+	info.Model = pdu["model"]
+	info.FirmwareVersion = pdu["firmware_version"]
+	return info, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package netperf
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/network/cmd"
+	"chromiumos/tast/ssh"
+	"chromiumos/tast/ssh/linuxssh"
+	"chromiumos/tast/testing"
+)
+
+const (
+	// captureSnaplen truncates captured packets to their headers, which is
+	// enough to debug throughput issues and keeps the pcap files small.
+	captureSnaplen = 128
+	// captureMaxPackets bounds the size of a pcap file to roughly
+	// captureSnaplen * captureMaxPackets bytes.
+	captureMaxPackets = 200000
+	// captureStartTimeout is how long to wait for tcpdump to create its output.
+	captureStartTimeout = 10 * time.Second
+	// captureStopTimeout is how long to wait for tcpdump to exit once signaled.
+	captureStopTimeout = 10 * time.Second
+	// captureCloseTime is the time reserved for stopping the captures and
+	// collecting the pcap files.
+	captureCloseTime = 30 * time.Second
+)
+
+// trafficCapture is a tcpdump process capturing the netperf traffic on a host.
+type trafficCapture struct {
+	host RunnerHost
+	cmd  *ssh.Cmd
+	// tcpdumpPath is the path of tcpdump on the host, which starts the
+	// command line of the process.
+	tcpdumpPath string
+	remotePath  string
+	localPath   string
+}
+
+// startCapture starts capturing the netperf traffic on host. The capture is
+// written to outDir with a file name derived from name once stopped.
+func startCapture(ctx context.Context, host RunnerHost, name, outDir string) (*trafficCapture, error) {
+	tcpdumpPath, err := cmd.FindCmdPath(ctx, host.conn, "tcpdump")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find command tcpdump")
+	}
+	c := &trafficCapture{
+		host:        host,
+		tcpdumpPath: tcpdumpPath,
+		remotePath:  fmt.Sprintf("/tmp/netperf_%s_%d.pcap", name, time.Now().UnixNano()),
+		localPath:   filepath.Join(outDir, fmt.Sprintf("netperf_%s.pcap", name)),
+	}
+	c.cmd = host.conn.CommandContext(ctx, tcpdumpPath, "-U", "-i", "any",
+		"-s", strconv.Itoa(captureSnaplen),
+		"-c", strconv.Itoa(captureMaxPackets),
+		"-w", c.remotePath,
+		"port", strconv.Itoa(controlPort), "or", "port", strconv.Itoa(dataPort))
+	testing.ContextLogf(ctx, "Starting traffic capture on %s", host.ip)
+	if err := c.cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "failed to start tcpdump")
+	}
+	// tcpdump creates the output file once it is listening.
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		return host.conn.CommandContext(ctx, "test", "-e", c.remotePath).Run()
+	}, &testing.PollOptions{Timeout: captureStartTimeout}); err != nil {
+		c.stop(ctx)
+		return nil, errors.Wrap(err, "failed to wait for tcpdump to be ready")
+	}
+	return c, nil
+}
+
+// stop terminates the capture, and copies the pcap file to the local output
+// directory. The file on the host is removed in any case.
+func (c *trafficCapture) stop(ctx context.Context) error {
+	// TODO(crbug.com/1030635): Signal through SSH might not work. Use pkill instead.
+	c.host.conn.CommandContext(ctx, "pkill", "-f", fmt.Sprintf("^%s.*%s", c.tcpdumpPath, c.remotePath)).Run()
+	// tcpdump is expected to exit due to the signal above. If it does not,
+	// the command is aborted so that the pcap file is still collected.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.cmd.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(captureStopTimeout):
+		testing.ContextLogf(ctx, "tcpdump on %s did not exit within %v, aborting it", c.host.ip, captureStopTimeout)
+		c.cmd.Abort()
+		<-done
+	}
+	defer c.host.conn.CommandContext(ctx, "rm", "-f", c.remotePath).Run()
+	if err := linuxssh.GetFile(ctx, c.host.conn, c.remotePath, c.localPath, linuxssh.PreserveSymlinks); err != nil {
+		return errors.Wrapf(err, "failed to collect pcap file %s", c.remotePath)
+	}
+	return nil
+}
+
+// startCaptures starts capturing the netperf traffic on both the client and
+// the server of the session. On error, the captures already started are stopped.
+func (s *Session) startCaptures(ctx context.Context, cfg Config) ([]*trafficCapture, error) {
+	if cfg.OutDir == "" {
+		return nil, errors.New("OutDir must be set to capture traffic")
+	}
+	var captures []*trafficCapture
+	for _, h := range []struct {
+		role string
+		host RunnerHost
+	}{
+		{"client", s.client},
+		{"server", s.server},
+	} {
+		c, err := startCapture(ctx, h.host, fmt.Sprintf("%s_%d_%s", cfg.ShortTag(), s.runs, h.role), cfg.OutDir)
+		if err != nil {
+			stopCaptures(ctx, captures)
+			return nil, errors.Wrapf(err, "failed to start capture on %s", h.role)
+		}
+		captures = append(captures, c)
+	}
+	return captures, nil
+}
+
+// stopCaptures stops all the captures and returns the paths of the pcap files
+// which were collected successfully.
+func stopCaptures(ctx context.Context, captures []*trafficCapture) []string {
+	var files []string
+	for _, c := range captures {
+		if err := c.stop(ctx); err != nil {
+			testing.ContextLog(ctx, "Failed to stop traffic capture: ", err)
+			continue
+		}
+		files = append(files, c.localPath)
+	}
+	return files
+}
@@ -5,6 +5,8 @@
 package netperf
 
 import (
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,7 +22,7 @@ const (
 	// to the client.
 	TestTypeTCPMaerts = "TCP_MAERTS"
 	// TestTypeTCPRR measures how many times we can request a byte and receive
-	// a byte per second.
+	// a byte per second, and the percentiles of the round-trip latency.
 	TestTypeTCPRR = "TCP_RR"
 	// TestTypeTCPSendfile is like a TCP_STREAM test except that the netperf client
 	// will use a platform dependent call like sendfile() rather than the simple
@@ -32,33 +34,73 @@ const (
 	// TestTypeUDPRR measures how many times we can request a byte from the client
 	// and receive a byte from the server. If any datagram is dropped, the client
 	// or server will block indefinitely. This failure is not evident except
-	// as a low transaction rate.
+	// as a low transaction rate. The percentiles of the round-trip latency are
+	// reported as well.
 	TestTypeUDPRR = "UDP_RR"
 	// TestTypeUDPStream tests UDP throughput sending from the client to the server.
 	// There is no flow control here, and generally sending is easier that receiving,
-	// so there will be two types of throughput, both receiving and sending.
+	// so there will be two types of throughput, both receiving and sending. The
+	// throughput is taken from the receiving side, and the datagrams lost on the
+	// way are reported as CategoryPacketLoss.
 	TestTypeUDPStream = "UDP_STREAM"
 	// TestTypeUDPMaerts isn't a real test type, but we can emulate a UDP stream
 	// from the server to the DUT by running the netperf server on the DUT and the
 	// client on the server and then doing a UDP_STREAM test.
 	TestTypeUDPMaerts = "UDP_MAERTS"
+	// TestTypeUDPJitter isn't a real test type either. Netperf does not
+	// report jitter, so a UDP stream is sent at jitterStreamBandwidth from the
+	// client to the server with iperf instead, which stamps each datagram with
+	// its sequence number and send time. The server computes the inter-arrival
+	// jitter (RFC 3550) and counts the datagrams received out of order, which
+	// are reported along with the throughput and the packet loss.
+	TestTypeUDPJitter = "UDP_JITTER"
 )
 
 // Config defines configuration for netperf run.
 type Config struct {
 	// TestTime how long the test should be run.
 	TestTime time.Duration
+	// WarmupTime is how long the test is run before the measurements by Run,
+	// with the same parameters, to get the link past its cold-start ramp. Its
+	// result is discarded. Zero means no warmup.
+	WarmupTime time.Duration
 	// TestType is literally this: test type.
 	TestType TestType
 	// Reverse: reverse client and server roles.
 	Reverse bool
+	// CaptureTraffic enables capturing the test traffic on both endpoints
+	// with tcpdump. The pcap files are written to OutDir and referenced in
+	// the results.
+	CaptureTraffic bool
+	// OutDir is the directory where the pcap files are written.
+	OutDir string
+	// CPUAffinity is the list of CPU cores netperf and netserver are pinned
+	// to with taskset. Empty means no pinning.
+	CPUAffinity []int
+	// ReportInterval is the interval of the results reported by
+	// RunContinuous. Zero means defaultReportInterval.
+	ReportInterval time.Duration
+	// RollingWindow is the number of the last results aggregated in each
+	// report of RunContinuous. Zero means defaultRollingWindow.
+	RollingWindow int
 }
 
 const (
 	dataPort                    = 12866
 	controlPort                 = 12865
+	maxParallelRuns             = 4 // Maximum number of tests run by RunParallel, each on its own data port from dataPort.
 	netservStartupWaitTime      = 3 * time.Second
 	netperfCommandTimeoutMargin = 30 * time.Second
+	defaultReportInterval       = 10 * time.Second
+	defaultRollingWindow        = 6 // One minute of results at defaultReportInterval.
+	// udpMessageSize is the size of the datagrams of UDP streams. It keeps
+	// the IP packets within the usual MTU of 1500 bytes, since the loss of any
+	// fragment would drop the whole datagram and inflate the packet loss.
+	udpMessageSize = 1400
+	// jitterStreamBandwidth is the rate in bit/s of the UDP stream of
+	// TestTypeUDPJitter, in the range of a video call. The stream must not
+	// saturate the link, or the queueing delay would dominate the jitter.
+	jitterStreamBandwidth = 2000000
 )
 
 var shortTags = map[TestType]string{
@@ -70,6 +112,7 @@ var shortTags = map[TestType]string{
 	TestTypeUDPRR:       "udp_rr",
 	TestTypeUDPStream:   "udp_tx",
 	TestTypeUDPMaerts:   "udp_rx",
+	TestTypeUDPJitter:   "udp_jitter",
 }
 
 var readableTags = map[TestType]string{
@@ -81,6 +124,7 @@ var readableTags = map[TestType]string{
 	TestTypeUDPRR:       "udp_roundtrip",
 	TestTypeUDPStream:   "udp_upstream",
 	TestTypeUDPMaerts:   "udp_downstream",
+	TestTypeUDPJitter:   "udp_jitter",
 }
 
 // ShortTag returns shortened tag representative to the configuration.
@@ -92,3 +136,12 @@ func (c *Config) ShortTag() string {
 func (c *Config) HumanReadableTag() string {
 	return readableTags[c.TestType]
 }
+
+// cpuList returns CPUAffinity in the format of the taskset -c option.
+func (c *Config) cpuList() string {
+	cores := make([]string, len(c.CPUAffinity))
+	for i, core := range c.CPUAffinity {
+		cores[i] = strconv.Itoa(core)
+	}
+	return strings.Join(cores, ",")
+}
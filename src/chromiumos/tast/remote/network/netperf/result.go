@@ -33,8 +33,53 @@ const (
 	CategoryTransactionRateDev = "transaction rate dev"
 	// CategoryErrorsDev st. deviation of errors.
 	CategoryErrorsDev = "errors dev"
+	// CategoryPacketLoss measures the percentage of the datagrams sent but
+	// not received.
+	CategoryPacketLoss = "packet loss"
+	// CategoryPacketLossDev st. deviation of packet loss.
+	CategoryPacketLossDev = "packet loss dev"
+	// CategoryLatencyP50 measures the median round-trip latency in
+	// microseconds.
+	CategoryLatencyP50 = "latency p50"
+	// CategoryLatencyP90 measures the 90th percentile of the round-trip
+	// latency in microseconds.
+	CategoryLatencyP90 = "latency p90"
+	// CategoryLatencyP99 measures the 99th percentile of the round-trip
+	// latency in microseconds.
+	CategoryLatencyP99 = "latency p99"
+	// CategoryLatencyP50Dev st. deviation of the median latency.
+	CategoryLatencyP50Dev = "latency p50 dev"
+	// CategoryLatencyP90Dev st. deviation of the 90th percentile latency.
+	CategoryLatencyP90Dev = "latency p90 dev"
+	// CategoryLatencyP99Dev st. deviation of the 99th percentile latency.
+	CategoryLatencyP99Dev = "latency p99 dev"
+	// CategoryJitter measures the inter-arrival jitter of the datagrams in
+	// milliseconds.
+	CategoryJitter = "jitter"
+	// CategoryJitterDev st. deviation of jitter.
+	CategoryJitterDev = "jitter dev"
+	// CategoryOutOfOrder measures the number of datagrams received out of
+	// order.
+	CategoryOutOfOrder = "out of order"
+	// CategoryOutOfOrderDev st. deviation of out of order datagrams.
+	CategoryOutOfOrderDev = "out of order dev"
 )
 
+// Indices of the fields of the iperf server report in CSV format, which is
+// printed by the iperf client of TestTypeUDPJitter runs.
+const (
+	iperfBitRateIndex    = 8
+	iperfJitterIndex     = 9
+	iperfLostIndex       = 10
+	iperfLossIndex       = 12
+	iperfOutOfOrderIndex = 13
+	iperfReportFields    = 14
+)
+
+// rrOutputSelectors are the netperf omni output selectors of TestTypeTCPRR
+// and TestTypeUDPRR runs, in the order they are parsed.
+const rrOutputSelectors = "TRANSACTION_RATE,P50_LATENCY,P90_LATENCY,P99_LATENCY"
+
 // Result is used to carry either single result or its derivative
 // (mean/st.dev).
 type Result struct {
@@ -42,6 +87,8 @@ type Result struct {
 	Duration time.Duration
 	// Measurements: throughput, transactionRate, errors or their st.deviations.
 	Measurements map[Category]float64
+	// CaptureFiles are the paths of the pcap files of the run, if captured.
+	CaptureFiles []string
 }
 
 // NewResult returns initialized Result.
@@ -120,6 +167,9 @@ func parseNetperfOutput(ctx context.Context, testType TestType, results string,
 		txMsgs, _ := strconv.ParseFloat(strings.Fields(dataLines[0])[3], 64)
 		rxMsgs, _ := strconv.ParseFloat(strings.Fields(dataLines[1])[2], 64)
 		ret.Measurements[CategoryErrors] = txErrors + txMsgs - rxMsgs
+		if sent := txMsgs + txErrors; sent > 0 {
+			ret.Measurements[CategoryPacketLoss] = 100 * ret.Measurements[CategoryErrors] / sent
+		}
 
 	// Parses the following which works for both rr (TCP and UDP)
 	// and crr tests and returns a singleton containing transfer rate.
@@ -133,16 +183,88 @@ func parseNetperfOutput(ctx context.Context, testType TestType, results string,
 	//
 	// 16384  87380  1        1       2.00     14118.53
 	// 16384  87380
-	case TestTypeTCPCRR, TestTypeTCPRR, TestTypeUDPRR:
+	case TestTypeTCPCRR:
 		if len(dataLines) < 1 || len(strings.Fields(dataLines[0])) < 6 {
 			return nil, errors.New("no valid results found in the output")
 		}
 		ret.Measurements[CategoryTransactionRate], _ =
 			strconv.ParseFloat(strings.Fields(dataLines[0])[5], 64)
+
+	// Parses the following, which are the values of rrOutputSelectors.
+
+	// MIGRATED TCP REQUEST/RESPONSE TEST from 0.0.0.0 (0.0.0.0) port 0 \
+	// AF_INET to foo.bar.com (10.10.10.3) port 0 AF_INET : first burst 0
+	// Transaction Rate Tran/s,50th Percentile Latency Microseconds,...
+	// 3510.12,270,390,720
+	case TestTypeTCPRR, TestTypeUDPRR:
+		if err := parseOmniOutput(dataLines, ret, CategoryTransactionRate, CategoryLatencyP50, CategoryLatencyP90, CategoryLatencyP99); err != nil {
+			return nil, err
+		}
+
+	// Parses the following iperf output, where the first line is the report
+	// of the client and the second one the report of the server, with the
+	// jitter in ms, the lost and total datagrams, the loss percentage and the
+	// out of order datagrams at the end.
+
+	// 20221017101010,192.168.1.2,45678,192.168.1.3,12866,3,0.0-10.0,2500400,2000320
+	// 20221017101010,192.168.1.3,12866,192.168.1.2,45678,3,0.0-10.0,2497600,1997760,0.183,2,1786,0.112,1
+	case TestTypeUDPJitter:
+		var report []string
+		for _, line := range dataLines {
+			if fields := strings.Split(line, ","); len(fields) >= iperfReportFields {
+				report = fields
+			}
+		}
+		if report == nil {
+			return nil, errors.New("no server report found in the output")
+		}
+		for _, f := range []struct {
+			index    int
+			category Category
+			scale    float64
+		}{
+			// Throughput is in Mbps, as in the netperf output.
+			{iperfBitRateIndex, CategoryThroughput, 1e-6},
+			{iperfJitterIndex, CategoryJitter, 1},
+			{iperfLostIndex, CategoryErrors, 1},
+			{iperfLossIndex, CategoryPacketLoss, 1},
+			{iperfOutOfOrderIndex, CategoryOutOfOrder, 1},
+		} {
+			v, err := strconv.ParseFloat(strings.TrimSpace(report[f.index]), 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s in %q", f.category, strings.Join(report, ","))
+			}
+			ret.Measurements[f.category] = v * f.scale
+		}
 	}
 	return ret, nil
 }
 
+// parseOmniOutput parses the CSV values of the netperf omni output selectors
+// in the first of dataLines into the measurements of ret, in the order of
+// categories. Netperf reports the latency statistics it does not support as
+// -1, which is returned as an error instead of a measurement.
+func parseOmniOutput(dataLines []string, ret *Result, categories ...Category) error {
+	if len(dataLines) < 1 {
+		return errors.New("no valid results found in the output")
+	}
+	values := strings.Split(dataLines[0], ",")
+	if len(values) != len(categories) {
+		return errors.Errorf("unexpected omni output %q; the output selectors may not be supported by netperf", dataLines[0])
+	}
+	for i, category := range categories {
+		v, err := strconv.ParseFloat(strings.TrimSpace(values[i]), 64)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s in %q", category, dataLines[0])
+		}
+		if v < 0 {
+			return errors.Errorf("netperf does not report %s: got %v", category, v)
+		}
+		ret.Measurements[category] = v
+	}
+	return nil
+}
+
 // hasCategory check if samples set contains measurements of certain category,
 func hasCategory(samples []*Result, category Category) bool {
 	if len(samples) == 0 {
@@ -219,6 +341,23 @@ func AggregateSamples(ctx context.Context, samples []*Result) (*Result, error) {
 		ret.Measurements[CategoryErrors], ret.Measurements[CategoryErrorsDev], _ =
 			calculateStats(samples, CategoryErrors)
 	}
+	for _, m := range []struct {
+		val Category
+		dev Category
+	}{
+		{CategoryPacketLoss, CategoryPacketLossDev},
+		{CategoryLatencyP50, CategoryLatencyP50Dev},
+		{CategoryLatencyP90, CategoryLatencyP90Dev},
+		{CategoryLatencyP99, CategoryLatencyP99Dev},
+		{CategoryJitter, CategoryJitterDev},
+		{CategoryOutOfOrder, CategoryOutOfOrderDev},
+	} {
+		// Latency, jitter, packet loss and reordering always come together
+		// with transaction rate or throughput, no need to count valid samples.
+		if hasCategory(samples, m.val) {
+			ret.Measurements[m.val], ret.Measurements[m.dev], _ = calculateStats(samples, m.val)
+		}
+	}
 	ret.Duration = time.Duration(numSamples) * duration
 
 	return ret, nil
@@ -43,7 +43,21 @@ bytes   bytes    secs            #      #   10^6bits/sec
 			result: Result{
 				TestType:     TestTypeUDPStream,
 				Duration:     10 * time.Second,
-				Measurements: map[Category]float64{CategoryThroughput: 961.87, CategoryErrors: 2.0},
+				Measurements: map[Category]float64{CategoryThroughput: 961.87, CategoryErrors: 2.0, CategoryPacketLoss: 100 * 2.0 / 3674},
+			},
+		},
+		{testType: TestTypeUDPStream,
+			output: `UDP UNIDIRECTIONAL SEND TEST from 0.0.0.0 (0.0.0.0) port 0 AF_INET to foo.bar.com (10.10.10.3) port 0 AF_INET
+Socket  Message  Elapsed      Messages
+Size    Size     Time         Okay Errors   Throughput
+bytes   bytes    secs            #      #   10^6bits/sec
+
+212992    1400   10.00       200000      0     224.00
+212992           10.00       198000            221.76`,
+			result: Result{
+				TestType:     TestTypeUDPStream,
+				Duration:     10 * time.Second,
+				Measurements: map[Category]float64{CategoryThroughput: 221.76, CategoryErrors: 2000.0, CategoryPacketLoss: 1.0},
 			},
 		},
 		{testType: TestTypeTCPCRR,
@@ -61,6 +75,37 @@ bytes  Bytes  bytes    bytes   secs.    per sec
 				Measurements: map[Category]float64{CategoryTransactionRate: 14118.53},
 			},
 		},
+		{testType: TestTypeTCPRR,
+			output: `MIGRATED TCP REQUEST/RESPONSE TEST from 0.0.0.0 (0.0.0.0) port 12866 AF_INET to foo.bar.com (10.10.10.3) port 12866 AF_INET : first burst 0
+Transaction Rate Tran/s,50th Percentile Latency Microseconds,90th Percentile Latency Microseconds,99th Percentile Latency Microseconds
+3510.12,270,390,720`,
+			result: Result{
+				TestType:     TestTypeTCPRR,
+				Duration:     10 * time.Second,
+				Measurements: map[Category]float64{CategoryTransactionRate: 3510.12, CategoryLatencyP50: 270, CategoryLatencyP90: 390, CategoryLatencyP99: 720},
+			},
+		},
+		{testType: TestTypeUDPRR,
+			output: `MIGRATED UDP REQUEST/RESPONSE TEST from 0.0.0.0 (0.0.0.0) port 12866 AF_INET to foo.bar.com (10.10.10.3) port 12866 AF_INET : first burst 0
+Transaction Rate Tran/s,50th Percentile Latency Microseconds,90th Percentile Latency Microseconds,99th Percentile Latency Microseconds
+3510.12,-1,-1,-1`,
+			errorRet: true,
+		},
+		{testType: TestTypeUDPJitter,
+			output: `20221017101010,192.168.1.2,45678,192.168.1.3,12866,3,0.0-10.0,2500400,2000320
+20221017101010,192.168.1.3,12866,192.168.1.2,45678,3,0.0-10.0,2497600,1997760,0.183,2,1786,0.112,1`,
+			result: Result{
+				TestType: TestTypeUDPJitter,
+				Duration: 10 * time.Second,
+				Measurements: map[Category]float64{CategoryThroughput: 1.99776, CategoryJitter: 0.183, CategoryErrors: 2,
+					CategoryPacketLoss: 0.112, CategoryOutOfOrder: 1},
+			},
+		},
+		// The server report is missing if the datagrams did not reach the server.
+		{testType: TestTypeUDPJitter,
+			output:   `20221017101010,192.168.1.2,45678,192.168.1.3,12866,3,0.0-10.0,2500400,2000320`,
+			errorRet: true,
+		},
 	}
 
 	for tc, testcase := range testcases {
@@ -81,7 +126,8 @@ bytes  Bytes  bytes    bytes   secs.    per sec
 		if ret.Duration != testcase.result.Duration {
 			t.Errorf("tc %d:Wrong duration, returned %v, should be %v", tc, ret.Duration, testcase.result.Duration)
 		}
-		categories := []Category{CategoryThroughput, CategoryTransactionRate, CategoryErrors}
+		categories := []Category{CategoryThroughput, CategoryTransactionRate, CategoryErrors, CategoryPacketLoss,
+			CategoryLatencyP50, CategoryLatencyP90, CategoryLatencyP99, CategoryJitter, CategoryOutOfOrder}
 		for _, category := range categories {
 			if math.Abs(ret.Measurements[category]-testcase.result.Measurements[category]) > 0.0001 {
 				t.Errorf("tc %d:Mismatched results for %s: %f != %f", tc, string(category),
@@ -5,10 +5,12 @@
 package netperf
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"chromiumos/tast/common/network/firewall"
@@ -32,19 +34,27 @@ type runner struct {
 	config        Config
 	netserverPath string
 	netperfPath   string
+	// serverTasksetPath and clientTasksetPath are the paths of taskset, only
+	// set if the config requires CPU pinning.
+	serverTasksetPath string
+	clientTasksetPath string
+	// iperfServerPath and iperfClientPath are the paths of iperf, only set
+	// for TestTypeUDPJitter.
+	iperfServerPath string
+	iperfClientPath string
 }
 
 // firewallParams is a set of parameters needed for unblocking test traffic.
 var firewallParams = [][]firewall.RuleOption{
 	{
 		firewall.OptionProto(firewall.L4ProtoTCP),
-		firewall.OptionDPortRange(controlPort, dataPort),
+		firewall.OptionDPortRange(controlPort, dataPort+maxParallelRuns-1),
 		firewall.OptionJumpTarget(firewall.TargetAccept),
 		firewall.OptionWait(10),
 	},
 	{
 		firewall.OptionProto(firewall.L4ProtoUDP),
-		firewall.OptionDPort(dataPort),
+		firewall.OptionDPortRange(dataPort, dataPort+maxParallelRuns-1),
 		firewall.OptionJumpTarget(firewall.TargetAccept),
 		firewall.OptionWait(10),
 	},
@@ -86,6 +96,22 @@ func newRunner(
 		return nil, errors.Wrap(err, "failed to find command netperf")
 	}
 	npr.netperfPath = netperfPath
+	if len(cfg.CPUAffinity) > 0 {
+		if npr.serverTasksetPath, err = cmd.FindCmdPath(ctx, npr.server.conn, "taskset"); err != nil {
+			return nil, errors.Wrap(err, "failed to find command taskset on server")
+		}
+		if npr.clientTasksetPath, err = cmd.FindCmdPath(ctx, npr.client.conn, "taskset"); err != nil {
+			return nil, errors.Wrap(err, "failed to find command taskset on client")
+		}
+	}
+	if cfg.TestType == TestTypeUDPJitter {
+		if npr.iperfServerPath, err = cmd.FindCmdPath(ctx, npr.server.conn, "iperf"); err != nil {
+			return nil, errors.Wrap(err, "failed to find command iperf on server")
+		}
+		if npr.iperfClientPath, err = cmd.FindCmdPath(ctx, npr.client.conn, "iperf"); err != nil {
+			return nil, errors.Wrap(err, "failed to find command iperf on client")
+		}
+	}
 	if err = npr.startNetserver(ctx); err != nil {
 		return nil, errors.Wrap(err, "failed to start netserver")
 	}
@@ -115,6 +141,10 @@ func (r *runner) stopNetserver(ctx context.Context) []error {
 	var errors []error
 	err := r.server.conn.CommandContext(ctx, "killall", r.netserverPath).Run()
 	collectError(ctx, &errors, err)
+	if r.iperfServerPath != "" {
+		err = r.server.conn.CommandContext(ctx, "killall", r.iperfServerPath).Run()
+		collectError(ctx, &errors, err)
+	}
 	// Turn firwall back on, all 4 rules.
 	for _, fw := range firewallParams {
 		args := []firewall.RuleOption{firewall.OptionDeleteRule(firewall.InputChain)}
@@ -132,11 +162,24 @@ func (r *runner) startNetserver(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, netperfCommandTimeoutMargin)
 	defer cancel()
 	commandArgs := []string{r.netserverPath, "-p", strconv.Itoa(controlPort)}
+	if r.serverTasksetPath != "" {
+		commandArgs = append([]string{r.serverTasksetPath, "-c", r.config.cpuList()}, commandArgs...)
+	}
 	testing.ContextLogf(ctx, "Run: %s %s", "minijail0", strings.Join(commandArgs, " "))
 
 	if err := r.server.conn.CommandContext(ctx, "minijail0", commandArgs...).Run(); err != nil {
 		return errors.Wrap(err, "failed to start netserver")
 	}
+	if r.iperfServerPath != "" {
+		// The UDP stream of TestTypeUDPJitter is received by an iperf
+		// server daemon on the data port.
+		iperfArgs := []string{r.iperfServerPath, "-s", "-u", "-D", "-p", strconv.Itoa(dataPort)}
+		testing.ContextLogf(ctx, "Run: %s %s", "minijail0", strings.Join(iperfArgs, " "))
+		if err := r.server.conn.CommandContext(ctx, "minijail0", iperfArgs...).Run(); err != nil {
+			r.stopNetserver(ctx)
+			return errors.Wrap(err, "failed to start iperf server")
+		}
+	}
 
 	startupTime := time.Now()
 	// Punch 4 holes in the firewall, for all possible traffic type.
@@ -178,13 +221,9 @@ func (r *runner) run(ctx context.Context, retryCount uint) (*Result, error) {
 	}
 	var err error
 	for count := retryCount; count > 0; count-- {
-		commandArgs := []string{"-H", r.server.ip,
-			"-p", strconv.Itoa(controlPort),
-			"-t", string(r.config.TestType),
-			"-l", strconv.Itoa(testTimeSec),
-			"--", "-P", fmt.Sprintf("0,%d", dataPort)}
+		command, commandArgs := r.netperfCommand(r.config.TestType, dataPort)
 		testing.ContextLogf(ctx, "Run: %s %s",
-			r.netperfPath, strings.Join(commandArgs, " "))
+			command, strings.Join(commandArgs, " "))
 
 		// Set runner's own timeout based on test time plus guesstimated guard.
 		runnerCtx, cancel := context.WithTimeout(
@@ -193,8 +232,16 @@ func (r *runner) run(ctx context.Context, retryCount uint) (*Result, error) {
 
 		// We need to declare ret here so err won't get shadowed.
 		var ret []byte
+		// Keep the error message of netperf, e.g. about a connection reset,
+		// so that the callers can tell what failed.
+		var stderr bytes.Buffer
+		netperfCmd := r.client.conn.CommandContext(runnerCtx, command, commandArgs...)
+		netperfCmd.Stderr = &stderr
 		// Run the command itself and return result if successful.
-		ret, err = r.client.conn.CommandContext(runnerCtx, r.netperfPath, commandArgs...).Output()
+		ret, err = netperfCmd.Output()
+		if msg := strings.TrimSpace(stderr.String()); err != nil && msg != "" {
+			err = errors.Wrap(err, msg)
+		}
 		if err == nil {
 			// Parse
 			Result, err := parseNetperfOutput(
@@ -210,7 +257,7 @@ func (r *runner) run(ctx context.Context, retryCount uint) (*Result, error) {
 		defer cancel()
 		// Netperf tends to timeout when unable to connect,
 		// make best effort to kill it then.
-		_ = r.client.conn.CommandContext(runnerCtx, "killall", r.netperfPath).Run()
+		_ = r.client.conn.CommandContext(runnerCtx, "killall", r.clientPath()).Run()
 		if count > 1 {
 			// Restart netserv, let it define timeout by itself.
 			if restartErr := r.restartNetserver(ctx); restartErr != nil {
@@ -221,7 +268,132 @@ func (r *runner) run(ctx context.Context, retryCount uint) (*Result, error) {
 	return nil, errors.Wrap(err, "failed to run command netperf")
 }
 
+// warmup runs the test for r.config.WarmupTime and discards the result.
+func (r *runner) warmup(ctx context.Context) error {
+	testing.ContextLogf(ctx, "Warming up for %v", r.config.WarmupTime)
+	testTime := r.config.TestTime
+	r.config.TestTime = r.config.WarmupTime
+	defer func() { r.config.TestTime = testTime }()
+	_, err := r.run(ctx, 1)
+	return err
+}
+
+// clientPath returns the path of the command run on the client for the test
+// type of the config.
+func (r *runner) clientPath() string {
+	if r.config.TestType == TestTypeUDPJitter {
+		return r.iperfClientPath
+	}
+	return r.netperfPath
+}
+
+// netperfCommand returns the command and arguments to run a netperf test of
+// testType using the data port on the server. TestTypeUDPJitter is run with
+// the iperf client instead, which prints the reports in CSV format.
+func (r *runner) netperfCommand(testType TestType, port int) (string, []string) {
+	if testType == TestTypeUDPJitter {
+		commandArgs := []string{"-c", r.server.ip, "-u",
+			"-p", strconv.Itoa(port),
+			"-b", strconv.Itoa(jitterStreamBandwidth),
+			"-l", strconv.Itoa(udpMessageSize),
+			"-t", strconv.Itoa(int(r.config.TestTime.Seconds())),
+			"-y", "c"}
+		if r.clientTasksetPath != "" {
+			return r.clientTasksetPath, append([]string{"-c", r.config.cpuList(), r.iperfClientPath}, commandArgs...)
+		}
+		return r.iperfClientPath, commandArgs
+	}
+	globalArgs := []string{"-t", string(testType)}
+	testArgs := []string{"-P", fmt.Sprintf("0,%d", port)}
+	switch testType {
+	case TestTypeTCPRR, TestTypeUDPRR:
+		// Collect the latency statistics (-j) to report the percentiles
+		// with -o.
+		globalArgs = append(globalArgs, "-j")
+		testArgs = append(testArgs, "-o", rrOutputSelectors)
+	case TestTypeUDPStream:
+		// TestTypeUDPMaerts is also run as UDP_STREAM in reverse.
+		testArgs = append(testArgs, "-m", strconv.Itoa(udpMessageSize))
+	}
+	commandArgs := []string{"-H", r.server.ip,
+		"-p", strconv.Itoa(controlPort),
+		"-l", strconv.Itoa(int(r.config.TestTime.Seconds()))}
+	commandArgs = append(commandArgs, globalArgs...)
+	commandArgs = append(append(commandArgs, "--"), testArgs...)
+	if r.clientTasksetPath != "" {
+		return r.clientTasksetPath, append([]string{"-c", r.config.cpuList(), r.netperfPath}, commandArgs...)
+	}
+	return r.netperfPath, commandArgs
+}
+
+// runParallel runs a test of each of testTypes at the same time, using
+// different data ports, and returns their results in the same order. The tests
+// are not canceled when one of them fails, so the results of the others are
+// still returned, with nil for the failed ones, along with an error
+// aggregating the failures. The netperf processes left on the client are
+// killed on failure.
+func (r *runner) runParallel(ctx context.Context, testTypes []TestType) ([]*Result, error) {
+	if int(r.config.TestTime.Seconds()) == 0 {
+		return nil, errors.New("run duration must be larger than 0")
+	}
+	runnerCtx, cancel := context.WithTimeout(ctx, r.config.TestTime+netperfCommandTimeoutMargin)
+	defer cancel()
+
+	results := make([]*Result, len(testTypes))
+	errs := make([]error, len(testTypes))
+	var wg sync.WaitGroup
+	for i, testType := range testTypes {
+		wg.Add(1)
+		go func(i int, testType TestType) {
+			defer wg.Done()
+			command, commandArgs := r.netperfCommand(testType, dataPort+i)
+			testing.ContextLogf(ctx, "Run: %s %s", command, strings.Join(commandArgs, " "))
+			out, err := r.client.conn.CommandContext(runnerCtx, command, commandArgs...).Output()
+			if err != nil {
+				errs[i] = errors.Wrapf(err, "failed to run %s", testType)
+				return
+			}
+			if results[i], err = parseNetperfOutput(ctx, testType, string(out), r.config.TestTime); err != nil {
+				errs[i] = errors.Wrapf(err, "failed to parse %s result", testType)
+			}
+		}(i, testType)
+	}
+	wg.Wait()
+
+	var msgs []string
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("#%d: %v", i, err))
+		}
+	}
+	if len(msgs) == 0 {
+		return results, nil
+	}
+	killCtx, cancel := context.WithTimeout(ctx, netperfCommandTimeoutMargin)
+	defer cancel()
+	_ = r.client.conn.CommandContext(killCtx, "killall", r.netperfPath).Run()
+	return results, errors.Errorf("%d of %d tests failed: %s", len(msgs), len(testTypes), strings.Join(msgs, "; "))
+}
+
 // close netperf runner.
 func (r *runner) close(ctx context.Context) {
 	r.stopNetserver(ctx)
 }
+
+// validateCPUAffinity checks that the cores of cfg.CPUAffinity exist on host.
+func validateCPUAffinity(ctx context.Context, host RunnerHost, cfg Config) error {
+	out, err := host.conn.CommandContext(ctx, "nproc", "--all").Output()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the number of CPUs")
+	}
+	numCPUs, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the number of CPUs %q", string(out))
+	}
+	for _, core := range cfg.CPUAffinity {
+		if core < 0 || core >= numCPUs {
+			return errors.Errorf("CPU core %d does not exist on %s with %d CPUs", core, host.ip, numCPUs)
+		}
+	}
+	return nil
+}
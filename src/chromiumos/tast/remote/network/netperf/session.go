@@ -6,6 +6,7 @@ package netperf
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +25,8 @@ const (
 	warmupWindowSize       = 2
 	warmupMaxSamples       = 10
 	retryCount             = 3
+	retryInitialBackoff    = 5 * time.Second
+	retryMaxBackoff        = time.Minute
 )
 
 // Session contains session data for running Runner.
@@ -68,11 +71,31 @@ func (s *Session) Run(ctx context.Context, cfg Config) (History, error) {
 		udpMaerts = true
 	}
 
+	if err := s.validateConfig(ctx, cfg); err != nil {
+		return nil, err
+	}
+
 	testing.ContextLogf(ctx, "Performing %s measurements in netperf session",
 		cfg.HumanReadableTag())
 	history := History{}
 	var finalResult *Result
 
+	if cfg.CaptureTraffic {
+		captures, err := s.startCaptures(ctx, cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to start traffic capture")
+		}
+		defer func(ctx context.Context) {
+			files := stopCaptures(ctx, captures)
+			for _, r := range history {
+				r.CaptureFiles = files
+			}
+		}(ctx)
+		var cancel context.CancelFunc
+		ctx, cancel = ctxutil.Shorten(ctx, captureCloseTime)
+		defer cancel()
+	}
+
 	// Create new runner each time session Run() is called,
 	// because config may require runner to swap client and server.
 	runner, err := newRunner(ctx, s.client, s.server, cfg)
@@ -84,6 +107,14 @@ func (s *Session) Run(ctx context.Context, cfg Config) (History, error) {
 	ctx, cancel := ctxutil.Shorten(ctx, time.Second)
 	defer cancel()
 
+	if cfg.WarmupTime > 0 {
+		// A failed warmup still warms up the link, the measurements below
+		// handle the failures.
+		if err := runner.warmup(ctx); err != nil {
+			testing.ContextLog(ctx, "Warmup failed, err: ", err)
+		}
+	}
+
 	// The goal is to accumulate enough stable perf results to to be sure
 	// we're accurate (all deviations are small enough), but don't use
 	// too many (measurementMaxSamples) attempts to achieve that.
@@ -135,6 +166,283 @@ func (s *Session) Run(ctx context.Context, cfg Config) (History, error) {
 	return history, nil
 }
 
+// validateConfig checks the parameters of cfg which are common to all the
+// runs, and that the cores of cfg.CPUAffinity exist on both hosts.
+func (s *Session) validateConfig(ctx context.Context, cfg Config) error {
+	if cfg.WarmupTime != 0 && cfg.WarmupTime < time.Second {
+		return errors.Errorf("invalid warmup time %v, must be 0 or at least 1s", cfg.WarmupTime)
+	}
+	if len(cfg.CPUAffinity) == 0 {
+		return nil
+	}
+	for _, host := range []RunnerHost{s.client, s.server} {
+		if err := validateCPUAffinity(ctx, host, cfg); err != nil {
+			return errors.Wrap(err, "invalid CPU affinity")
+		}
+	}
+	return nil
+}
+
+// RunWithRetry runs netperf with cfg like Run, and returns the aggregated
+// result along with the number of attempts used. If the run fails because of a
+// transient error, i.e. a connection reset or a timeout caused by a Wi-Fi
+// glitch, it is retried with exponential backoff up to maxAttempts runs in
+// total. Any other error, e.g. an invalid configuration, is returned at once.
+// On failure, the returned error wraps the last error.
+//
+// Note that each attempt is a full Run, which already retries each netperf
+// sample up to retryCount times, restarting netserver in between, and only
+// gives up after more than measurementMaxFailures samples failed. So an attempt
+// only fails after at least (measurementMaxFailures+1)*retryCount failed
+// netperf runs, and maxAttempts should be kept small.
+func (s *Session) RunWithRetry(ctx context.Context, cfg Config, maxAttempts int) (*Result, int, error) {
+	if maxAttempts < 1 {
+		return nil, 0, errors.Errorf("invalid number of attempts %d", maxAttempts)
+	}
+	if cfg.TestTime < time.Second {
+		return nil, 0, errors.Errorf("invalid test time %v, must be at least 1s", cfg.TestTime)
+	}
+	if err := s.validateConfig(ctx, cfg); err != nil {
+		return nil, 0, err
+	}
+
+	backoff := retryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		history, err := s.Run(ctx, cfg)
+		if err == nil {
+			result, err := AggregateSamples(ctx, history)
+			return result, attempt, err
+		}
+		if !isTransientError(err) {
+			return nil, attempt, errors.Wrapf(err, "netperf failed with a non-transient error at attempt %d", attempt)
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return nil, attempt, errors.Wrapf(err, "netperf failed after %d attempts", attempt)
+		}
+		testing.ContextLogf(ctx, "Netperf run %d/%d failed, retrying in %v: %v", attempt, maxAttempts, backoff, err)
+		if sleepErr := testing.Sleep(ctx, backoff); sleepErr != nil {
+			return nil, attempt, errors.Wrapf(err, "netperf failed after %d attempts", attempt)
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// transientErrorMessages are the substrings of the error messages of the
+// transient failures of netperf, which are worth retrying.
+var transientErrorMessages = []string{
+	"connection reset",
+	"timed out",
+	"timeout",
+	"deadline exceeded",
+}
+
+// isTransientError returns true if err is caused by a connection reset or a
+// timeout, e.g. because of a Wi-Fi glitch.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// DuplexResult is the result of a full-duplex TCP measurement.
+type DuplexResult struct {
+	// Upstream is the result of the TCP_STREAM test, from the client to the
+	// server.
+	Upstream *Result
+	// Downstream is the result of the TCP_MAERTS test, from the server to the
+	// client.
+	Downstream *Result
+	// TotalThroughput is the sum of the throughputs of both directions in Mbps.
+	TotalThroughput float64
+}
+
+// RunDuplex runs a TCP_STREAM and a TCP_MAERTS test concurrently with
+// RunParallel, to measure the throughput of both directions under simultaneous
+// contention. The test type of cfg is ignored, and traffic capture is not
+// supported.
+func (s *Session) RunDuplex(ctx context.Context, cfg Config) (*DuplexResult, error) {
+	upstreamCfg, downstreamCfg := cfg, cfg
+	upstreamCfg.TestType = TestTypeTCPStream
+	downstreamCfg.TestType = TestTypeTCPMaerts
+
+	testing.ContextLog(ctx, "Performing tcp_duplex measurement in netperf session")
+	results, err := s.RunParallel(ctx, []Config{upstreamCfg, downstreamCfg})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run duplex measurement")
+	}
+	upstream, downstream := results[0], results[1]
+	ret := &DuplexResult{
+		Upstream:   upstream,
+		Downstream: downstream,
+		TotalThroughput: upstream.Measurements[CategoryThroughput] +
+			downstream.Measurements[CategoryThroughput],
+	}
+	testing.ContextLogf(ctx, "Took duplex measurement: upstream %s, downstream %s, total throughput %.3f",
+		upstream, downstream, ret.TotalThroughput)
+	return ret, nil
+}
+
+// RunParallel runs a single test of each of configs concurrently against the
+// same netserver, e.g. to measure the link under simultaneous traffic of
+// different types. The results are returned in the order of configs, each with
+// the test type of its config. Since the tests share the netserver, the configs
+// must have the same Reverse, TestTime and CPUAffinity, and traffic capture,
+// TestTypeUDPJitter and TestTypeUDPMaerts are not supported; run
+// TestTypeUDPStream with Reverse instead of the latter. Up to maxParallelRuns configs can be run. If some of the tests fail,
+// the results of the others are still returned, with nil for the failed ones,
+// along with an error aggregating the failures. All the tests are canceled if
+// ctx is done.
+func (s *Session) RunParallel(ctx context.Context, configs []Config) ([]*Result, error) {
+	if len(configs) == 0 || len(configs) > maxParallelRuns {
+		return nil, errors.Errorf("invalid number of configs %d, must be 1 to %d", len(configs), maxParallelRuns)
+	}
+	base := configs[0]
+	testTypes := make([]TestType, len(configs))
+	for i, cfg := range configs {
+		switch {
+		case cfg.CaptureTraffic:
+			return nil, errors.Errorf("config #%d: traffic capture is not supported in parallel runs", i)
+		case cfg.TestType == TestTypeUDPMaerts, cfg.TestType == TestTypeUDPJitter:
+			return nil, errors.Errorf("config #%d: %s is not supported in parallel runs", i, cfg.TestType)
+		case cfg.Reverse != base.Reverse || cfg.TestTime != base.TestTime || cfg.cpuList() != base.cpuList():
+			return nil, errors.Errorf("config #%d: Reverse, TestTime and CPUAffinity differ from config #0", i)
+		}
+		testTypes[i] = cfg.TestType
+	}
+	if err := s.validateConfig(ctx, base); err != nil {
+		return nil, err
+	}
+
+	testing.ContextLogf(ctx, "Performing %v measurements in parallel in netperf session", testTypes)
+	runner, err := newRunner(ctx, s.client, s.server, base)
+	s.runs++
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize runner")
+	}
+	defer runner.close(ctx)
+	ctx, cancel := ctxutil.Shorten(ctx, time.Second)
+	defer cancel()
+
+	results, err := runner.runParallel(ctx, testTypes)
+	for _, r := range results {
+		if r != nil {
+			testing.ContextLogf(ctx, "Took %s measurement %s", readableTags[r.TestType], r)
+		}
+	}
+	return results, err
+}
+
+// ContinuousResult is a result reported by RunContinuous.
+type ContinuousResult struct {
+	// Interval is the result of the last run, over cfg.ReportInterval.
+	Interval *Result
+	// Rolling aggregates the results of the last cfg.RollingWindow runs,
+	// including Interval, with AggregateSamples. It covers fewer runs until
+	// the window is filled.
+	Rolling *Result
+}
+
+// RunContinuous runs netperf with cfg repeatedly until the returned stop
+// function is called or ctx is done, and sends the result of each run of
+// cfg.ReportInterval on the returned channel, along with the aggregate of the
+// last cfg.RollingWindow runs. cfg.TestTime is ignored, and
+// traffic capture is not supported. Failed runs are logged and retried, until
+// more than measurementMaxFailures runs fail in a row. The channel is closed
+// once the runs are stopped and the netperf processes are cleaned up. stop
+// waits for that and must be called even if ctx is done. An error is returned,
+// with no channel to read, if the runs cannot be started.
+func (s *Session) RunContinuous(ctx context.Context, cfg Config) (<-chan *ContinuousResult, func(), error) {
+	if cfg.CaptureTraffic {
+		return nil, nil, errors.New("traffic capture is not supported in continuous runs")
+	}
+	cfg.TestTime = cfg.ReportInterval
+	if cfg.TestTime == 0 {
+		cfg.TestTime = defaultReportInterval
+	}
+	window := cfg.RollingWindow
+	if window == 0 {
+		window = defaultRollingWindow
+	}
+	if window < 0 {
+		return nil, nil, errors.Errorf("invalid rolling window %d", window)
+	}
+	udpMaerts := false
+	if cfg.TestType == TestTypeUDPMaerts {
+		cfg.TestType = TestTypeUDPStream
+		cfg.Reverse = !cfg.Reverse
+		udpMaerts = true
+	}
+	if err := s.validateConfig(ctx, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	// The runner is created on the caller goroutine, so that s is not
+	// accessed concurrently.
+	runner, err := newRunner(ctx, s.client, s.server, cfg)
+	s.runs++
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to initialize runner")
+	}
+
+	ch := make(chan *ContinuousResult)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stop := func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+		// Clean up with a fresh context, as ctx is done when stopped.
+		defer runner.close(context.Background())
+
+		testing.ContextLogf(ctx, "Performing continuous %s measurements every %v", cfg.HumanReadableTag(), cfg.TestTime)
+		var recent []*Result
+		for failures := 0; ctx.Err() == nil; {
+			result, err := runner.run(ctx, retryCount)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if failures++; failures > measurementMaxFailures {
+					testing.ContextLogf(ctx, "Stopping continuous run after %d failures: %v", failures, err)
+					return
+				}
+				testing.ContextLog(ctx, "Continuous run failed: ", err)
+				continue
+			}
+			failures = 0
+			if udpMaerts {
+				result.TestType = TestTypeUDPMaerts
+			}
+			if recent = append(recent, result); len(recent) > window {
+				recent = recent[len(recent)-window:]
+			}
+			rolling, err := AggregateSamples(ctx, recent)
+			if err != nil {
+				testing.ContextLog(ctx, "Failed to aggregate continuous results: ", err)
+			}
+			select {
+			case ch <- &ContinuousResult{Interval: result, Rolling: rolling}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, stop, nil
+}
+
 // warmupWifiPart runs a limited number of short traffic burst to "warm up" the
 // connection. Returns error when too many errors are returned from the runner.
 // Otherwise returns nil when results are stable enough or `warmupMaxSamples` runs.
@@ -0,0 +1,31 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package netperf
+
+import (
+	"context"
+	"testing"
+
+	"chromiumos/tast/errors"
+)
+
+// TestIsTransientError tests isTransientError.
+func TestIsTransientError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("send_data: data send error: Connection reset by peer"), true},
+		{errors.New("establish control: are you sure there is a netserver listening on 10.0.0.1 at port 12865?: Connection timed out"), true},
+		{errors.Wrap(context.DeadlineExceeded, "failed to run command netperf"), true},
+		{errors.New("invalid warmup time 500ms, must be 0 or at least 1s"), false},
+		{errors.New("CPU core 8 does not exist on 10.0.0.1 with 4 CPUs"), false},
+		{errors.New("failed to parse netperf result"), false},
+	} {
+		if got := isTransientError(tc.err); got != tc.want {
+			t.Errorf("isTransientError(%q) = %v; want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// beaconTimeout is how long to wait for the AP to start beaconing after Wi-Fi
+// is reloaded.
+const beaconTimeout = 60 * time.Second
+
+// hostapdLogLines is the number of hostapd log lines reported when the AP fails
+// to come up.
+const hostapdLogLines = 10
+
+// APProfile describes an AP to configure with the wireless config.
+//
+// See https://openwrt.org/docs/guide-user/network/wifi/basic for documentation
+// on the wifi-device and wifi-iface section options.
+type APProfile struct {
+	// Radio is the name of the wifi-device section of the radio, e.g. "radio0".
+	Radio string
+	// Iface is the name of the wifi-iface section to create for the AP.
+	Iface string
+	// SSID is the SSID of the AP.
+	SSID string
+	// Channel is the channel of the radio. 0 means "auto".
+	Channel int
+	// HTMode is the HT mode of the radio, e.g. "HT20" or "VHT80". It is left
+	// unchanged if empty.
+	HTMode string
+	// Encryption is the encryption of the AP, e.g. "psk2". Defaults to "none".
+	Encryption string
+	// Key is the passphrase of the AP, required unless Encryption is "none".
+	Key string
+	// Network is the logical network interface the AP is attached to, e.g. "lan".
+	Network string
+}
+
+// validate checks that p describes a consistent AP.
+func (p *APProfile) validate() error {
+	if p.Radio == "" {
+		return errors.New("radio is required")
+	}
+	if !sectionNameRE.MatchString(p.Iface) {
+		return errors.Errorf("invalid iface section name %q", p.Iface)
+	}
+	if p.SSID == "" || len(p.SSID) > 32 {
+		return errors.Errorf("invalid SSID %q", p.SSID)
+	}
+	if p.Channel < 0 {
+		return errors.Errorf("invalid channel %d", p.Channel)
+	}
+	if p.Encryption != "" && p.Encryption != "none" && p.Key == "" {
+		return errors.Errorf("key is required for encryption %q", p.Encryption)
+	}
+	return nil
+}
+
+// BringUpAP applies profile to ConfigWireless, enables the radio, commits and
+// reloads Wi-Fi, and then waits until the AP is beaconing. If the AP does not
+// come up in time, the returned error contains the last hostapd log lines,
+// which usually tell the reason (e.g. channel unavailable).
+func BringUpAP(ctx context.Context, uci *Runner, profile APProfile) error {
+	if err := profile.validate(); err != nil {
+		return errors.Wrap(err, "invalid AP profile")
+	}
+	channel := "auto"
+	if profile.Channel != 0 {
+		channel = strconv.Itoa(profile.Channel)
+	}
+	encryption := profile.Encryption
+	if encryption == "" {
+		encryption = "none"
+	}
+
+	testing.ContextLogf(ctx, "Bringing up OpenWrt router AP %q on %s", profile.SSID, profile.Radio)
+	type step struct {
+		section, option, value string
+	}
+	steps := []step{
+		{profile.Radio, "channel", channel},
+		{profile.Radio, "disabled", "0"},
+		{profile.Iface, "", "wifi-iface"},
+		{profile.Iface, "device", profile.Radio},
+		{profile.Iface, "mode", "ap"},
+		{profile.Iface, "ssid", profile.SSID},
+		{profile.Iface, "encryption", encryption},
+		{profile.Iface, "disabled", "0"},
+	}
+	if profile.HTMode != "" {
+		steps = append(steps, step{profile.Radio, "htmode", profile.HTMode})
+	}
+	if profile.Key != "" {
+		steps = append(steps, step{profile.Iface, "key", profile.Key})
+	}
+	if profile.Network != "" {
+		steps = append(steps, step{profile.Iface, "network", profile.Network})
+	}
+	b := uci.Batch()
+	for _, s := range steps {
+		b.Set(ConfigWireless, s.section, s.option, s.value)
+	}
+	if err := b.Commit(ctx); err != nil {
+		return errors.Wrapf(err, "failed to configure AP %q", profile.SSID)
+	}
+	if err := ReloadConfigServices(ctx, uci, ConfigWireless); err != nil {
+		return err
+	}
+
+	if err := waitForBeaconing(ctx, uci, profile.SSID); err != nil {
+		if logs, logErr := hostapdLogs(ctx, uci); logErr != nil {
+			testing.ContextLog(ctx, "Failed to read hostapd logs: ", logErr)
+		} else if logs != "" {
+			return errors.Wrapf(err, "AP %q did not come up; hostapd logs:\n%s", profile.SSID, logs)
+		}
+		return errors.Wrapf(err, "AP %q did not come up", profile.SSID)
+	}
+	return nil
+}
+
+// waitForBeaconing waits until an interface of type AP with ssid exists on the
+// router, which means hostapd has started beaconing.
+func waitForBeaconing(ctx context.Context, uci *Runner, ssid string) error {
+	ssidRE := regexp.MustCompile(`(?m)^\s*ssid ` + regexp.QuoteMeta(ssid) + `\s*$`)
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		out, err := uci.cmd.Output(ctx, "iw", "dev")
+		if err != nil {
+			return errors.Wrap(err, "failed to list wireless interfaces")
+		}
+		// Each interface is listed in its own block starting with "Interface".
+		for _, block := range strings.Split(string(out), "Interface ")[1:] {
+			if ssidRE.MatchString(block) && strings.Contains(block, "type AP") {
+				return nil
+			}
+		}
+		return errors.Errorf("no AP interface with SSID %q", ssid)
+	}, &testing.PollOptions{Timeout: beaconTimeout, Interval: time.Second})
+}
+
+// hostapdLogs returns the last hostapdLogLines lines of the hostapd logs.
+func hostapdLogs(ctx context.Context, uci *Runner) (string, error) {
+	out, err := uci.cmd.Output(ctx, "logread", "-e", "hostapd")
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > hostapdLogLines {
+		lines = lines[len(lines)-hostapdLogLines:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"strings"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// batchEOF is the delimiter of the "here" document holding the batch script.
+const batchEOF = "UCI_BATCH_EOF"
+
+// batchOp is a single operation of a Batch.
+type batchOp struct {
+	// cmd is the uci command of the operation, "set", "add_list" or
+	// "delete".
+	cmd    string
+	config string
+	// location is the location of the operation without the value.
+	location string
+	value    string
+}
+
+// line returns the line of the batch script that runs op.
+func (op *batchOp) line() string {
+	if op.cmd == "delete" {
+		return op.cmd + " " + op.location
+	}
+	return op.cmd + " " + op.location + "=" + quoteValue(op.value)
+}
+
+// change returns the line listed by "uci changes" once op is staged.
+func (op *batchOp) change() string {
+	switch op.cmd {
+	case "delete":
+		return "-" + op.location
+	case "add_list":
+		return op.location + "+=" + quoteValue(op.value)
+	}
+	return op.location + "=" + quoteValue(op.value)
+}
+
+// quoteValue quotes value with single quotes, as done by "uci changes".
+func quoteValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Batch accumulates uci set, add_list and delete operations so that they are staged by
+// a single "uci batch" run and committed at once, instead of running uci for
+// each of them. A Batch is created with Runner.Batch.
+type Batch struct {
+	uci *Runner
+	ops []*batchOp
+	// err is the first error found in the operations added so far. It is
+	// returned by Commit.
+	err error
+}
+
+// Batch returns an empty Batch which runs its operations with r.
+func (r *Runner) Batch() *Batch {
+	return &Batch{uci: r}
+}
+
+// add validates and appends an operation to b.
+func (b *Batch) add(cmd, config, section, option, value string) {
+	if b.err != nil {
+		return
+	}
+	if strings.Contains(config+section+option+value, "\n") {
+		b.err = errors.Errorf("invalid %s operation with config=%q section=%q option=%q value=%q: newlines are not allowed", cmd, config, section, option, value)
+		return
+	}
+	location, err := b.uci.buildLocation(config, section, option, "")
+	if err != nil {
+		b.err = errors.Wrapf(err, "invalid %s operation with config=%q section=%q option=%q value=%q", cmd, config, section, option, value)
+		return
+	}
+	b.ops = append(b.ops, &batchOp{cmd: cmd, config: config, location: location, value: value})
+}
+
+// Set adds an operation setting the value of the given option, or adding a
+// new section with the type set to the given value, as Runner.Set does.
+// Invalid parameters are reported by Commit.
+func (b *Batch) Set(config, section, option, value string) {
+	if config == "" || section == "" || value == "" {
+		if b.err == nil {
+			b.err = errors.Errorf("invalid set operation with config=%q section=%q option=%q value=%q: config, section, and value are required", config, section, option, value)
+		}
+		return
+	}
+	b.add("set", config, section, option, value)
+}
+
+// AddList adds an operation adding value to the given list option, as
+// Runner.AddList does. Invalid parameters are reported by Commit.
+func (b *Batch) AddList(config, section, option, value string) {
+	if config == "" || section == "" || option == "" || value == "" {
+		if b.err == nil {
+			b.err = errors.Errorf("invalid add_list operation with config=%q section=%q option=%q value=%q: config, section, option, and value are required", config, section, option, value)
+		}
+		return
+	}
+	b.add("add_list", config, section, option, value)
+}
+
+// Delete adds an operation deleting the given section or option, as
+// Runner.Delete does. Invalid parameters are reported by Commit.
+func (b *Batch) Delete(config, section, option string) {
+	if config == "" || section == "" {
+		if b.err == nil {
+			b.err = errors.Errorf("invalid delete operation with config=%q section=%q option=%q: config and section are required", config, section, option)
+		}
+		return
+	}
+	b.add("delete", config, section, option, "")
+}
+
+// configs returns the configs touched by the operations of b, in order.
+func (b *Batch) configs() []string {
+	var configs []string
+	seen := make(map[string]bool)
+	for _, op := range b.ops {
+		if !seen[op.config] {
+			seen[op.config] = true
+			configs = append(configs, op.config)
+		}
+	}
+	return configs
+}
+
+// Commit stages all the operations of b with a single "uci batch" run, then
+// commits the configs they touch. The operations are cleared on success, so
+// that b can be reused.
+//
+// If any operation fails, nothing is committed, the staged changes of the
+// touched configs, including the ones staged before Commit was called, are
+// reverted, and the returned error names the first failing operation.
+//
+// Services using the configs must be reloaded for the changes to be used.
+func (b *Batch) Commit(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.ops) == 0 {
+		return nil
+	}
+	var script strings.Builder
+	// uci prints errors on stderr but may keep going and exit with 0, so
+	// stderr is read to tell whether all the lines succeeded.
+	script.WriteString("uci batch 2>&1 <<'" + batchEOF + "'\n")
+	for _, op := range b.ops {
+		script.WriteString(op.line() + "\n")
+	}
+	script.WriteString(batchEOF + "\n")
+	out, err := b.uci.cmd.Output(ctx, "sh", "-c", script.String())
+	if msg := strings.TrimSpace(string(out)); err != nil || msg != "" {
+		batchErr := b.failure(ctx, msg, err)
+		for _, config := range b.configs() {
+			if revertErr := b.uci.Revert(ctx, config, "", ""); revertErr != nil {
+				testing.ContextLogf(ctx, "Failed to revert changes to config %q: %v", config, revertErr)
+			}
+		}
+		return batchErr
+	}
+	for _, config := range b.configs() {
+		if err := b.uci.Commit(ctx, config); err != nil {
+			return errors.Wrapf(err, "failed to commit config %q", config)
+		}
+	}
+	b.ops = nil
+	return nil
+}
+
+// failure builds the error returned by Commit when "uci batch" failed with
+// err or printed msg. The failing operation is the first one whose change is
+// not staged.
+func (b *Batch) failure(ctx context.Context, msg string, err error) error {
+	if err == nil {
+		err = errors.New(msg)
+	} else if msg != "" {
+		err = errors.Wrap(err, msg)
+	}
+	staged := make(map[string]bool)
+	for _, config := range b.configs() {
+		changes, changesErr := b.uci.Changes(ctx, config)
+		if changesErr != nil {
+			return errors.Wrapf(err, "uci batch failed, and listing the staged changes failed: %v", changesErr)
+		}
+		for _, c := range changes {
+			staged[strings.TrimPrefix(c, "+")] = true
+		}
+	}
+	for i, op := range b.ops {
+		if !staged[op.change()] {
+			return errors.Wrapf(err, "uci batch failed at operation %d %q", i+1, op.line())
+		}
+	}
+	return errors.Wrap(err, "uci batch failed")
+}
@@ -28,6 +28,10 @@ const (
 	// ConfigWireless is the name of the config for wireless settings and
 	// Wi-Fi network definition.
 	ConfigWireless = "wireless"
+
+	// ConfigSQM is the name of the config for Smart Queue Management (SQM)
+	// traffic shaping, provided by the sqm-scripts package.
+	ConfigSQM = "sqm"
 )
 
 // Relevant system directories
@@ -145,6 +149,8 @@ func ReloadConfigServices(ctx context.Context, uci *Runner, configs ...string) e
 			err = RestartDnsmasq(ctx, uci)
 		case ConfigNetwork:
 			err = ReloadNetwork(ctx, uci)
+		case ConfigSQM:
+			err = RestartSQM(ctx, uci)
 		default:
 			err = errors.New("unknown config or reloading its services not yet supported")
 		}
@@ -186,6 +192,17 @@ func ReloadNetwork(ctx context.Context, uci *Runner) error {
 	return nil
 }
 
+// RestartSQM restarts the sqm service, which reloads the current committed
+// settings that are in ConfigSQM. See the OpenWrt documentation for more info
+// at https://openwrt.org/docs/guide-user/network/traffic-shaping/sqm.
+func RestartSQM(ctx context.Context, uci *Runner) error {
+	testing.ContextLog(ctx, "Restarting OpenWrt router sqm service")
+	if err := uci.cmd.Run(ctx, "/etc/init.d/sqm", "restart"); err != nil {
+		return errors.Wrap(err, "failed to restart sqm service")
+	}
+	return nil
+}
+
 // CommitAndReloadConfig first commits any pending config changes and then
 // reloads its dependent service to put the changes into effect.
 func CommitAndReloadConfig(ctx context.Context, uci *Runner, config string) error {
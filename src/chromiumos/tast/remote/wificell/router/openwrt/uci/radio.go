@@ -0,0 +1,144 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// radioToggleTimeout is how long to wait for the interfaces of a radio to go
+// up or down after Wi-Fi is reloaded.
+const radioToggleTimeout = 30 * time.Second
+
+// radioStatus is the status of a radio reported by "wifi status".
+type radioStatus struct {
+	Up         bool `json:"up"`
+	Pending    bool `json:"pending"`
+	Disabled   bool `json:"disabled"`
+	Interfaces []struct {
+		Section string `json:"section"`
+		Ifname  string `json:"ifname"`
+	} `json:"interfaces"`
+}
+
+// getRadioStatus returns the status of radio, along with the raw status
+// output for error reporting.
+func getRadioStatus(ctx context.Context, uci *Runner, radio string) (*radioStatus, string, error) {
+	out, err := uci.cmd.Output(ctx, "wifi", "status", radio)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get the status of radio %q", radio)
+	}
+	var statuses map[string]*radioStatus
+	if err := json.Unmarshal(out, &statuses); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to parse the status of radio %q", radio)
+	}
+	status, ok := statuses[radio]
+	if !ok {
+		return nil, "", errors.Errorf("radio %q not found", radio)
+	}
+	return status, strings.TrimSpace(string(out)), nil
+}
+
+// stationDumpRegexp matches the lines of "iw dev <ifname> station dump"
+// starting the entry of an associated client.
+var stationDumpRegexp = regexp.MustCompile(`(?m)^Station ([0-9a-fA-F:]{17})`)
+
+// associatedStations returns the MAC addresses of the clients associated with
+// the AP on ifname, or none if ifname does not exist anymore.
+func associatedStations(ctx context.Context, uci *Runner, ifname string) ([]string, error) {
+	if err := uci.cmd.Run(ctx, "ip", "link", "show", "dev", ifname); err != nil {
+		// The interfaces of a disabled radio are removed.
+		return nil, nil
+	}
+	out, err := uci.cmd.Output(ctx, "iw", "dev", ifname, "station", "dump")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the stations of %q", ifname)
+	}
+	var stations []string
+	for _, m := range stationDumpRegexp.FindAllStringSubmatch(string(out), -1) {
+		stations = append(stations, m[1])
+	}
+	return stations, nil
+}
+
+// SetRadioEnabled enables or disables radio in ConfigWireless, reloads Wi-Fi,
+// and then waits until the interfaces of the radio are up or down
+// accordingly. When the radio is disabled, it also waits until no client is
+// associated with the APs that were on its interfaces. If the radio does not
+// reach the expected state in time, the returned error contains its last
+// status.
+func SetRadioEnabled(ctx context.Context, uci *Runner, radio string, enabled bool) error {
+	disabled := "1"
+	if enabled {
+		disabled = "0"
+	}
+	// Record the interfaces of the radio to check their clients once it is
+	// disabled, as they are not reported anymore by then.
+	var ifnames []string
+	if !enabled {
+		status, _, err := getRadioStatus(ctx, uci, radio)
+		if err != nil {
+			return err
+		}
+		for _, iface := range status.Interfaces {
+			if iface.Ifname != "" {
+				ifnames = append(ifnames, iface.Ifname)
+			}
+		}
+	}
+	testing.ContextLogf(ctx, "Setting OpenWrt router radio %q enabled=%t", radio, enabled)
+	if err := uci.Set(ctx, ConfigWireless, radio, "disabled", disabled); err != nil {
+		return errors.Wrapf(err, "failed to set radio %q disabled=%s", radio, disabled)
+	}
+	if err := CommitAndReloadConfig(ctx, uci, ConfigWireless); err != nil {
+		return err
+	}
+
+	var lastStatus string
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		status, raw, err := getRadioStatus(ctx, uci, radio)
+		if err != nil {
+			return err
+		}
+		lastStatus = raw
+		if status.Pending {
+			return errors.New("radio is pending")
+		}
+		if status.Up != enabled {
+			return errors.Errorf("radio up=%t", status.Up)
+		}
+		if !enabled {
+			for _, ifname := range ifnames {
+				stations, err := associatedStations(ctx, uci, ifname)
+				if err != nil {
+					return err
+				}
+				if len(stations) > 0 {
+					return errors.Errorf("clients %v are still associated on %q", stations, ifname)
+				}
+			}
+			return nil
+		}
+		for _, iface := range status.Interfaces {
+			if iface.Ifname == "" {
+				return errors.Errorf("interface of section %q is not up yet", iface.Section)
+			}
+			if err := uci.cmd.Run(ctx, "ip", "link", "show", "dev", iface.Ifname); err != nil {
+				return errors.Wrapf(err, "interface %q does not exist", iface.Ifname)
+			}
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: radioToggleTimeout, Interval: time.Second}); err != nil {
+		return errors.Wrapf(err, "radio %q did not become enabled=%t; last status: %s", radio, enabled, lastStatus)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// rateLimitTimeout is how long to wait for the shaping qdiscs to be updated
+// after the sqm service is restarted.
+const rateLimitTimeout = 30 * time.Second
+
+// maxIfNameLen is the maximum length of a network device name (IFNAMSIZ - 1).
+const maxIfNameLen = 15
+
+// nonSectionNameCharRE matches the characters which are not valid in uci
+// section names.
+var nonSectionNameCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// rateLimitSection returns the name of the sqm queue section managed by
+// SetSSIDRateLimit for iface.
+func rateLimitSection(iface string) string {
+	return "tast_" + nonSectionNameCharRE.ReplaceAllString(iface, "_")
+}
+
+// ingressDevice returns the name of the IFB device sqm-scripts creates to
+// shape the traffic received on iface.
+func ingressDevice(iface string) string {
+	dev := "ifb4" + iface
+	if len(dev) > maxIfNameLen {
+		dev = dev[:maxIfNameLen]
+	}
+	return dev
+}
+
+// SetSSIDRateLimit limits the throughput of the AP interface iface of an SSID
+// with a cake qdisc configured through ConfigSQM. downKbps limits the traffic
+// sent to the stations and upKbps the traffic received from them, in kbit/s.
+// A zero value leaves the direction unlimited, and the limit is cleared if
+// both are zero. The config is committed and the sqm service restarted, and
+// then it waits until the qdiscs are in effect.
+//
+// Note that sqm-scripts names the directions from the point of view of the
+// router's uplink, so downKbps is the "upload" (egress) limit of iface and
+// upKbps its "download" (ingress) limit.
+func SetSSIDRateLimit(ctx context.Context, uci *Runner, iface string, downKbps, upKbps int) error {
+	if iface == "" {
+		return errors.New("iface is required")
+	}
+	if downKbps < 0 || upKbps < 0 {
+		return errors.Errorf("invalid rate limit: down %d kbit/s, up %d kbit/s", downKbps, upKbps)
+	}
+	section := rateLimitSection(iface)
+
+	b := uci.Batch()
+	if downKbps == 0 && upKbps == 0 {
+		testing.ContextLogf(ctx, "Clearing OpenWrt router rate limit on %q", iface)
+		// Check that the section exists first, as uci does not tell a missing
+		// entry apart from the other failures of delete in its exit code.
+		sections, err := uci.ShowConfig(ctx, ConfigSQM)
+		if err != nil {
+			return errors.Wrapf(err, "failed to show config %q", ConfigSQM)
+		}
+		if _, ok := sections[section]; ok {
+			b.Delete(ConfigSQM, section, "")
+		} else {
+			testing.ContextLogf(ctx, "Section %q does not exist, no limit is set", section)
+		}
+	} else {
+		testing.ContextLogf(ctx, "Setting OpenWrt router rate limit on %q: down %d kbit/s, up %d kbit/s", iface, downKbps, upKbps)
+		for _, s := range []struct {
+			option, value string
+		}{
+			{"", "queue"},
+			{"enabled", "1"},
+			{"interface", iface},
+			{"download", strconv.Itoa(upKbps)},
+			{"upload", strconv.Itoa(downKbps)},
+			{"qdisc", "cake"},
+			{"script", "piece_of_cake.qos"},
+		} {
+			b.Set(ConfigSQM, section, s.option, s.value)
+		}
+	}
+	// Nothing is run if the limit was already cleared.
+	if len(b.ops) > 0 {
+		if err := b.Commit(ctx); err != nil {
+			return errors.Wrapf(err, "failed to update section %q", section)
+		}
+		if err := ReloadConfigServices(ctx, uci, ConfigSQM); err != nil {
+			return err
+		}
+	}
+
+	if err := waitForShaping(ctx, uci, iface, downKbps > 0); err != nil {
+		return errors.Wrapf(err, "egress rate limit of %q not in effect", iface)
+	}
+	if err := waitForShaping(ctx, uci, ingressDevice(iface), upKbps > 0); err != nil {
+		return errors.Wrapf(err, "ingress rate limit of %q not in effect", iface)
+	}
+	return nil
+}
+
+// waitForShaping waits until a cake qdisc is attached to dev if shaped is
+// true, or until none is if shaped is false.
+func waitForShaping(ctx context.Context, uci *Runner, dev string, shaped bool) error {
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		// The IFB device does not exist when the ingress traffic is not shaped.
+		out, err := uci.cmd.Output(ctx, "tc", "qdisc", "show", "dev", dev)
+		if err != nil && shaped {
+			return errors.Wrapf(err, "failed to show qdiscs of %q", dev)
+		}
+		if hasCake := strings.Contains(string(out), "qdisc cake"); hasCake != shaped {
+			return errors.Errorf("unexpected qdiscs on %q: %s", dev, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: rateLimitTimeout, Interval: time.Second})
+}
@@ -236,6 +236,96 @@ func (r *Runner) Show(ctx context.Context, config, section, option string, flags
 	return r.UciWithOutput(ctx, flags, "show")
 }
 
+// SectionTypeKey is the key of the type of a section in the maps returned by
+// ShowConfig.
+const SectionTypeKey = ".type"
+
+// ShowConfig shows the given configuration and returns it parsed as the
+// options of each section keyed by section name, then by option name. The
+// type of each section is keyed by SectionTypeKey. Anonymous sections are
+// keyed by their "cfgNNN" identifiers, and the values of list options are
+// joined with spaces.
+//
+// CLI usage is "uci -X show <config>".
+func (r *Runner) ShowConfig(ctx context.Context, config string) (map[string]map[string]string, error) {
+	if config == "" {
+		return nil, errors.New("config is required")
+	}
+	lines, err := r.Show(ctx, config, "", "", CLIFlagDoNotUseShowExtendedSyntax())
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[string]map[string]string)
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("unexpected line %q in uci show output", line)
+		}
+		path := strings.Split(kv[0], ".")
+		if len(path) < 2 || len(path) > 3 || path[0] != config {
+			return nil, errors.Errorf("unexpected location %q in uci show output", kv[0])
+		}
+		values, err := parseShowValue(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse value of %q", kv[0])
+		}
+		section := path[1]
+		if sections[section] == nil {
+			sections[section] = make(map[string]string)
+		}
+		key := SectionTypeKey
+		if len(path) == 3 {
+			key = path[2]
+		}
+		sections[section][key] = strings.Join(values, " ")
+	}
+	return sections, nil
+}
+
+// parseShowValue parses a value printed by "uci show", which is a list of
+// single-quoted strings separated by spaces. Quotes inside the strings are
+// escaped by closing the string, adding a backslash-escaped quote and reopening
+// the string.
+func parseShowValue(s string) ([]string, error) {
+	var values []string
+	var cur strings.Builder
+	inValue, quoted := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted && c == '\'':
+			quoted = false
+		case quoted:
+			cur.WriteByte(c)
+		case c == '\'':
+			quoted, inValue = true, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inValue = true
+		case c == ' ':
+			if inValue {
+				values = append(values, cur.String())
+				cur.Reset()
+				inValue = false
+			}
+		default:
+			cur.WriteByte(c)
+			inValue = true
+		}
+	}
+	if quoted {
+		return nil, errors.Errorf("unterminated quote in %q", s)
+	}
+	if inValue {
+		values = append(values, cur.String())
+	}
+	return values, nil
+}
+
 // Set sets the value of the given option, or adds a new section with the type
 // set to the given value.
 //
@@ -307,6 +397,76 @@ func (r *Runner) AddList(ctx context.Context, config, section, option, str strin
 	return r.Uci(ctx, flags, "add_list", location)
 }
 
+// GetList gets the values of the given list option.
+//
+// The values are printed one per line with the "-d" CLI flag, so that values
+// containing spaces are not split.
+//
+// CLI usage is "uci -d <delimiter> get <config>.<section>.<option>".
+func (r *Runner) GetList(ctx context.Context, config, section, option string) ([]string, error) {
+	if config == "" || section == "" || option == "" {
+		return nil, errors.Errorf("invalid location parameter with config=%q section=%q option=%q: config, section, and option are required", config, section, option)
+	}
+	location, err := r.buildLocation(config, section, option, "")
+	if err != nil {
+		return nil, errors.Errorf("invalid location parameter with config=%q section=%q option=%q", config, section, option)
+	}
+	args := r.resolveUciCommandArgs([]CLIFlag{simpleCLIFlag("-d", "\n")}, "get", location)
+	output, err := r.cmd.Output(ctx, uciCmd, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to run "uci get %s"`, location)
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
+
+// SetList replaces the values of the given list option with values, by
+// deleting the option if it is set and adding each of the values with
+// "uci add_list". The option is left unset if values is empty. Values may
+// contain spaces. The section must exist.
+func (r *Runner) SetList(ctx context.Context, config, section, option string, values []string) error {
+	if config == "" || section == "" || option == "" {
+		return errors.Errorf("invalid location parameter with config=%q section=%q option=%q: config, section, and option are required", config, section, option)
+	}
+	for _, v := range values {
+		if v == "" {
+			return errors.Errorf("invalid empty value in list option %s.%s.%s", config, section, option)
+		}
+	}
+	exists, err := r.optionExists(ctx, config, section, option)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if _, err := r.Delete(ctx, config, section, option); err != nil {
+			return errors.Wrapf(err, "failed to delete list option %s.%s.%s", config, section, option)
+		}
+	}
+	for _, v := range values {
+		if err := r.AddList(ctx, config, section, option, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionExists returns true if the given option is set in the given section.
+// Unlike "uci get", "uci show" of the section tells an unset option apart from
+// the other errors, which are returned.
+func (r *Runner) optionExists(ctx context.Context, config, section, option string) (bool, error) {
+	lines, err := r.Show(ctx, config, section, "")
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to show section %s.%s", config, section)
+	}
+	for _, line := range lines {
+		// The options are printed as "<config>.<section>.<option>=<value>".
+		key := strings.SplitN(line, "=", 2)[0]
+		if path := strings.Split(key, "."); len(path) == 3 && path[2] == option {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Add adds an anonymous section of type sectionType to the given configuration.
 //
 // CLI usage is "uci add <config> <sectionType>".
@@ -364,10 +524,3 @@ func (r *Runner) Export(ctx context.Context, config string, flags ...CLIFlag) ([
 	}
 	return r.UciWithOutput(ctx, flags, "export")
 }
-
-// Batch executes a multi-line UCI script which is typically wrapped into a
-// "here" document syntax. This command is not supported by this wrapper and
-// an error will always be returned if this is called.
-func (r *Runner) Batch() error {
-	return errors.New(`the "uci batch" command is not supported by this wrapper`)
-}
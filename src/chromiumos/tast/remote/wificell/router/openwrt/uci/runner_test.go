@@ -0,0 +1,78 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseShowValue(t *testing.T) {
+	testcases := []struct {
+		input      string
+		expected   []string
+		shouldFail bool
+	}{
+		{
+			input:    "",
+			expected: nil,
+		},
+		{
+			input:    "'ap'",
+			expected: []string{"ap"},
+		},
+		{
+			input:    "''",
+			expected: []string{""},
+		},
+		{
+			input:    "unquoted",
+			expected: []string{"unquoted"},
+		},
+		{
+			input:    "'with space'",
+			expected: []string{"with space"},
+		},
+		// A single quote is printed by closing the quotes and escaping it.
+		{
+			input:    `'it'\''s'`,
+			expected: []string{"it's"},
+		},
+		// List options are printed as space-separated values.
+		{
+			input:    "'lan1' 'lan2' 'lan3'",
+			expected: []string{"lan1", "lan2", "lan3"},
+		},
+		{
+			input:    `'a b' 'c'\''d'`,
+			expected: []string{"a b", "c'd"},
+		},
+		{
+			input:      "'unterminated",
+			shouldFail: true,
+		},
+		{
+			input:      "'lan1' 'lan2",
+			shouldFail: true,
+		},
+	}
+	for i, tc := range testcases {
+		values, err := parseShowValue(tc.input)
+		if tc.shouldFail {
+			if err == nil {
+				t.Errorf("case#%d should fail but succeeded with %q", i, values)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case#%d failed with err=%v", i, err)
+			continue
+		}
+		if diff := cmp.Diff(values, tc.expected); diff != "" {
+			t.Errorf("case#%d got unexpected values (-got +want):\n%s", i, diff)
+		}
+	}
+}
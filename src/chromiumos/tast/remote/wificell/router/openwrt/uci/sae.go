@@ -0,0 +1,115 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// hostapdConfigGlob matches the hostapd configs generated by OpenWrt for each
+// radio.
+const hostapdConfigGlob = "/var/run/hostapd-*.conf"
+
+// saeSettings returns the uci encryption and ieee80211w options, and the
+// expected hostapd wpa_key_mgmt and ieee80211w settings of WPA3-SAE, or of
+// the WPA2/WPA3 transition mode if transition is set.
+func saeSettings(transition bool) (encryption, mfp, keyMgmt string) {
+	if transition {
+		// Management frame protection is optional for the WPA2 clients.
+		return "sae-mixed", "1", "WPA-PSK SAE"
+	}
+	return "sae", "2", "SAE"
+}
+
+// ConfigureSAE configures the wifi-iface section iface in ConfigWireless for
+// WPA3-SAE with passphrase, or for the WPA2/WPA3 transition mode if transition
+// is set, with the matching management frame protection. It then commits and
+// reloads Wi-Fi, waits for the AP to beacon, and checks that hostapd runs the
+// AP with the expected key management and management frame protection.
+func ConfigureSAE(ctx context.Context, uci *Runner, iface, passphrase string, transition bool) error {
+	if !sectionNameRE.MatchString(iface) {
+		return errors.Errorf("invalid iface section name %q", iface)
+	}
+	if len(passphrase) < 8 || len(passphrase) > 63 {
+		return errors.Errorf("invalid passphrase length %d, must be in [8, 63]", len(passphrase))
+	}
+	ssid, err := uci.Get(ctx, ConfigWireless, iface, "ssid")
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the SSID of %q", iface)
+	}
+	if len(ssid) != 1 {
+		return errors.Errorf("unexpected SSID of %q: %q", iface, ssid)
+	}
+
+	encryption, mfp, keyMgmt := saeSettings(transition)
+	testing.ContextLogf(ctx, "Configuring OpenWrt router AP %q with encryption %s", ssid[0], encryption)
+	b := uci.Batch()
+	for _, opt := range [][2]string{
+		{"encryption", encryption},
+		{"ieee80211w", mfp},
+		{"key", passphrase},
+	} {
+		b.Set(ConfigWireless, iface, opt[0], opt[1])
+	}
+	if err := b.Commit(ctx); err != nil {
+		return errors.Wrapf(err, "failed to configure %s on %q", encryption, iface)
+	}
+	if err := ReloadConfigServices(ctx, uci, ConfigWireless); err != nil {
+		return err
+	}
+	if err := waitForBeaconing(ctx, uci, ssid[0]); err != nil {
+		return errors.Wrapf(err, "AP %q did not come up with %s", ssid[0], encryption)
+	}
+
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		bss, err := hostapdBSSConfig(ctx, uci, ssid[0])
+		if err != nil {
+			return err
+		}
+		if got := bss["wpa_key_mgmt"]; got != keyMgmt {
+			return errors.Errorf("unexpected wpa_key_mgmt of AP %q: got %q, want %q", ssid[0], got, keyMgmt)
+		}
+		if got := bss["ieee80211w"]; got != mfp {
+			return errors.Errorf("unexpected ieee80211w of AP %q: got %q, want %q", ssid[0], got, mfp)
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: 10 * time.Second, Interval: time.Second})
+}
+
+// hostapdBSSConfig returns the settings of the BSS with ssid in the hostapd
+// configs generated by OpenWrt.
+func hostapdBSSConfig(ctx context.Context, uci *Runner, ssid string) (map[string]string, error) {
+	out, err := uci.cmd.Output(ctx, "sh", "-c", "cat "+hostapdConfigGlob)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", filepath.Dir(hostapdConfigGlob))
+	}
+	// Each BSS starts with an "interface=" or "bss=" line.
+	var bss map[string]string
+	for _, line := range strings.Split(string(out), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "interface" || kv[0] == "bss" {
+			if bss != nil && bss["ssid"] == ssid {
+				return bss, nil
+			}
+			bss = make(map[string]string)
+		}
+		if bss != nil {
+			bss[kv[0]] = kv[1]
+		}
+	}
+	if bss != nil && bss["ssid"] == ssid {
+		return bss, nil
+	}
+	return nil, errors.Errorf("no hostapd config for SSID %q", ssid)
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// ifnameTimeout is how long to wait for the interface of a new AP to be
+// reported by "wifi status".
+const ifnameTimeout = 10 * time.Second
+
+var (
+	// wiphyRE matches the phy index in the output of "iw dev <ifname> info".
+	wiphyRE = regexp.MustCompile(`(?m)^\s*wiphy (\d+)$`)
+	// apCombinationRE matches the interface limits of the combinations
+	// allowing AP interfaces in the output of "iw phy <phy> info", e.g.
+	// "#{ AP, mesh point } <= 8".
+	apCombinationRE = regexp.MustCompile(`#\{[^}]*\bAP\b[^}]*\}\s*<=\s*(\d+)`)
+)
+
+// maxBSSIDs returns the maximum number of AP interfaces of the phy of the
+// interface ifname.
+func maxBSSIDs(ctx context.Context, uci *Runner, ifname string) (int, error) {
+	out, err := uci.cmd.Output(ctx, "iw", "dev", ifname, "info")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get info of interface %q", ifname)
+	}
+	m := wiphyRE.FindSubmatch(out)
+	if m == nil {
+		return 0, errors.Errorf("failed to find the phy of interface %q", ifname)
+	}
+	out, err = uci.cmd.Output(ctx, "iw", "phy", "phy"+string(m[1]), "info")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get info of phy%s", m[1])
+	}
+	limit := 0
+	for _, m := range apCombinationRE.FindAllSubmatch(out, -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > limit {
+			limit = n
+		}
+	}
+	if limit == 0 {
+		return 0, errors.Errorf("phy%s does not report AP interface combinations", m[1])
+	}
+	return limit, nil
+}
+
+// AddVirtualAP adds the AP described by cfg to radio, next to the APs already
+// on it, and brings it up as BringUpAP does. cfg.Iface must be a new
+// wifi-iface section. It returns the name of the network interface of the
+// new AP. An error is returned if the radio already has as many APs as its
+// phy supports.
+func AddVirtualAP(ctx context.Context, uci *Runner, radio string, cfg APProfile) (string, error) {
+	if cfg.Radio != "" && cfg.Radio != radio {
+		return "", errors.Errorf("profile is for radio %q, not %q", cfg.Radio, radio)
+	}
+	cfg.Radio = radio
+	if err := cfg.validate(); err != nil {
+		return "", errors.Wrap(err, "invalid AP profile")
+	}
+	if _, err := uci.Get(ctx, ConfigWireless, cfg.Iface, ""); err == nil {
+		return "", errors.Errorf("section %q already exists", cfg.Iface)
+	}
+
+	status, _, err := getRadioStatus(ctx, uci, radio)
+	if err != nil {
+		return "", err
+	}
+	if len(status.Interfaces) > 0 && status.Interfaces[0].Ifname != "" {
+		limit, err := maxBSSIDs(ctx, uci, status.Interfaces[0].Ifname)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get the BSSID limit of radio %q", radio)
+		}
+		if len(status.Interfaces) >= limit {
+			return "", errors.Errorf("radio %q already has %d APs, the maximum number of BSSIDs", radio, len(status.Interfaces))
+		}
+	}
+
+	if err := BringUpAP(ctx, uci, cfg); err != nil {
+		return "", err
+	}
+	var ifname string
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		status, _, err := getRadioStatus(ctx, uci, radio)
+		if err != nil {
+			return err
+		}
+		for _, iface := range status.Interfaces {
+			if iface.Section == cfg.Iface && iface.Ifname != "" {
+				ifname = iface.Ifname
+				return nil
+			}
+		}
+		return errors.Errorf("no interface for section %q", cfg.Iface)
+	}, &testing.PollOptions{Timeout: ifnameTimeout, Interval: time.Second}); err != nil {
+		return "", errors.Wrapf(err, "failed to get the interface of AP %q", cfg.SSID)
+	}
+	return ifname, nil
+}
+
+// RemoveVirtualAP removes the AP of the wifi-iface section iface added with
+// AddVirtualAP, and reloads Wi-Fi. The other APs of the radio are restarted
+// by the reload.
+func RemoveVirtualAP(ctx context.Context, uci *Runner, iface string) error {
+	if !sectionNameRE.MatchString(iface) {
+		return errors.Errorf("invalid iface section name %q", iface)
+	}
+	testing.ContextLogf(ctx, "Removing OpenWrt router AP %q", iface)
+	if _, err := uci.Delete(ctx, ConfigWireless, iface, ""); err != nil {
+		return errors.Wrapf(err, "failed to delete section %q", iface)
+	}
+	return CommitAndReloadConfig(ctx, uci, ConfigWireless)
+}
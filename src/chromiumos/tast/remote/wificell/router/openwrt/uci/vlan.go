@@ -0,0 +1,205 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uci
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// VLAN ID range as specified by IEEE 802.1Q. IDs 0 and 4095 are reserved.
+const (
+	minVLANID = 1
+	maxVLANID = 4094
+)
+
+// bridgeUpTimeout is how long to wait for the bridge to come up after the
+// network service is reloaded.
+const bridgeUpTimeout = 30 * time.Second
+
+var (
+	// switchPortRE matches a switch port membership entry, which is the port
+	// number optionally followed by "t" if the port is tagged (e.g. "0t").
+	switchPortRE = regexp.MustCompile(`^(\d+)t?$`)
+	// sectionNameRE matches valid uci section names.
+	sectionNameRE = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	// linkUpRE matches the flags of an administratively up link in the output
+	// of "ip link show", e.g. "<BROADCAST,MULTICAST,UP,LOWER_UP>".
+	linkUpRE = regexp.MustCompile(`<([^>]*,)?UP(,[^>]*)?>`)
+)
+
+// VLANConfig describes a VLAN on a switch which is bridged into a logical
+// network interface.
+//
+// See https://openwrt.org/docs/guide-user/network/vlan/switch_configuration
+// for documentation on the switch_vlan section options.
+type VLANConfig struct {
+	// Switch is the name of the switch device, e.g. "switch0".
+	Switch string
+	// VLANID is the 802.1Q VLAN ID, in the range [1, 4094].
+	VLANID int
+	// SwitchPorts are the switch ports which are members of the VLAN. A port
+	// number followed by "t" (e.g. "0t") is a tagged member.
+	SwitchPorts []string
+	// Bridge is the name of the bridge device to create, e.g. "br-vlan10".
+	Bridge string
+	// BridgePorts are the network devices to add to the bridge, e.g. "eth0.10".
+	BridgePorts []string
+	// Interface is the name of the logical interface using the bridge.
+	Interface string
+	// Proto is the protocol of the interface. Defaults to "none".
+	Proto string
+	// IPAddr is the IPv4 address of the interface, used when Proto is "static".
+	IPAddr string
+	// Netmask is the IPv4 netmask of the interface, used when Proto is "static".
+	Netmask string
+}
+
+// switchVLANSection returns the name of the switch_vlan section for cfg.
+func (cfg *VLANConfig) switchVLANSection() string {
+	return fmt.Sprintf("vlan%d", cfg.VLANID)
+}
+
+// deviceSection returns the name of the bridge device section for cfg.
+func (cfg *VLANConfig) deviceSection() string {
+	return cfg.Interface + "_dev"
+}
+
+// validate checks that cfg describes a consistent VLAN setup.
+func (cfg *VLANConfig) validate() error {
+	if cfg.Switch == "" {
+		return errors.New("switch is required")
+	}
+	if cfg.VLANID < minVLANID || cfg.VLANID > maxVLANID {
+		return errors.Errorf("VLAN ID %d out of range [%d, %d]", cfg.VLANID, minVLANID, maxVLANID)
+	}
+	if len(cfg.SwitchPorts) == 0 {
+		return errors.New("at least one switch port is required")
+	}
+	seenPorts := make(map[string]bool)
+	for _, p := range cfg.SwitchPorts {
+		m := switchPortRE.FindStringSubmatch(p)
+		if m == nil {
+			return errors.Errorf("invalid switch port %q", p)
+		}
+		if seenPorts[m[1]] {
+			return errors.Errorf("switch port %s is listed more than once", m[1])
+		}
+		seenPorts[m[1]] = true
+	}
+	if cfg.Bridge == "" {
+		return errors.New("bridge is required")
+	}
+	if len(cfg.BridgePorts) == 0 {
+		return errors.New("at least one bridge port is required")
+	}
+	seenBridgePorts := make(map[string]bool)
+	for _, p := range cfg.BridgePorts {
+		if p == "" || strings.ContainsAny(p, " \t") {
+			return errors.Errorf("invalid bridge port %q", p)
+		}
+		if seenBridgePorts[p] {
+			return errors.Errorf("bridge port %q is listed more than once", p)
+		}
+		seenBridgePorts[p] = true
+	}
+	if !sectionNameRE.MatchString(cfg.Interface) {
+		return errors.Errorf("invalid interface name %q", cfg.Interface)
+	}
+	if cfg.Proto == "static" && (cfg.IPAddr == "" || cfg.Netmask == "") {
+		return errors.New("IPAddr and Netmask are required for a static interface")
+	}
+	return nil
+}
+
+// ConfigureVLAN creates the uci sections in ConfigNetwork for the VLAN setup
+// described by cfg, commits them, reloads the network service and waits for
+// the bridge to come up.
+//
+// The sections are created in dependency order, by a single Batch: the
+// switch_vlan section, the bridge device section and the interface section
+// using the bridge. If any of them fails to be created, nothing is committed
+// and the pending changes to ConfigNetwork are reverted.
+func ConfigureVLAN(ctx context.Context, uci *Runner, cfg VLANConfig) error {
+	if err := cfg.validate(); err != nil {
+		return errors.Wrap(err, "invalid VLAN config")
+	}
+	proto := cfg.Proto
+	if proto == "" {
+		proto = "none"
+	}
+
+	testing.ContextLogf(ctx, "Configuring OpenWrt router VLAN %d on bridge %q for interface %q", cfg.VLANID, cfg.Bridge, cfg.Interface)
+	b := uci.Batch()
+	stageVLANSections(b, &cfg, proto)
+	if err := b.Commit(ctx); err != nil {
+		return errors.Wrapf(err, "failed to configure VLAN %d", cfg.VLANID)
+	}
+	if err := ReloadConfigServices(ctx, uci, ConfigNetwork); err != nil {
+		return err
+	}
+	if err := waitForLinkUp(ctx, uci, cfg.Bridge); err != nil {
+		return errors.Wrapf(err, "bridge %q did not come up", cfg.Bridge)
+	}
+	return nil
+}
+
+// stageVLANSections adds the operations setting the uci sections for cfg to b.
+func stageVLANSections(b *Batch, cfg *VLANConfig, proto string) {
+	vlan := cfg.switchVLANSection()
+	dev := cfg.deviceSection()
+	type step struct {
+		section, option, value string
+	}
+	steps := []step{
+		{vlan, "", "switch_vlan"},
+		{vlan, "device", cfg.Switch},
+		{vlan, "vlan", strconv.Itoa(cfg.VLANID)},
+		{vlan, "ports", strings.Join(cfg.SwitchPorts, " ")},
+		{dev, "", "device"},
+		{dev, "type", "bridge"},
+		{dev, "name", cfg.Bridge},
+		{cfg.Interface, "", "interface"},
+		{cfg.Interface, "device", cfg.Bridge},
+		{cfg.Interface, "proto", proto},
+	}
+	if cfg.IPAddr != "" {
+		steps = append(steps, step{cfg.Interface, "ipaddr", cfg.IPAddr})
+	}
+	if cfg.Netmask != "" {
+		steps = append(steps, step{cfg.Interface, "netmask", cfg.Netmask})
+	}
+	for _, s := range steps {
+		b.Set(ConfigNetwork, s.section, s.option, s.value)
+		// The bridge ports are a list option, so they are added separately
+		// once the device is named and before the interface refers to it.
+		if s.section == dev && s.option == "name" {
+			for _, p := range cfg.BridgePorts {
+				b.AddList(ConfigNetwork, dev, "ports", p)
+			}
+		}
+	}
+}
+
+// waitForLinkUp waits until the network device named link is up.
+func waitForLinkUp(ctx context.Context, uci *Runner, link string) error {
+	return testing.Poll(ctx, func(ctx context.Context) error {
+		out, err := uci.cmd.Output(ctx, "ip", "link", "show", "dev", link)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the state of %q", link)
+		}
+		if !linkUpRE.Match(out) {
+			return errors.Errorf("%q is not up: %s", link, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}, &testing.PollOptions{Timeout: bridgeUpTimeout})
+}
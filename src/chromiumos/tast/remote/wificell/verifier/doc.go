@@ -16,7 +16,7 @@
 // (...)
 // vf.StartJob() // This triggers starting verification loop.
 // (...test...)
-// results, err := vf.StopJob()
+// results, err := vf.StopJob(ctx)
 // (analyze results slice)
 //
 // State machine for the verifier:
@@ -0,0 +1,116 @@
+// Copyright 2022 The ChromiumOS Authors
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// MultiVerifier runs several verification functions in parallel, each in its
+// own Verifier loop, and controls them together.
+type MultiVerifier struct {
+	verifiers map[string]*Verifier
+}
+
+// NewMultiVerifier launches one verification loop for each of fns. The loops
+// are identified by the keys of fns in the results of StopJob.
+func NewMultiVerifier(ctx context.Context, fns map[string]VerifierFunc) *MultiVerifier {
+	mv := &MultiVerifier{verifiers: make(map[string]*Verifier, len(fns))}
+	for name, fn := range fns {
+		mv.verifiers[name] = NewVerifier(ctx, fn)
+	}
+	return mv
+}
+
+// names returns the names of the verification functions in sorted order.
+func (mv *MultiVerifier) names() []string {
+	var names []string
+	for name := range mv.verifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartJob starts the verification loops of all functions. If any of them
+// fails to start, the loops already started are stopped.
+func (mv *MultiVerifier) StartJob() error {
+	var started []*Verifier
+	for _, name := range mv.names() {
+		vf := mv.verifiers[name]
+		if err := vf.StartJob(); err != nil {
+			for _, s := range started {
+				s.StopJob(context.Background())
+			}
+			return errors.Wrapf(err, "failed to start verifier %s", name)
+		}
+		started = append(started, vf)
+	}
+	return nil
+}
+
+// StopJob stops the verification loops of all functions and returns all their
+// results keyed by name, including the ones of the failed rounds. The returned
+// error aggregates, per function, the failed rounds, as recorded in
+// ResultType.Err, and the error encountered while stopping its loop, if any.
+// See Verifier.StopJob for the handling of ctx.
+func (mv *MultiVerifier) StopJob(ctx context.Context) (map[string][]ResultType, error) {
+	results := make(map[string][]ResultType, len(mv.verifiers))
+	var msgs []string
+	for _, name := range mv.names() {
+		res, err := mv.verifiers[name].StopJob(ctx)
+		results[name] = res
+		if count, first, last := ErrorSummary(res); count == 1 {
+			msgs = append(msgs, fmt.Sprintf("%s: 1 round failed: %v", name, first))
+		} else if count > 1 {
+			msgs = append(msgs, fmt.Sprintf("%s: %d rounds failed, first: %v, last: %v", name, count, first, last))
+		}
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: failed to stop: %v", name, err))
+		}
+	}
+	if len(msgs) > 0 {
+		return results, errors.Errorf("verification failed: %s", strings.Join(msgs, "; "))
+	}
+	return results, nil
+}
+
+// Reset discards the results collected so far by all functions, without
+// stopping the loops. See Verifier.Reset.
+func (mv *MultiVerifier) Reset() {
+	for _, vf := range mv.verifiers {
+		vf.Reset()
+	}
+}
+
+// ResultCount returns the number of results collected so far by each
+// function, keyed by name. See Verifier.ResultCount.
+func (mv *MultiVerifier) ResultCount() map[string]int {
+	counts := make(map[string]int, len(mv.verifiers))
+	for name, vf := range mv.verifiers {
+		counts[name] = vf.ResultCount()
+	}
+	return counts
+}
+
+// SetPhase tags the results of all functions with the phase label name from
+// now on. See Verifier.SetPhase.
+func (mv *MultiVerifier) SetPhase(name string) {
+	for _, vf := range mv.verifiers {
+		vf.SetPhase(name)
+	}
+}
+
+// Finish causes all the verification goroutines to exit.
+func (mv *MultiVerifier) Finish() {
+	for _, vf := range mv.verifiers {
+		vf.Finish()
+	}
+}
@@ -6,6 +6,7 @@ package verifier
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"chromiumos/tast/errors"
@@ -16,8 +17,50 @@ import (
 type ResultType struct {
 	Data      interface{}
 	Timestamp time.Time
+	// Phase is the label of the test phase the result belongs to, as set by
+	// SetPhase when the verification round started.
+	Phase string
+	// Err is the error returned by the verification function in the round, if
+	// any. The Timestamp of a failed round is set to the time it failed, unless
+	// the function set it.
+	Err error
 }
 
+// GroupByPhase groups results by their phase labels, keeping the order of the
+// results within each phase.
+func GroupByPhase(results []ResultType) map[string][]ResultType {
+	groups := make(map[string][]ResultType)
+	for _, r := range results {
+		groups[r.Phase] = append(groups[r.Phase], r)
+	}
+	return groups
+}
+
+// ErrorSummary returns the number of failed rounds in results, and the errors
+// of the first and the last of them, for quick assertions on the results of
+// StopJob.
+func ErrorSummary(results []ResultType) (count int, first, last error) {
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		if count == 0 {
+			first = r.Err
+		}
+		last = r.Err
+		count++
+	}
+	return count, first, last
+}
+
+// ErrStoppedInFlight is returned by StopJob when its context is done while a
+// verification round is in flight, i.e. before the verification function
+// returns.
+var ErrStoppedInFlight = errors.New("verifier stopped while verification in flight")
+
+// VerifierFunc is a verification function run in a loop by a Verifier.
+type VerifierFunc func(ctx context.Context) (ret ResultType, err error)
+
 type eventType int
 
 const (
@@ -57,20 +100,58 @@ type Verifier struct {
 	// Reverse channel, for returning ACKs and results.
 	rev chan event
 	// Function pointer to run in a loop.
-	fptr func(ctx context.Context) (ret ResultType, err error)
-	// State of the worker.
+	fptr VerifierFunc
+	// State of the worker. It is only modified by the worker goroutine with stateMu held.
 	state workerState
+	// stateMu protects state for reading from outside of the worker goroutine.
+	stateMu sync.Mutex
 	// State transition table for handling states in the machine.
 	transitionTable map[eventStateTuple]transitionFptr
-	// Results storage.
-	results []ResultType
+	// Results storage. If maxResults is positive, it is used as a ring buffer
+	// of at most maxResults results once full, where head is the index of the
+	// oldest result.
+	results    []ResultType
+	head       int
+	maxResults int
+	// Number of results discarded in the current or last job because the
+	// buffer was full.
+	dropped int
+	// inFlight is set while the verification function runs.
+	inFlight bool
+	// stopping is set by StopJob until the worker stops the job, so that no
+	// new round is started in the meantime.
+	stopping bool
+	// resultsMu protects results, head, dropped, inFlight and stopping, which
+	// are read by StopJob when it cannot wait for the worker.
+	resultsMu sync.Mutex
+	// Label of the current test phase, with which the results are tagged.
+	phase string
+	// phaseMu protects phase, which is set from outside of the worker goroutine.
+	phaseMu sync.Mutex
+	// Minimum interval between the starts of the verification rounds.
+	interval time.Duration
+	// intervalMu protects interval, which is set from outside of the worker
+	// goroutine.
+	intervalMu sync.Mutex
+	// Earliest start time of the next verification round. It is only accessed
+	// by the worker goroutine.
+	nextRound time.Time
 }
 
 // NewVerifier launches goroutine for verification and sets it up.
 // The function should not take more than a minute, otherwise it may cause test flakiness.
 // The function will run in a loop anyway.
-func NewVerifier(ctx context.Context, fptr func(ctx context.Context) (ret ResultType, err error)) *Verifier {
-	ret := &Verifier{}
+func NewVerifier(ctx context.Context, fptr VerifierFunc) *Verifier {
+	return NewVerifierWithCapacity(ctx, fptr, 0)
+}
+
+// NewVerifierWithCapacity is the same as NewVerifier, except that only the
+// most recent maxResults results of a job are kept, so that long jobs do not
+// grow the memory without bound. The older results are discarded, and their
+// number is reported by Dropped. If maxResults is not positive, all results
+// are kept.
+func NewVerifierWithCapacity(ctx context.Context, fptr VerifierFunc, maxResults int) *Verifier {
+	ret := &Verifier{maxResults: maxResults}
 	// We're using non-blocking channels to facilitate cleanup when the test fails, so we don't
 	// hold one goroutine waiting for the other to receive the event (unless we explicitly want it).
 	ret.ctl = make(chan event, 2)
@@ -99,6 +180,12 @@ func (vf *Verifier) StartJob() error {
 		if !ok {
 			return errors.New("failed to receive response")
 		}
+		// Skip the ACK of a previous StopJob which did not wait for it.
+		if ret.t == verifyStopAck {
+			if ret, ok = <-vf.rev; !ok {
+				return errors.New("failed to receive response")
+			}
+		}
 		if ret.t != verifyStartAck {
 			return errors.New("bad response received")
 		}
@@ -109,50 +196,213 @@ func (vf *Verifier) StartJob() error {
 }
 
 // StopJob stops running the job and return its results. It won't interrupt the job, it will simply
-// stop looping the verification function once it returns.
-func (vf *Verifier) StopJob() ([]ResultType, error) {
+// stop looping the verification function once it returns. If ctx is done while a verification round
+// is in flight, the results collected so far are returned with ErrStoppedInFlight, and the
+// verification function in flight finishes in the background. If no round is in flight, the job
+// stops right away, so StopJob keeps waiting for it even if ctx is done.
+func (vf *Verifier) StopJob(ctx context.Context) ([]ResultType, error) {
+	vf.resultsMu.Lock()
+	vf.stopping = true
+	vf.resultsMu.Unlock()
 	vf.ctl <- event{t: verifyStop}
-	select {
-	case ret, ok := <-vf.rev:
-		if !ok {
-			return []ResultType{}, errors.New("failed to receive response")
-		}
-		if ret.t != verifyStopAck {
-			return []ResultType{}, errors.New("bad response received")
+
+	done := ctx.Done()
+	timeout := time.After(60 * time.Second)
+	for {
+		select {
+		case <-done:
+			vf.resultsMu.Lock()
+			inFlight := vf.inFlight
+			results := vf.orderedResults()
+			vf.resultsMu.Unlock()
+			if inFlight {
+				return results, ErrStoppedInFlight
+			}
+			// No new round is started once stopping is set, so the worker
+			// handles the stop without waiting for the verification function.
+			done = nil
+		case ret, ok := <-vf.rev:
+			if !ok {
+				return []ResultType{}, errors.New("failed to receive response")
+			}
+			if ret.t != verifyStopAck {
+				return []ResultType{}, errors.New("bad response received")
+			}
+			return ret.result, ret.err
+		case <-timeout:
+			return []ResultType{}, errors.New("timed out waiting for a response")
 		}
-		return ret.result, ret.err
-	case <-time.After(60 * time.Second):
-		return []ResultType{}, errors.New("timed out waiting for a response")
 	}
 }
 
+// Running reports whether the verification loop is currently active.
+func (vf *Verifier) Running() bool {
+	vf.stateMu.Lock()
+	defer vf.stateMu.Unlock()
+	return vf.state == workerStateRunning
+}
+
+// Reset discards the results collected so far in the current job, e.g. the
+// warmup samples before a measured phase, without stopping the loop. A round
+// in flight when Reset is called still adds its result afterwards.
+func (vf *Verifier) Reset() {
+	vf.resultsMu.Lock()
+	defer vf.resultsMu.Unlock()
+	vf.results = nil
+	vf.head = 0
+	vf.dropped = 0
+}
+
+// ResultCount returns the number of results collected so far in the current
+// job. It can be called while a job is running.
+func (vf *Verifier) ResultCount() int {
+	vf.resultsMu.Lock()
+	defer vf.resultsMu.Unlock()
+	return len(vf.results)
+}
+
+// Dropped returns the number of results discarded in the current job, or in
+// the last one if no job is running, because more than the capacity given to
+// NewVerifierWithCapacity were collected.
+func (vf *Verifier) Dropped() int {
+	vf.resultsMu.Lock()
+	defer vf.resultsMu.Unlock()
+	return vf.dropped
+}
+
+// appendResult adds r to the results, replacing the oldest result if the
+// capacity is reached. resultsMu must be held.
+func (vf *Verifier) appendResult(r ResultType) {
+	if vf.maxResults <= 0 || len(vf.results) < vf.maxResults {
+		vf.results = append(vf.results, r)
+		return
+	}
+	vf.results[vf.head] = r
+	vf.head = (vf.head + 1) % vf.maxResults
+	vf.dropped++
+}
+
+// orderedResults returns a copy of the results in chronological order.
+// resultsMu must be held.
+func (vf *Verifier) orderedResults() []ResultType {
+	results := append([]ResultType{}, vf.results[vf.head:]...)
+	return append(results, vf.results[:vf.head]...)
+}
+
+// SetPhase tags the results of the verification rounds starting from now with
+// the phase label name. It can be called while a job is running.
+func (vf *Verifier) SetPhase(name string) {
+	vf.phaseMu.Lock()
+	defer vf.phaseMu.Unlock()
+	vf.phase = name
+}
+
+// SetInterval sets the minimum interval between the starts of the
+// verification rounds to d, so that the verification function does not load
+// the DUT more than needed. The loop waits between the rounds as needed, while
+// still handling StopJob, and if a round takes longer than d, the next one
+// starts right away. If d is zero, which is the default, the rounds run back
+// to back. It can be called while a job is running, and takes effect from the
+// next round.
+func (vf *Verifier) SetInterval(d time.Duration) {
+	vf.intervalMu.Lock()
+	defer vf.intervalMu.Unlock()
+	vf.interval = d
+}
+
+// currentInterval returns the minimum interval between the rounds.
+func (vf *Verifier) currentInterval() time.Duration {
+	vf.intervalMu.Lock()
+	defer vf.intervalMu.Unlock()
+	return vf.interval
+}
+
+// currentPhase returns the current phase label.
+func (vf *Verifier) currentPhase() string {
+	vf.phaseMu.Lock()
+	defer vf.phaseMu.Unlock()
+	return vf.phase
+}
+
 // Finish causes verification goroutine to exit.
 func (vf *Verifier) Finish() {
 	vf.ctl <- event{t: verifyFinish}
 	close(vf.ctl)
 }
 
+// setState changes the state of the worker.
+func (vf *Verifier) setState(state workerState) {
+	vf.stateMu.Lock()
+	defer vf.stateMu.Unlock()
+	vf.state = state
+}
+
 func (vf *Verifier) startVerification(ctx context.Context) {
-	vf.state = workerStateRunning
+	vf.setState(workerStateRunning)
 	testing.ContextLog(ctx, "Start Verification")
+	vf.resultsMu.Lock()
+	vf.dropped = 0
+	vf.resultsMu.Unlock()
+	vf.nextRound = time.Time{}
 	vf.rev <- event{t: verifyStartAck}
 }
 
 func (vf *Verifier) stopVerification(ctx context.Context) {
-	vf.state = workerStateIdle
+	vf.setState(workerStateIdle)
 	testing.ContextLog(ctx, "Stop Verification")
-	vf.rev <- event{t: verifyStopAck, result: vf.results, err: nil}
+	vf.resultsMu.Lock()
+	results := vf.orderedResults()
 	vf.results = nil
+	vf.head = 0
+	dropped := vf.dropped
+	vf.stopping = false
+	vf.resultsMu.Unlock()
+	if dropped > 0 {
+		testing.ContextLogf(ctx, "Discarded %d oldest results over the capacity of %d", dropped, vf.maxResults)
+	}
+	vf.rev <- event{t: verifyStopAck, result: results, err: nil}
 }
 
 func (vf *Verifier) runVerificationRound(ctx context.Context) {
+	if wait := time.Until(vf.nextRound); wait > 0 {
+		select {
+		case rcvEvt := <-vf.ctl:
+			// The round runs on the next verifyTimeout if still running.
+			vf.handleEvent(ctx, rcvEvt.t)
+			return
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	vf.resultsMu.Lock()
+	if vf.stopping {
+		// The stop event is handled in the next iteration of the worker.
+		vf.resultsMu.Unlock()
+		return
+	}
+	vf.inFlight = true
+	vf.resultsMu.Unlock()
+	vf.nextRound = time.Now().Add(vf.currentInterval())
+	phase := vf.currentPhase()
 	ret, err := vf.fptr(ctx)
+	ret.Phase = phase
 	if err != nil {
 		testing.ContextLog(ctx, "Error encountered during verification: ", err)
-		// Simply: return from the goroutine.
-		vf.state = workerStateFinished
+		ret.Err = err
+		if ret.Timestamp.IsZero() {
+			ret.Timestamp = time.Now()
+		}
+		// The loop keeps running after the errors of single rounds, unless the
+		// context is done, in which case all the following rounds would fail.
+		if ctx.Err() != nil {
+			// Simply: return from the goroutine.
+			vf.setState(workerStateFinished)
+		}
 	}
-	vf.results = append(vf.results, ret)
+	vf.resultsMu.Lock()
+	vf.appendResult(ret)
+	vf.inFlight = false
+	vf.resultsMu.Unlock()
 }
 
 func (vf *Verifier) waitForEvent(ctx context.Context) {
@@ -162,14 +412,14 @@ func (vf *Verifier) waitForEvent(ctx context.Context) {
 }
 
 func (vf *Verifier) finishVerifier(ctx context.Context) {
-	vf.state = workerStateFinished
+	vf.setState(workerStateFinished)
 }
 
 func (vf *Verifier) handleEvent(ctx context.Context, evt eventType) {
 	if f, ok := vf.transitionTable[eventStateTuple{vf.state, evt}]; !ok {
 		testing.ContextLogf(ctx, "Bad state transition, state %d evt %d", vf.state, evt)
 		// Simply: return from the goroutine.
-		vf.state = workerStateFinished
+		vf.setState(workerStateFinished)
 	} else {
 		f(ctx)
 	}